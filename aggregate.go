@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// aggregatedMatch is a distinct match of --aggregate with the branches it was
+// found on, in search order.
+type aggregatedMatch struct {
+	Match
+	branches []string
+}
+
+// aggregateMatches collapses the matches that have the same repository, file,
+// line and text on several branches into one, keeping the order in which
+// each was first found.
+func aggregateMatches(matches []Match) []aggregatedMatch {
+	var aggregated []aggregatedMatch
+	index := make(map[string]int)
+	for _, m := range matches {
+		key := m.Repo + "\x00" + m.key()
+		if m.Commit != "" {
+			key += "\x00" + m.Commit
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(aggregated)
+			index[key] = i
+			aggregated = append(aggregated, aggregatedMatch{Match: m})
+		}
+		a := &aggregated[i]
+		if !containsString(a.branches, m.Branch) {
+			a.branches = append(a.branches, m.Branch)
+		}
+	}
+	return aggregated
+}
+
+// printAggregatedMatches writes every distinct match once, followed by the
+// branches it appears on, e.g. `src/config.go:42: apiKey = ... [main, hotfix]`.
+func printAggregatedMatches(w io.Writer, re *regexp.Regexp, matches []Match) {
+	for _, a := range aggregateMatches(matches) {
+		var repoPrefix string
+		if a.Repo != "" {
+			repoPrefix = a.Repo + ":"
+		}
+		colored := make([]string, len(a.branches))
+		for i, b := range a.branches {
+			colored[i] = branchColor(b)
+		}
+		branches := "[" + strings.Join(colored, ", ") + "]"
+		switch {
+		case a.Binary:
+			fmt.Fprintf(w, "%s%s (%s) %s\n", repoPrefix, a.File, binaryMatchText, branches)
+		case a.Commit != "":
+			fmt.Fprintf(w, "%s%s: %s %s\n", repoPrefix, lineNumColor(shortSHA(a.Commit)), highlightLine(re, a.Text), branches)
+		default:
+			fmt.Fprintf(w, "%s%s%s %s %s\n", repoPrefix, a.File, lineNumColor(fmt.Sprintf(":%d:", a.Line)), highlightLine(re, a.Text), branches)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// exportIgnoreMatcher matches paths marked export-ignore in a .gitattributes
+// file, i.e. paths that git archive would leave out of a release.
+type exportIgnoreMatcher struct {
+	rules []exportIgnoreRule
+}
+
+// exportIgnoreRule sets (export-ignore) or unsets (-export-ignore, !export-ignore)
+// the attribute for paths matching pattern. Like git, the last matching rule wins.
+type exportIgnoreRule struct {
+	pattern *regexp.Regexp
+	set     bool
+}
+
+// parseExportIgnore extracts the export-ignore patterns of a .gitattributes file.
+func parseExportIgnore(content string) *exportIgnoreMatcher {
+	m := &exportIgnoreMatcher{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, attr := range fields[1:] {
+			switch attr {
+			case "export-ignore", "export-ignore=true":
+				m.rules = append(m.rules, exportIgnoreRule{pattern: attributePatternRegexp(fields[0]), set: true})
+			case "-export-ignore", "!export-ignore":
+				m.rules = append(m.rules, exportIgnoreRule{pattern: attributePatternRegexp(fields[0]), set: false})
+			}
+		}
+	}
+	return m
+}
+
+// attributePatternRegexp converts a gitattributes pattern to a regexp matching
+// the pattern itself and everything below it when it names a directory.
+func attributePatternRegexp(pattern string) *regexp.Regexp {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(/.*)?$")
+	return regexp.MustCompile(b.String())
+}
+
+func (m *exportIgnoreMatcher) match(file string) bool {
+	file = strings.TrimPrefix(filepath.ToSlash(file), "./")
+	ignored := false
+	for _, r := range m.rules {
+		if r.pattern.MatchString(file) {
+			ignored = r.set
+		}
+	}
+	return ignored
+}
+
+// loadExportIgnore reads the top-level .gitattributes of the branch being
+// searched: from the materialized tree, or from the ref in no-checkout mode.
+func loadExportIgnore(ws *workspace, branch string) *exportIgnoreMatcher {
+	var content string
+	if ws.strategy == "none" {
+		content, _ = runGitCmd(ws.repoPath, "show", branchRef(ws.repoPath, branch)+":.gitattributes")
+	} else if data, err := os.ReadFile(filepath.Join(ws.dir, ".gitattributes")); err == nil {
+		content = string(data)
+	}
+	return parseExportIgnore(content)
+}
+
+// filterExportIgnored drops the matches in files marked export-ignore.
+func filterExportIgnored(ws *workspace, branch string, matches []Match) []Match {
+	m := loadExportIgnore(ws, branch)
+	if len(m.rules) == 0 {
+		return matches
+	}
+	var kept []Match
+	for _, match := range matches {
+		if match.File == "" || !m.match(match.File) {
+			kept = append(kept, match)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// patternTimeoutError reports an engine killed after --pattern-timeout. Unlike
+// a slow checkout, an engine that runs this long on a single branch almost
+// always means catastrophic backtracking, so the branch is skipped with a
+// diagnosis rather than failing the run.
+type patternTimeoutError struct {
+	engine  string
+	timeout time.Duration
+}
+
+func (e *patternTimeoutError) Error() string {
+	hint := "simplify nested quantifiers such as (a+)+ and backreferences"
+	if e.engine == "rg" {
+		hint = "try --rg-args=--no-pcre2 so that rg uses its linear-time regex engine, or " + hint
+	}
+	return fmt.Sprintf("%s was still matching after %s (--pattern-timeout), probably catastrophic backtracking in the pattern; %s", e.engine, e.timeout, hint)
+}
+
+// withPatternTimeout returns opts bounded by --pattern-timeout for one engine
+// run, and the function releasing its timer. Without the flag opts is returned
+// as is.
+func (o *Options) withPatternTimeout() (*Options, context.CancelFunc) {
+	if o.PatternTimeout <= 0 {
+		return o, func() {}
+	}
+	ctx, cancel := context.WithTimeout(o.context(), o.PatternTimeout)
+	return o.withContext(ctx), cancel
+}
+
+// patternTimedOut reports whether the --pattern-timeout of opts, as returned
+// by withPatternTimeout, ran out. A --branch-timeout that ran out first is
+// reported as such by the branch search instead.
+func (o *Options) patternTimedOut() bool {
+	return o.PatternTimeout > 0 && o.context().Err() == context.DeadlineExceeded
+}
+
+// engineLimitMarkers are the messages with which engines give up on a line
+// their backtracking limit was reached on, e.g. rg's
+// "PCRE2: error matching: match limit exceeded".
+var engineLimitMarkers = []string{"match limit exceeded", "depth limit exceeded", "heap limit exceeded", "backtracking limit"}
+
+// reportEngineLimits warns about the files in the engine output lines that
+// engine stopped matching because of its own backtracking limits, which
+// would otherwise silently look like files without matches.
+func reportEngineLimits(engine string, lines []string) {
+	for _, line := range lines {
+		for _, marker := range engineLimitMarkers {
+			if strings.Contains(line, marker) {
+				statusf("🧨 %s gave up matching (probably catastrophic backtracking): %s\n", engine, strings.TrimSpace(line))
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func benchmarkCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "benchmark",
+		Usage: "Time the same search with every available engine on the current checkout and compare match counts",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "repo",
+				Usage: "Path to the git repository to search",
+				Value: ".",
+			},
+			&cli.StringSliceFlag{
+				Name:     "regex",
+				Usage:    "Regular expression pattern to search for. Repeatable.",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "runs",
+				Usage: "Number of runs per engine; the fastest one is reported",
+				Value: 3,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return runBenchmark(c.String("repo"), c.StringSlice("regex"), c.Int("runs"))
+		},
+	}
+}
+
+// benchmarkResult is the outcome of timing a single engine.
+type benchmarkResult struct {
+	engine  string
+	best    time.Duration
+	matches int
+	err     error
+}
+
+func runBenchmark(repo string, patterns []string, runs int) error {
+	repoPath, err := filepath.Abs(repo)
+	if err != nil {
+		return fmt.Errorf("invalid repo path: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); os.IsNotExist(err) {
+		return fmt.Errorf("not a git repository: %s", repoPath)
+	}
+	if runs < 1 {
+		runs = 1
+	}
+	opts := &Options{Patterns: patterns}
+
+	// git grep only sees tracked files, rg and grep also untracked ones that
+	// are not ignored, so the baseline for parity is the first file engine.
+	engines := []string{"grep"}
+	if commandExists("rg") {
+		engines = []string{"rg", "grep"}
+	}
+	var results []benchmarkResult
+	for _, engine := range append(engines, "git grep") {
+		r := benchmarkResult{engine: engine}
+		for i := 0; i < runs; i++ {
+			start := time.Now()
+			var n int
+			if engine == "git grep" {
+				var matches []Match
+				matches, r.err = gitGrepRef(repoPath, opts, "")
+				n = len(matches)
+			} else {
+				var lines []string
+				lines, r.err = runEngine(engine, repoPath, opts)
+				n = len(parseEngineOutput(engine, lines, opts))
+			}
+			if r.err != nil {
+				break
+			}
+			if elapsed := time.Since(start); i == 0 || elapsed < r.best {
+				r.best = elapsed
+			}
+			r.matches = n
+		}
+		results = append(results, r)
+	}
+
+	fmt.Printf("📁 Repository: %s\n", repoPath)
+	fmt.Printf("🔍 Search pattern: %s\n", opts.patternLabel())
+	fmt.Printf("⏱️  Best of %d run(s) on the current checkout:\n\n", runs)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", headerColor("Engine"), headerColor("Time"), headerColor("Matches"), headerColor("Parity"))
+	baseline := results[0].matches
+	mismatches := 0
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t❌ %v\n", r.engine, r.err)
+			continue
+		}
+		parity := "✅"
+		switch {
+		case r.engine == "git grep" && r.matches != baseline:
+			parity = "ℹ️  tracked files only"
+		case r.matches != baseline:
+			parity = fmt.Sprintf("⚠️  %+d vs %s", r.matches-baseline, results[0].engine)
+			mismatches++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", r.engine, r.best.Round(time.Microsecond), r.matches, parity)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if mismatches > 0 {
+		fmt.Println("⚠️  The engines disagree on the match count; the pattern probably uses syntax their regex dialects interpret differently.")
+	} else {
+		fmt.Println("✨ Benchmark completed!")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blameInfo holds the last commit of a single line as reported by git blame.
+type blameInfo struct {
+	Commit    string
+	Author    string
+	Committer string
+	// Date is the author date of Commit, as YYYY-MM-DD.
+	Date string
+}
+
+// blameLines runs git blame once for the given lines of file at rev, or at the
+// checked out working tree when rev is empty, and returns their info by line
+// number. Lines that are not committed yet are left out.
+func blameLines(repoPath, rev, file string, lines []int) (map[int]blameInfo, error) {
+	args := []string{"blame", "--porcelain"}
+	for _, line := range lines {
+		args = append(args, "-L", fmt.Sprintf("%d,%d", line, line))
+	}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--", file)
+	out, err := runGitCmd(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("git blame failed for %s: %v", file, err)
+	}
+
+	// The commit headers follow only the first line attributed to a commit
+	commits := make(map[string]*blameInfo)
+	byLine := make(map[int]*blameInfo)
+	var cur *blameInfo
+	for _, l := range strings.Split(out, "\n") {
+		if strings.HasPrefix(l, "\t") {
+			continue
+		}
+		// "<sha> <orig line> <final line> [<group size>]"
+		if fields := strings.Fields(l); len(fields) >= 3 && isCommitSHA(fields[0]) {
+			final, err := strconv.Atoi(fields[2])
+			if err != nil {
+				continue
+			}
+			if commits[fields[0]] == nil {
+				commits[fields[0]] = &blameInfo{Commit: fields[0]}
+			}
+			cur = commits[fields[0]]
+			byLine[final] = cur
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(l, " ")
+		switch key {
+		case "author":
+			cur.Author = value
+		case "committer":
+			cur.Committer = value
+		case "author-time":
+			if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+				cur.Date = time.Unix(ts, 0).UTC().Format("2006-01-02")
+			}
+		}
+	}
+
+	infos := make(map[int]blameInfo, len(byLine))
+	for line, info := range byLine {
+		if strings.Trim(info.Commit, "0") != "" {
+			infos[line] = *info
+		}
+	}
+	return infos, nil
+}
+
+// isCommitSHA reports whether s is a full SHA-1 or SHA-256 hex object name.
+func isCommitSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// blameMatches blames the file matches with one git blame per file and
+// returns the info of every match that could be attributed, by index.
+// Commit message, binary and untracked or uncommitted matches have none.
+func blameMatches(repoPath, rev string, matches []Match) map[int]blameInfo {
+	byFile := make(map[string][]int)
+	var files []string
+	for i, m := range matches {
+		if m.Commit != "" || m.Binary {
+			continue
+		}
+		if byFile[m.File] == nil {
+			files = append(files, m.File)
+		}
+		byFile[m.File] = append(byFile[m.File], i)
+	}
+	sort.Strings(files)
+
+	infos := make(map[int]blameInfo)
+	for _, file := range files {
+		var lines []int
+		for _, i := range byFile[file] {
+			lines = append(lines, matches[i].Line)
+		}
+		byLine, err := blameLines(repoPath, rev, file, lines)
+		if err != nil {
+			continue
+		}
+		for _, i := range byFile[file] {
+			if info, ok := byLine[matches[i].Line]; ok {
+				infos[i] = info
+			}
+		}
+	}
+	return infos
+}
+
+// filterByBlame keeps only the matches whose blame author/committer match the
+// configured filters, and with --blame attaches the last commit of every
+// matched line. Blame is only run when one of them is set since it costs one
+// git invocation per matched file.
+func filterByBlame(opts *Options, repoPath, rev string, matches []Match) []Match {
+	filtering := opts.authorRe != nil || opts.committerRe != nil
+	if !filtering && !opts.Blame {
+		return matches
+	}
+	infos := blameMatches(repoPath, rev, matches)
+	var kept []Match
+	for i, m := range matches {
+		info, ok := infos[i]
+		if !ok {
+			// Untracked or uncommitted lines cannot be attributed to anyone
+			if !filtering {
+				kept = append(kept, m)
+			}
+			continue
+		}
+		if opts.authorRe != nil && !opts.authorRe.MatchString(info.Author) {
+			continue
+		}
+		if opts.committerRe != nil && !opts.committerRe.MatchString(info.Committer) {
+			continue
+		}
+		m.Author = info.Author
+		m.Committer = info.Committer
+		if opts.Blame {
+			m.BlameCommit = info.Commit
+			m.BlameDate = info.Date
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
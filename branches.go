@@ -0,0 +1,468 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// branchIgnoreFile is the repo-local file listing branch globs that are never
+// searched, one per line.
+const branchIgnoreFile = ".git-regex-search-ignore"
+
+// listBranches returns the branches to search in --sort-branches order,
+// without those excluded by --exclude-branch or the repository's
+// .git-regex-search-ignore file.
+func listBranches(opts *Options, repoPath string) ([]string, error) {
+	branches, err := resolveBranches(opts, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	globs := append([]string(nil), opts.ExcludeBranches...)
+	if !opts.NoIgnoreBranches {
+		globs = append(globs, readBranchIgnoreFile(repoPath)...)
+	}
+	var kept []string
+	for _, b := range branches {
+		if glob, ok := matchBranchGlob(globs, b); ok {
+			statusf("🚫 Excluding branch %s (matches %s)\n", branchColor(b), glob)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	if opts.branchFilterRe != nil || opts.branchExcludeRe != nil {
+		kept = filterBranchNames(opts, kept)
+	}
+	if opts.NormalizeBranches {
+		kept = normalizeBranchNames(opts, repoPath, kept)
+	}
+	sortBranches(opts.SortBranches, repoPath, kept)
+	return kept, nil
+}
+
+// filterBranchNames keeps the branches whose names match --branch-filter and
+// do not match --branch-exclude, and reports how many are left.
+func filterBranchNames(opts *Options, branches []string) []string {
+	var kept []string
+	for _, b := range branches {
+		if opts.branchFilterRe != nil && !opts.branchFilterRe.MatchString(b) {
+			continue
+		}
+		if opts.branchExcludeRe != nil && opts.branchExcludeRe.MatchString(b) {
+			continue
+		}
+		kept = append(kept, b)
+	}
+	statusf("🔎 %d of %d branches left after --branch-filter/--branch-exclude\n", len(kept), len(branches))
+	return kept
+}
+
+// branchNamePreferences lists the accepted values of --prefer-branch-name.
+var branchNamePreferences = []string{"local", "remote"}
+
+// normalizeBranchNames collapses the candidates that are the same branch under
+// a local and a remote name, such as main and upstream/main or
+// refs/heads/main and refs/remotes/origin/main, when they point to the same
+// commit: it is searched once, under the name --prefer-branch-name picks, in
+// the position of the first of them. Copies at different commits are all
+// kept, since they do have different contents.
+func normalizeBranchNames(opts *Options, repoPath string, branches []string) []string {
+	remotes, err := runGitCmd(repoPath, "remote")
+	if err != nil {
+		statusf("⚠️  Warning: failed to list the remotes, only %s/ is recognized as a remote prefix: %v\n", remoteName, err)
+		remotes = remoteName
+	}
+	remoteNames := strings.Fields(remotes)
+	// shortName strips refs/heads/, refs/remotes/ and the remote of a name,
+	// and reports whether it named a remote-tracking branch
+	shortName := func(b string) (string, bool) {
+		if name, ok := strings.CutPrefix(b, "refs/heads/"); ok {
+			return name, false
+		}
+		name, isRemote := strings.CutPrefix(b, "refs/remotes/")
+		for _, r := range remoteNames {
+			if rest, ok := strings.CutPrefix(name, r+"/"); ok {
+				return rest, true
+			}
+		}
+		return name, isRemote
+	}
+
+	type group struct {
+		index int
+		names []string
+	}
+	var kept []string
+	var order []*group
+	groups := make(map[string]*group)
+	for _, b := range branches {
+		rev := b
+		if !strings.HasPrefix(b, "refs/") {
+			rev = branchRef(repoPath, b)
+		}
+		sha, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+		name, isRemote := shortName(b)
+		if err != nil {
+			kept = append(kept, b)
+			continue
+		}
+		key := name + "\x00" + sha
+		g, seen := groups[key]
+		if !seen {
+			g = &group{index: len(kept), names: []string{b}}
+			groups[key] = g
+			order = append(order, g)
+			kept = append(kept, b)
+			continue
+		}
+		g.names = append(g.names, b)
+		if _, keptRemote := shortName(kept[g.index]); isRemote != keptRemote && isRemote == (opts.PreferBranchName == "remote") {
+			kept[g.index] = b
+		}
+	}
+	for _, g := range order {
+		if len(g.names) > 1 {
+			statusf("🔗 Searching %s once: %s point to the same commit (--normalize-branch-names)\n", branchColor(kept[g.index]), strings.Join(g.names, ", "))
+		}
+	}
+	return kept
+}
+
+// branchSortOrders lists the accepted values of --sort-branches.
+var branchSortOrders = []string{"name", "recency", "none"}
+
+// sortBranches orders branches by name, or by the commit date of their tips
+// with the most recent first (ties by name). "none" keeps git's order, or the
+// order of --branches.
+func sortBranches(order, repoPath string, branches []string) {
+	switch order {
+	case "name":
+		sort.Strings(branches)
+	case "recency":
+		dates := make(map[string]int64, len(branches))
+		for _, b := range branches {
+			dates[b], _ = commitTime(repoPath, branchRef(repoPath, b))
+		}
+		sort.SliceStable(branches, func(i, j int) bool {
+			if dates[branches[i]] != dates[branches[j]] {
+				return dates[branches[i]] > dates[branches[j]]
+			}
+			return branches[i] < branches[j]
+		})
+	}
+}
+
+// commitTime returns the committer date of rev as a Unix timestamp.
+func commitTime(repoPath, rev string) (int64, error) {
+	out, err := runGitCmd(repoPath, "log", "-1", "--format=%ct", rev+"^{commit}")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(out, 10, 64)
+}
+
+// filterUpdatedSince keeps only the branches whose tip commit is newer than
+// the Unix timestamp since.
+func filterUpdatedSince(repoPath string, since int64, branches []string) []string {
+	var kept []string
+	for _, b := range branches {
+		if t, err := commitTime(repoPath, branchRef(repoPath, b)); err == nil && t > since {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+// readBranchIgnoreFile returns the globs in the repository's branch ignore
+// file. Blank lines and lines starting with # are skipped.
+func readBranchIgnoreFile(repoPath string) []string {
+	content, err := os.ReadFile(filepath.Join(repoPath, branchIgnoreFile))
+	if err != nil {
+		return nil
+	}
+	var globs []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			globs = append(globs, line)
+		}
+	}
+	return globs
+}
+
+// matchBranchGlob returns the first glob matching branch. As in path.Match,
+// * does not match a slash, so feature/* matches feature/login but not
+// feature/a/b.
+func matchBranchGlob(globs []string, branch string) (string, bool) {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, branch); ok {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// resolveBranches returns the candidate branches: the full names of the refs
+// matching --ref-glob, the --branches list, or otherwise the refs picked by
+// --remote, --local and --tags, remote branches with their "<remote>/" prefix
+// stripped.
+func resolveBranches(opts *Options, repoPath string) ([]string, error) {
+	var branches []string
+	listedRefs.set(repoPath, nil)
+	if len(opts.RefGlobs) > 0 {
+		refList, err := forEachRef(opts, repoPath, "%(refname)", opts.RefGlobs...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list refs: %v", err)
+		}
+		for _, r := range strings.Split(refList, "\n") {
+			if r = strings.TrimSpace(r); r != "" {
+				branches = append(branches, r)
+			}
+		}
+		return branches, nil
+	}
+	if len(opts.Branches) > 0 {
+		for _, b := range opts.Branches {
+			if b = strings.TrimSpace(b); b != "" {
+				// upstream/main names the same branch as main; it is checked
+				// out and pulled as main rather than searched detached
+				if short, ok := strings.CutPrefix(b, remoteName+"/"); ok {
+					if _, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", "refs/remotes/"+b); err == nil {
+						b = short
+					}
+				}
+				branches = append(branches, b)
+			}
+		}
+		return branches, nil
+	}
+
+	// A local branch and its origin counterpart share one name. At the same
+	// commit they are searched once, at the full ref of the first of them;
+	// otherwise the local branch keeps the name and the remote one is searched
+	// as <remote>/<branch>, so that unpushed commits are not missed
+	refs := make(map[string]string)
+	add := func(b, ref string) {
+		if b == "" {
+			return
+		}
+		seen, ok := refs[b]
+		if !ok {
+			refs[b] = ref
+			branches = append(branches, b)
+			return
+		}
+		if sameCommit(repoPath, seen, ref) {
+			return
+		}
+		remote := remoteName + "/" + b
+		for i := range branches {
+			if branches[i] == b {
+				branches[i] = remote
+			}
+		}
+		refs[remote] = seen
+		refs[b] = ref
+		branches = append(branches, b)
+	}
+	if opts.SearchRemote {
+		// "<remote>/<branch> <symref target>"; origin/HEAD is a symref
+		branchList, err := forEachRef(opts, repoPath, "%(refname:lstrip=2) %(symref)", "refs/remotes")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list remote branches: %v", err)
+		}
+		for _, line := range strings.Split(branchList, "\n") {
+			if b, symref, _ := strings.Cut(line, " "); symref == "" && b != "" {
+				add(strings.TrimPrefix(b, remoteName+"/"), "refs/remotes/"+b)
+			}
+		}
+	}
+	if opts.SearchLocal {
+		localList, err := forEachRef(opts, repoPath, "%(refname:lstrip=2)", "refs/heads")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list local branches: %v", err)
+		}
+		for _, b := range strings.Split(localList, "\n") {
+			add(b, "refs/heads/"+b)
+		}
+	}
+	if opts.SearchTags {
+		tagList, err := forEachRef(opts, repoPath, "%(refname)", "refs/tags")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %v", err)
+		}
+		for _, t := range strings.Split(tagList, "\n") {
+			add(t, t)
+		}
+	}
+	listedRefs.set(repoPath, refs)
+	if opts.SearchLocal || opts.SearchTags {
+		branches = dropSameCommit(repoPath, branches)
+	}
+	return branches, nil
+}
+
+// sameCommit reports whether refs a and b resolve to the same commit.
+func sameCommit(repoPath, a, b string) bool {
+	shaA, errA := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", a+"^{commit}")
+	shaB, errB := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", b+"^{commit}")
+	return errA == nil && errB == nil && shaA == shaB
+}
+
+// dropSameCommit keeps only the first of the refs that resolve to the same
+// commit, e.g. a release branch and the tag on its tip, since searching the
+// others again would find exactly the same matches.
+func dropSameCommit(repoPath string, refs []string) []string {
+	var kept []string
+	firstAt := make(map[string]string)
+	for _, r := range refs {
+		rev := r
+		if !strings.HasPrefix(r, "refs/") {
+			rev = branchRef(repoPath, r)
+		}
+		sha, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+		if err != nil {
+			kept = append(kept, r)
+			continue
+		}
+		if first, ok := firstAt[sha]; ok {
+			statusf("⏭️  Skipping %s (same commit as %s)\n", branchColor(r), first)
+			continue
+		}
+		firstAt[sha] = r
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// forEachRef lists the refs matching patterns with git for-each-ref in
+// format, ordered by --branch-sort. A key git does not know is reported and
+// the refs are listed in git's default order (by name) instead.
+func forEachRef(opts *Options, repoPath, format string, patterns ...string) (string, error) {
+	args := append([]string{"for-each-ref", "--format=" + format}, patterns...)
+	if opts.BranchSort != "" {
+		out, err := runGitCmd(repoPath, append([]string{args[0], "--sort=" + opts.BranchSort}, args[1:]...)...)
+		if err == nil {
+			return out, nil
+		}
+		statusf("⚠️  Warning: git for-each-ref does not accept --branch-sort %q (%v); listing branches by name\n", opts.BranchSort, err)
+	}
+	return runGitCmd(repoPath, args...)
+}
+
+// remoteName is the remote whose branches are searched and pulled from
+// (--remote-name).
+var remoteName = "origin"
+
+// listedRefs remembers, per repository, the full ref (refs/heads/<name> or
+// refs/remotes/<remote>/<name>) each branch listed by --local and --remote
+// was found under, since a local branch and its remote-tracking counterpart
+// may point to different commits.
+var listedRefs = &branchRefs{byRepo: map[string]map[string]string{}}
+
+// branchRefs maps the branch names of each repository to their full refs.
+type branchRefs struct {
+	mu     sync.Mutex
+	byRepo map[string]map[string]string
+}
+
+// set replaces the refs recorded for repoPath; nil forgets them.
+func (r *branchRefs) set(repoPath string, refs map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if refs == nil {
+		delete(r.byRepo, repoPath)
+		return
+	}
+	r.byRepo[repoPath] = refs
+}
+
+// lookup returns the full ref branch was listed under in repoPath.
+func (r *branchRefs) lookup(repoPath, branch string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref, ok := r.byRepo[repoPath][branch]
+	return ref, ok
+}
+
+// branchRef returns the revision to use when inspecting branch without
+// checking it out: the ref it was listed under, or for branches named with
+// --branches the remote-tracking ref when it exists.
+func branchRef(repoPath, branch string) string {
+	if ref, ok := listedRefs.lookup(repoPath, branch); ok {
+		return ref
+	}
+	if _, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", remoteName+"/"+branch); err == nil {
+		return remoteName + "/" + branch
+	}
+	return branch
+}
+
+// branchLabel returns the name matches on branch are reported under: the short
+// name, or with --keep-ref-prefix the ref that was searched, such as
+// origin/<branch>.
+func branchLabel(opts *Options, repoPath, branch string) string {
+	if opts.KeepRefPrefix {
+		ref := branchRef(repoPath, branch)
+		if name, ok := strings.CutPrefix(ref, "refs/remotes/"); ok {
+			return name
+		}
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	return branch
+}
+
+// filterNewerThan keeps only the branches that contain ref, i.e. branches
+// whose branch point is at or after ref.
+func filterNewerThan(repoPath, ref string, branches []string) []string {
+	var kept []string
+	for _, b := range branches {
+		if _, err := runGitCmd(repoPath, "merge-base", "--is-ancestor", ref, branchRef(repoPath, b)); err == nil {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+// fetchRemotes refreshes the remote-tracking branches with git fetch --all,
+// unless --read-only or --offline rule it out.
+func fetchRemotes(opts *Options, repoPath string) {
+	switch {
+	case opts.Offline:
+		statusln("📴 Offline: searching the locally cached refs, which may be behind the remote")
+	case !opts.ReadOnly:
+		statusln("🌐 Fetching remote branches...")
+		_, _ = runGitCmd(repoPath, "fetch", "--all", "--quiet")
+	}
+}
+
+// searchBranchNames matches the pattern against the branch names themselves
+// instead of their contents.
+func searchBranchNames(opts *Options, repoPath, repoName string, res *Result) error {
+	fetchRemotes(opts, repoPath)
+
+	branches, err := listBranches(opts, repoPath)
+	if err != nil {
+		return err
+	}
+	statusf("Matching %d branch names...\n\n", len(branches))
+
+	for _, b := range branches {
+		var matches []Match
+		if opts.re.MatchString(b) {
+			matches = append(matches, Match{Repo: repoName, Branch: b, Text: b})
+			if opts.streamsText() {
+				if repoName != "" {
+					fmt.Fprint(matchOutput, repoName+":")
+				}
+				fmt.Fprintln(matchOutput, highlightMatches(opts.re, b))
+			}
+		}
+		res.addBranch(repoName, b, matches)
+	}
+	return nil
+}
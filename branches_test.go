@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+func TestNormalizeBranchNames(t *testing.T) {
+	defer func(w io.Writer) { statusWriter = w }(statusWriter)
+	statusWriter = io.Discard
+
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	// A local develop one commit ahead of origin/develop
+	gitfixture.Git(t, repo, "checkout", "--quiet", "-b", "develop", "origin/develop")
+	gitfixture.Commit(t, repo, "Unpushed", map[string]string{"c.txt": "TODO not pushed\n"})
+	gitfixture.Git(t, repo, "checkout", "--quiet", "main")
+
+	refs := []string{"refs/heads/main", "refs/remotes/origin/main", "refs/heads/develop", "refs/remotes/origin/develop"}
+	tests := []struct {
+		name     string
+		prefer   string
+		readOnly bool
+		branches []string
+		want     []string
+	}{
+		{name: "prefer local", prefer: "local", branches: refs, want: []string{"refs/heads/main", "refs/heads/develop", "refs/remotes/origin/develop"}},
+		{name: "prefer remote", prefer: "remote", branches: refs, want: []string{"refs/remotes/origin/main", "refs/heads/develop", "refs/remotes/origin/develop"}},
+		{name: "short names", prefer: "local", branches: []string{"origin/main", "main"}, want: []string{"main"}},
+		{name: "read-only", prefer: "local", readOnly: true, branches: []string{"origin/main", "main"}, want: []string{"main"}},
+		{name: "no duplicates", prefer: "local", branches: []string{"main", "refs/heads/develop"}, want: []string{"main", "refs/heads/develop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(readOnly bool) { readOnlyGit = readOnly }(readOnlyGit)
+			readOnlyGit = tt.readOnly
+			got := normalizeBranchNames(&Options{PreferBranchName: tt.prefer}, repo, tt.branches)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeBranchNames(%q) = %q, want %q", tt.branches, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalAndRemoteBranchesAtDifferentCommits(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	// A local develop one commit ahead of origin/develop
+	gitfixture.Git(t, repo, "checkout", "--quiet", "-b", "develop", "origin/develop")
+	gitfixture.Commit(t, repo, "Unpushed", map[string]string{"c.txt": "TODO not pushed\n"})
+	gitfixture.Git(t, repo, "checkout", "--quiet", "main")
+
+	local := []string{
+		"develop:a.txt:1:hello TODO",
+		"develop:b.txt:1:another TODO",
+		"develop:c.txt:1:TODO not pushed",
+		"main:a.txt:1:hello TODO",
+	}
+	both := append(append([]string(nil), local...),
+		"origin/develop:a.txt:1:hello TODO",
+		"origin/develop:b.txt:1:another TODO",
+	)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "local", args: []string{"--local", "--no-checkout"}, want: local},
+		{name: "local and remote", args: []string{"--local", "--remote", "--no-checkout"}, want: both},
+		{name: "local and remote in a worktree", args: []string{"--local", "--remote", "--worktree"}, want: both},
+		{name: "local and remote checked out", args: []string{"--local", "--remote"}, want: both},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--repo", repo, "--regex", "TODO", "-q", "--format", "grep", "--with-branch"}, tt.args...)
+			out, err := runApp(t, args...)
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if got := strings.Split(strings.TrimSpace(out), "\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
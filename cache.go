@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// resultCacheVersion is part of every cache key; bump it when the cached
+// matches change meaning.
+const resultCacheVersion = 1
+
+// resultCache stores the raw search results of a branch in --cache-dir, keyed
+// by the branch's tip commit and by the options that affect what a search of
+// that commit finds.
+type resultCache struct {
+	dir string
+}
+
+// cacheKeyOptions are the options that change the raw results of a branch
+// search. Options applied to them afterwards, like --not-matching or
+// --line-range, are left out so that changing them reuses the cache.
+type cacheKeyOptions struct {
+	Version             int
+	Patterns            []string
+	IncludeGlobs        []string
+	ExcludeGlobs        []string
+	BranchGlobs         map[string][]string
+	FirstMatch          bool
+	OnlyMatching        bool
+	SmartCase           bool
+	IgnoreCase          bool `json:",omitempty"`
+	RegexFlags          string
+	ContextSeparator    string
+	ContextLines        int `json:",omitempty"`
+	BeforeLines         int `json:",omitempty"`
+	AfterLines          int `json:",omitempty"`
+	GlobCaseInsensitive bool
+	CheckoutStrategy    string
+	TrackedOnly         bool
+	Engine              string
+	RgArgs              []string
+	GrepArgs            []string
+	SparsePaths         []string
+	PreCommand          string
+	IgnorePreErrors     bool
+	SearchSubmodules    bool
+	RespectExportIgnore bool
+	SearchCommits       bool
+	Author              string
+	Committer           string
+	NormalizePaths      bool
+	SinceTag            string
+	NewlineHandling     string
+	IncludeIgnored      bool
+	FollowSymlinks      bool `json:",omitempty"`
+	TranslateERE        bool
+	ChangedSince        string `json:",omitempty"`
+	// CommitsSince is the --since-last-run time, which limits --search-commits.
+	CommitsSince int64 `json:",omitempty"`
+}
+
+// newResultCache returns the cache for opts in --cache-dir, or nil without it.
+func newResultCache(opts *Options) (*resultCache, error) {
+	if opts.CacheDir == "" {
+		return nil, nil
+	}
+	dir, err := cacheKeyDir(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return &resultCache{dir: dir}, nil
+}
+
+// cacheKeyDir returns the directory of --cache-dir holding the entries for
+// the search options of opts.
+func cacheKeyDir(opts *Options) (string, error) {
+	var commitsSince int64
+	if opts.SinceLastRun && opts.SearchCommits {
+		commitsSince = opts.sinceTime
+	}
+	key, err := json.Marshal(cacheKeyOptions{
+		Version:             resultCacheVersion,
+		Patterns:            opts.Patterns,
+		IncludeGlobs:        opts.IncludeGlobs,
+		ExcludeGlobs:        opts.ExcludeGlobs,
+		BranchGlobs:         opts.BranchGlobs,
+		FirstMatch:          opts.FirstMatch,
+		OnlyMatching:        opts.onlyMatching(),
+		SmartCase:           opts.SmartCase,
+		IgnoreCase:          opts.IgnoreCase,
+		RegexFlags:          opts.RegexFlags,
+		ContextSeparator:    opts.ContextSeparator,
+		ContextLines:        opts.ContextLines,
+		BeforeLines:         opts.BeforeLines,
+		AfterLines:          opts.AfterLines,
+		GlobCaseInsensitive: opts.GlobCaseInsensitive,
+		CheckoutStrategy:    opts.CheckoutStrategy,
+		TrackedOnly:         opts.TrackedOnly,
+		Engine:              opts.Engine,
+		RgArgs:              opts.RgArgs,
+		GrepArgs:            opts.GrepArgs,
+		SparsePaths:         opts.SparsePaths,
+		PreCommand:          opts.PreCommand,
+		IgnorePreErrors:     opts.IgnorePreErrors,
+		SearchSubmodules:    opts.SearchSubmodules,
+		RespectExportIgnore: opts.RespectExportIgnore,
+		SearchCommits:       opts.SearchCommits,
+		Author:              opts.Author,
+		Committer:           opts.Committer,
+		NormalizePaths:      opts.NormalizePaths,
+		SinceTag:            opts.SinceTag,
+		NewlineHandling:     opts.NewlineHandling,
+		IncludeIgnored:      opts.IncludeIgnored,
+		FollowSymlinks:      opts.FollowSymlinks,
+		TranslateERE:        opts.TranslateERE,
+		ChangedSince:        opts.ChangedSince,
+		CommitsSince:        commitsSince,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(key)
+	return filepath.Join(opts.CacheDir, hex.EncodeToString(sum[:8])), nil
+}
+
+// load returns the cached matches of the commit tip, if any.
+func (c *resultCache) load(tip string) ([]Match, bool) {
+	if c == nil || tip == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, tip+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var matches []Match
+	if err := json.Unmarshal(data, &matches); err != nil {
+		return nil, false
+	}
+	return matches, true
+}
+
+// store records the matches found at the commit tip. Failures only cost the
+// next run a search, so they are reported but not returned.
+func (c *resultCache) store(tip string, matches []Match) {
+	if c == nil || tip == "" {
+		return
+	}
+	if matches == nil {
+		matches = []Match{}
+	}
+	data, err := json.Marshal(matches)
+	if err == nil {
+		// Branches searched in parallel may share a tip
+		var tmp *os.File
+		if tmp, err = os.CreateTemp(c.dir, ".entry-*"); err == nil {
+			_, err = tmp.Write(data)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(tmp.Name(), filepath.Join(c.dir, tip+".json"))
+			}
+			if err != nil {
+				_ = os.Remove(tmp.Name())
+			}
+		}
+	}
+	if err != nil {
+		statusf("⚠️  Warning: failed to write cache entry: %v\n", err)
+	}
+}
+
+// tipCommit returns the commit branch points at, or "" if it cannot be resolved.
+func tipCommit(repoPath, branch string) string {
+	sha, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", branchRef(repoPath, branch)+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return sha
+}
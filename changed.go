@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// changedFiles returns the files ref added or modified since it branched off
+// base, i.e. relative to their merge-base. Deleted files are left out, as
+// there is nothing left to search in them.
+func changedFiles(repoPath, base, ref string) ([]string, error) {
+	mergeBase, err := runGitCmd(repoPath, "merge-base", base, ref)
+	if err != nil {
+		return nil, fmt.Errorf("no merge-base with %s: %v", base, err)
+	}
+	out, err := runGitCmd(repoPath, "diff", "--name-only", "-z", "--diff-filter=d", mergeBase, ref)
+	if err != nil {
+		return nil, fmt.Errorf("git diff against the merge-base with %s failed: %v", base, err)
+	}
+	files := []string{}
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// enginePaths returns the --changed-since files the engine can be limited to
+// directly. Engine globs and --sparse directories cannot be combined with an
+// explicit file list, and a huge list would overflow the command line; the
+// matches are then filtered by keepChangedFiles alone.
+func (o *Options) enginePaths() []string {
+	if len(o.changedFiles) == 0 || len(o.changedFiles) > grepFilesPerRun {
+		return nil
+	}
+	if len(o.IncludeGlobs) > 0 || len(o.ExcludeGlobs) > 0 || len(o.SparsePaths) > 0 {
+		return nil
+	}
+	return o.changedFiles
+}
+
+// literalPathspecs turns file names into pathspecs that git matches verbatim.
+func literalPathspecs(files []string) []string {
+	specs := make([]string, len(files))
+	for i, f := range files {
+		specs[i] = ":(literal)" + f
+	}
+	return specs
+}
+
+// keepChangedFiles removes the matches outside files. Matches in a submodule
+// are kept when the submodule's pinned commit changed; commit message matches
+// have no file and are always kept.
+func keepChangedFiles(files []string, matches []Match) []Match {
+	changed := make(map[string]bool, len(files))
+	for _, f := range files {
+		changed[f] = true
+	}
+	var kept []Match
+	for _, m := range matches {
+		if m.File == "" || inChangedFile(changed, strings.TrimPrefix(m.File, "./")) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func inChangedFile(changed map[string]bool, file string) bool {
+	for {
+		if changed[file] {
+			return true
+		}
+		i := strings.LastIndex(file, "/")
+		if i < 0 {
+			return false
+		}
+		file = file[:i]
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpoint records the branches a run has already completed so that an
+// interrupted run can be resumed with the same --checkpoint file.
+type checkpoint struct {
+	path string
+
+	Regex     string                        `json:"regex"`
+	Completed map[string]map[string][]Match `json:"completed"` // repo path -> branch -> matches
+}
+
+// loadCheckpoint reads the checkpoint at path, or starts an empty one if the
+// file does not exist yet.
+func loadCheckpoint(path, regex string) (*checkpoint, error) {
+	cp := &checkpoint{path: path, Regex: regex, Completed: map[string]map[string][]Match{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %v", path, err)
+	}
+	if cp.Regex != regex {
+		return nil, fmt.Errorf("checkpoint %s was created for pattern %q, not %q", path, cp.Regex, regex)
+	}
+	if cp.Completed == nil {
+		cp.Completed = map[string]map[string][]Match{}
+	}
+	return cp, nil
+}
+
+// done returns the recorded matches of branch and whether it was completed.
+func (cp *checkpoint) done(repoPath, branch string) ([]Match, bool) {
+	if cp == nil {
+		return nil, false
+	}
+	matches, ok := cp.Completed[repoPath][branch]
+	return matches, ok
+}
+
+// record marks branch as completed and persists the checkpoint atomically.
+func (cp *checkpoint) record(repoPath, branch string, matches []Match) error {
+	if cp == nil {
+		return nil
+	}
+	if cp.Completed[repoPath] == nil {
+		cp.Completed[repoPath] = map[string][]Match{}
+	}
+	if matches == nil {
+		matches = []Match{}
+	}
+	cp.Completed[repoPath][branch] = matches
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cp.path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	return os.Rename(tmp.Name(), cp.path)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// searchCommitMessages returns the commits reachable from ref whose message
+// matches the search pattern, committed after the --since-tag tag if set.
+// Each match carries the commit SHA and subject.
+func searchCommitMessages(repoPath string, opts *Options, ref string) ([]Match, error) {
+	args := []string{"log", ref, opts.matcherFlag(), "--format=%H %s"}
+	if opts.sinceTime > 0 {
+		args = append(args, fmt.Sprintf("--since=@%d", opts.sinceTime+1))
+	}
+	if opts.ignoreCase() {
+		args = append(args, "--regexp-ignore-case")
+	}
+	for _, p := range opts.Patterns {
+		args = append(args, "--grep="+p)
+	}
+	out, err := opts.runGit(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v", err)
+	}
+	var matches []Match
+	for _, line := range strings.Split(out, "\n") {
+		sha, subject, ok := strings.Cut(line, " ")
+		if !ok || sha == "" {
+			continue
+		}
+		matches = append(matches, Match{Commit: sha, Text: subject})
+	}
+	return matches, nil
+}
+
+// searchNotes returns the git notes whose text matches the search pattern,
+// one match per matching note line, attributed to the annotated commit.
+func searchNotes(repoPath string, opts *Options) ([]Match, error) {
+	out, err := runGitCmd(repoPath, "notes", "list")
+	if err != nil {
+		// No notes ref yet
+		return nil, nil
+	}
+	var matches []Match
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		noteBlob, commit := fields[0], fields[1]
+		text, err := runGitCmd(repoPath, "cat-file", "-p", noteBlob)
+		if err != nil {
+			continue
+		}
+		for i, l := range strings.Split(text, "\n") {
+			if l = trimLineEnding(l); opts.re.MatchString(l) {
+				matches = append(matches, Match{Commit: commit, Line: i + 1, Text: l})
+			}
+		}
+	}
+	return matches, nil
+}
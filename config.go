@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+)
+
+// configMetaFlags are the flags about the configuration itself, which are
+// neither dumped nor read from a --config file.
+var configMetaFlags = []string{"config", "dump-config", "help", "version"}
+
+// applyConfigFile sets the flags listed in the --config file that are not
+// already set on the command line or through their environment variable. The
+// file is a JSON object mapping flag names to a string, number, boolean or
+// (for repeatable flags) array of strings, as written by --dump-config.
+func applyConfigFile(c *cli.Context) error {
+	path := c.String("config")
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read --config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("invalid --config %s: %v", path, err)
+	}
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if containsString(configMetaFlags, name) || !hasFlag(c, name) {
+			return fmt.Errorf("invalid --config %s: unknown flag %q", path, name)
+		}
+		if c.IsSet(name) {
+			continue
+		}
+		values, ok := configValues(config[name])
+		if !ok {
+			return fmt.Errorf("invalid --config %s: unsupported value for %q", path, name)
+		}
+		for _, v := range values {
+			if err := c.Set(name, v); err != nil {
+				return fmt.Errorf("invalid --config %s: %s: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasFlag reports whether the app has a flag called name.
+func hasFlag(c *cli.Context, name string) bool {
+	for _, f := range c.App.Flags {
+		for _, n := range f.Names() {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configValues returns v as the strings to set a flag to.
+func configValues(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true
+	case bool:
+		return []string{strconv.FormatBool(v)}, true
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, true
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, s)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// dumpConfig writes the value of every flag set on the command line, through
+// its environment variable or by --config, as a JSON object that --config
+// reads back. Flags left at their default are left out: some defaults depend
+// on whether other flags are set, and an explicit value would change them.
+func dumpConfig(w io.Writer, c *cli.Context) error {
+	config := make(map[string]interface{})
+	for _, f := range c.App.Flags {
+		name := f.Names()[0]
+		if containsString(configMetaFlags, name) || !c.IsSet(name) {
+			continue
+		}
+		switch f.(type) {
+		case *cli.BoolFlag:
+			config[name] = c.Bool(name)
+		case *cli.IntFlag:
+			config[name] = c.Int(name)
+		case *cli.Uint64Flag:
+			config[name] = c.Uint64(name)
+		case *cli.DurationFlag:
+			config[name] = c.Duration(name).String()
+		case *cli.StringFlag:
+			config[name] = c.String(name)
+		case *cli.StringSliceFlag:
+			config[name] = c.StringSlice(name)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(config)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// confirmedRepos remembers the repositories the user already agreed to stash
+// and check out, so that --watch asks only once.
+var confirmedRepos = map[string]bool{}
+
+// defaultBranch returns the branch <remote>/HEAD points to, falling back to a
+// local main or master, or "" if none is found.
+func defaultBranch(repoPath string) string {
+	if ref, err := runGitCmd(repoPath, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+remoteName+"/HEAD"); err == nil {
+		return strings.TrimPrefix(ref, remoteName+"/")
+	}
+	for _, b := range []string{"main", "master"} {
+		if _, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+b); err == nil {
+			return b
+		}
+	}
+	return ""
+}
+
+// uncommittedOnDefault returns the number of uncommitted changes of repoPath
+// when currentBranch is its default branch, or 0.
+func uncommittedOnDefault(repoPath, currentBranch string) int {
+	if currentBranch != defaultBranch(repoPath) {
+		return 0
+	}
+	status, _ := runGitCmd(repoPath, "status", "--porcelain")
+	if status == "" {
+		return 0
+	}
+	return len(strings.Split(status, "\n"))
+}
+
+// confirmCheckout asks before the checkout strategy stashes uncommitted work
+// on the default branch, the most dangerous place to lose it. --yes skips the
+// question; without a terminal to ask on, --yes is required.
+func confirmCheckout(opts *Options, repoPath, currentBranch string) error {
+	if opts.Yes || confirmedRepos[repoPath] {
+		return nil
+	}
+	changes := uncommittedOnDefault(repoPath, currentBranch)
+	if changes == 0 {
+		return nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return fmt.Errorf("%s is the default branch and has %d uncommitted changes; pass --yes to stash them and check out other branches, or use --checkout-strategy worktree", currentBranch, changes)
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  %s is the default branch and has %d uncommitted changes.\n", currentBranch, changes)
+	fmt.Fprintf(os.Stderr, "   They will be stashed while other branches are checked out. Continue? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		confirmedRepos[repoPath] = true
+		return nil
+	}
+	return fmt.Errorf("aborted: nothing was stashed or checked out")
+}
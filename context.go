@@ -0,0 +1,209 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// contextEntry is a line of engine output with --context: a match, or a
+// context line printed as `file-line-text` around one.
+type contextEntry struct {
+	file  string
+	line  int
+	text  string
+	match int // index into the matches, or -1 for context lines
+}
+
+// contextReading is one way to read a `file-line-text` context line.
+type contextReading struct {
+	file string
+	line int
+	text string
+}
+
+// contextReadings returns every way raw reads as a `file-line-text` context
+// line, as printed by rg, grep and git grep with -C: a file name may contain
+// -N- itself, so each dash followed by a line number and another dash may be
+// the one ending it. NUL-separated lines (grep -Z `file\0line-text`, git
+// grep -z `file\0line\0text`) have a single reading.
+func contextReadings(raw string) []contextReading {
+	if file, rest, ok := strings.Cut(raw, "\x00"); ok {
+		line, sep, text, ok := splitLineNumber(rest)
+		if !ok || sep == ':' {
+			return nil
+		}
+		return []contextReading{{file: normalizePath(file), line: line, text: trimLineEnding(text)}}
+	}
+	var readings []contextReading
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '-' {
+			continue
+		}
+		j := i + 1
+		for j < len(raw) && raw[j] >= '0' && raw[j] <= '9' {
+			j++
+		}
+		if j == i+1 || j == len(raw) || raw[j] != '-' {
+			continue
+		}
+		if line, err := strconv.Atoi(raw[i+1 : j]); err == nil {
+			readings = append(readings, contextReading{file: normalizePath(raw[:i]), line: line, text: trimLineEnding(raw[j+1:])})
+		}
+	}
+	return readings
+}
+
+// contextLine is a line of a group of engine output, not yet told apart.
+type contextLine struct {
+	m        Match
+	isMatch  bool
+	readings []contextReading
+}
+
+// parseWithContext parses engine output lines with parse. With --context,
+// --before or --after, the context lines (and neighbouring matching lines)
+// within before lines ahead of a match and after lines behind it are attached
+// to it as BeforeContext and AfterContext; prefix is
+// stripped from context lines first, like the ref git grep prints before
+// file names.
+//
+// The engines separate groups of lines with a line such as "--", and every
+// group is a single file. File names may make a line read both as a match
+// and as a context line, as with a-1-b or c:2:d, so each group is settled in
+// two steps: a line is a match unless re, the pattern the engine searched
+// for, does not match its text or does match it as a context line (context
+// lines are the ones the pattern does not match); then the context lines are
+// read as lines of the group's file.
+func parseWithContext(lines []string, before, after int, prefix string, re *regexp.Regexp, parse func(string) (Match, bool)) []Match {
+	var matches []Match
+	if before <= 0 && after <= 0 {
+		for _, line := range lines {
+			if m, ok := parse(line); ok {
+				matches = append(matches, m)
+			}
+		}
+		return matches
+	}
+
+	var group []contextLine
+	flush := func() {
+		matches = append(matches, settleContextGroup(group, before, after, re)...)
+		group = nil
+	}
+	for _, line := range lines {
+		m, isMatch := parse(line)
+		var readings []contextReading
+		if rest, ok := strings.CutPrefix(line, prefix); ok && !m.Binary {
+			readings = contextReadings(rest)
+		}
+		switch {
+		case isMatch && m.Binary:
+			flush()
+			matches = append(matches, m)
+		case isMatch || len(readings) > 0:
+			group = append(group, contextLine{m: m, isMatch: isMatch, readings: readings})
+		default:
+			// A separator such as --, or a message
+			flush()
+		}
+	}
+	flush()
+	return matches
+}
+
+// settleContextGroup tells the matches and context lines of one group apart
+// and returns the matches with their context attached.
+func settleContextGroup(group []contextLine, before, after int, re *regexp.Regexp) []Match {
+	matchesText := func(text string) bool { return re == nil || re.MatchString(text) }
+	var file string
+	undecided := make([]bool, len(group))
+	for i := range group {
+		l := &group[i]
+		if !l.isMatch {
+			continue
+		}
+		if len(l.readings) > 0 {
+			switch {
+			case !matchesText(l.m.Text):
+				l.isMatch = false
+			case allReadingsMatch(l.readings, re):
+			default:
+				undecided[i] = true
+				continue
+			}
+		}
+		if l.isMatch && file == "" {
+			file = normalizePath(l.m.File)
+		}
+	}
+	for i := range group {
+		if !undecided[i] {
+			continue
+		}
+		l := &group[i]
+		l.isMatch = file == "" || normalizePath(l.m.File) == file
+		if l.isMatch && file == "" {
+			file = normalizePath(l.m.File)
+		}
+	}
+
+	var matches []Match
+	var entries []contextEntry
+	for _, l := range group {
+		if l.isMatch {
+			entries = append(entries, contextEntry{file: normalizePath(l.m.File), line: l.m.Line, text: l.m.Text, match: len(matches)})
+			matches = append(matches, l.m)
+			continue
+		}
+		for _, r := range l.readings {
+			if r.file == file {
+				entries = append(entries, contextEntry{file: r.file, line: r.line, text: r.text, match: -1})
+				break
+			}
+		}
+	}
+
+	attachContext(entries, matches, before, after)
+	return matches
+}
+
+// attachContext attaches to each match of entries the lines of its file within
+// before lines ahead of it and after lines behind it, as long as they follow
+// each other in the engine output.
+func attachContext(entries []contextEntry, matches []Match, before, after int) {
+	for i, e := range entries {
+		if e.match < 0 {
+			continue
+		}
+		m := &matches[e.match]
+		for j := i - 1; j >= 0; j-- {
+			prev := entries[j]
+			if prev.file != e.file || prev.line >= e.line || prev.line < e.line-before {
+				break
+			}
+			m.BeforeContext = append([]string{prev.text}, m.BeforeContext...)
+		}
+		for j := i + 1; j < len(entries); j++ {
+			next := entries[j]
+			if next.file != e.file || next.line <= e.line || next.line > e.line+after {
+				break
+			}
+			m.AfterContext = append(m.AfterContext, next.text)
+		}
+	}
+}
+
+// allReadingsMatch reports whether re matches the text of every context
+// reading of a line, which makes it a match rather than a context line.
+func allReadingsMatch(readings []contextReading, re *regexp.Regexp) bool {
+	if re == nil {
+		return false
+	}
+	for _, r := range readings {
+		if !re.MatchString(r.text) {
+			return false
+		}
+	}
+	return true
+}
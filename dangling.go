@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// searchDangling searches objects that are unreachable from any ref, which
+// includes commits that only survive in the reflog (amended or reset away)
+// and blobs that were staged but never committed.
+//
+// Commits are searched with git grep. Loose blobs have no path, so their
+// lines are matched in Go and reported with a `blob:<sha>` file name.
+func searchDangling(opts *Options, repoPath, repoName string, res *Result) error {
+	statusln("\n🕵️  Searching unreachable objects (best-effort, this may be slow)...")
+	out, err := runGitCmd(repoPath, "fsck", "--unreachable", "--no-reflogs", "--no-progress")
+	if err != nil {
+		return fmt.Errorf("git fsck failed: %v", err)
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "unreachable" {
+			continue
+		}
+		kind, sha := fields[1], fields[2]
+		label := "dangling:" + sha[:7]
+
+		var matches []Match
+		switch kind {
+		case "commit":
+			args := []string{"grep", "-n", "-z", opts.matcherFlag()}
+			if opts.ignoreCase() {
+				args = append(args, "-i")
+			}
+			args = append(args, opts.engineArgs()...)
+			grepOut, _ := runGitCmd(repoPath, append(args, sha)...)
+			for _, raw := range strings.Split(grepOut, "\n") {
+				if m, ok := parseRefMatch(raw, sha); ok {
+					matches = append(matches, m)
+				}
+			}
+		case "blob":
+			content, err := runGitCmd(repoPath, "cat-file", "-p", sha)
+			if err != nil {
+				continue
+			}
+			for i, text := range strings.Split(content, "\n") {
+				if text = trimLineEnding(text); opts.re.MatchString(text) {
+					matches = append(matches, Match{File: "blob:" + sha[:7], Line: i + 1, Text: text})
+				}
+			}
+		default:
+			continue
+		}
+
+		for i := range matches {
+			matches[i].Repo = repoName
+			matches[i].Branch = label
+		}
+		matches = filterNotMatching(opts, matches)
+		matches = filterLineRange(opts, matches)
+		matches = filterLineLength(opts, matches)
+		tagRules(opts, matches)
+		matches = res.limitTotal(opts.MatchLimitTotal, matches)
+		res.addBranch(repoName, label, matches)
+		if len(matches) > 0 {
+			statusf("✅ Found %d matches in unreachable %s %s\n", len(matches), kind, branchColor(sha[:7]))
+			emitMatches(opts, res, matches)
+		}
+		if res.Summary.Stopped {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader matches the header of a unified diff hunk and captures the start
+// and optional length of its new side.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// diffHunk is a single hunk of a unified diff.
+type diffHunk struct {
+	start, length int
+	lines         []string
+}
+
+// overlaps reports whether line of the new file lies within the hunk.
+func (h diffHunk) overlaps(line int) bool {
+	return line >= h.start && line < h.start+max(h.length, 1)
+}
+
+// parseHunks splits unified diff output into its hunks, dropping the file
+// headers before the first one.
+func parseHunks(diff string) []diffHunk {
+	var hunks []diffHunk
+	for _, line := range strings.Split(diff, "\n") {
+		if sub := hunkHeader.FindStringSubmatch(line); sub != nil {
+			h := diffHunk{length: 1}
+			h.start, _ = strconv.Atoi(sub[1])
+			if sub[2] != "" {
+				h.length, _ = strconv.Atoi(sub[2])
+			}
+			hunks = append(hunks, h)
+		}
+		if len(hunks) > 0 {
+			hunks[len(hunks)-1].lines = append(hunks[len(hunks)-1].lines, line)
+		}
+	}
+	return hunks
+}
+
+// printMatchDiffs writes, for every file with matches, the hunks of
+// `git diff base ref -- file` that contain a matching line. Files whose
+// matching lines are unchanged relative to base print nothing.
+func printMatchDiffs(w io.Writer, repoPath, base, ref string, matches []Match) {
+	var files []string
+	lines := make(map[string][]int)
+	for _, m := range matches {
+		if m.File == "" || m.Commit != "" || m.Binary {
+			continue
+		}
+		file := strings.TrimPrefix(m.File, "./")
+		if _, ok := lines[file]; !ok {
+			files = append(files, file)
+		}
+		lines[file] = append(lines[file], m.Line)
+	}
+
+	for _, file := range files {
+		out, err := runGitCmd(repoPath, "diff", "--no-color", base, ref, "--", file)
+		if err != nil || out == "" {
+			continue
+		}
+		var kept []diffHunk
+		for _, h := range parseHunks(out) {
+			for _, l := range lines[file] {
+				if h.overlaps(l) {
+					kept = append(kept, h)
+					break
+				}
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", headerColor(fmt.Sprintf("diff %s..%s -- %s", base, ref, file)))
+		for _, h := range kept {
+			for _, l := range h.lines {
+				fmt.Fprintln(w, l)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+func doctorCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "Check prerequisites (git, ripgrep, repository state) without searching",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "repo",
+				Usage: "Path to the git repository to check. Repeatable.",
+				Value: cli.NewStringSlice("."),
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return runDoctor(c.StringSlice("repo"))
+		},
+	}
+}
+
+func runDoctor(repos []string) error {
+	problems := 0
+
+	if !commandExists("git") {
+		fmt.Println("❌ git: not found in PATH")
+		return fmt.Errorf("git is required but was not found in PATH")
+	}
+	gitVersion, _ := runGitCmd(".", "--version")
+	fmt.Printf("✅ git: %s\n", gitVersion)
+
+	if commandExists("rg") {
+		fmt.Printf("✅ rg: %s\n", commandVersion("rg"))
+	} else {
+		fmt.Println("⚠️  rg: not found in PATH (grep fallback will be used, globs only match file names)")
+	}
+	fmt.Printf("🔧 Engine: %s\n", selectedEngine())
+
+	for _, r := range repos {
+		fmt.Println()
+		repoPath, err := filepath.Abs(r)
+		if err != nil {
+			fmt.Printf("❌ Repository %s: invalid path: %v\n", r, err)
+			problems++
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(repoPath, ".git")); os.IsNotExist(err) {
+			fmt.Printf("❌ Repository %s: not a git repository\n", repoPath)
+			problems++
+			continue
+		}
+		fmt.Printf("✅ Repository: %s\n", repoPath)
+
+		head, err := runGitCmd(repoPath, "rev-parse", "--abbrev-ref", "HEAD")
+		switch {
+		case err != nil:
+			fmt.Printf("❌ Current branch: %v\n", err)
+			problems++
+		case head == "HEAD":
+			fmt.Println("⚠️  Detached HEAD: the original position cannot be restored by branch name")
+		default:
+			fmt.Printf("✅ Current branch: %s\n", head)
+		}
+
+		status, _ := runGitCmd(repoPath, "status", "--porcelain")
+		if status != "" {
+			fmt.Printf("⚠️  Working tree is dirty (%d changed paths); changes will be stashed during a search\n",
+				len(strings.Split(status, "\n")))
+		} else {
+			fmt.Println("✅ Working tree is clean")
+		}
+	}
+
+	fmt.Println()
+	if problems > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", problems)
+	}
+	fmt.Println("✨ All checks passed!")
+	return nil
+}
+
+// commandVersion returns the first line of `<cmd> --version`.
+func commandVersion(cmd string) string {
+	out, err := exec.Command(cmd, "--version").Output()
+	if err != nil {
+		return "unknown version"
+	}
+	return strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+}
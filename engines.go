@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+)
+
+func enginesCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "engines",
+		Aliases: []string{"list-engines"},
+		Usage:   "List the available search engines and which capabilities each one supports",
+		Action: func(c *cli.Context) error {
+			return runEngines()
+		},
+	}
+}
+
+// engineInfo describes a search engine and what it supports.
+type engineInfo struct {
+	name      string
+	available bool
+	version   string
+	// capabilities maps a capability name to whether the engine supports it.
+	capabilities map[string]bool
+}
+
+// engineCapabilities lists the capabilities shown by the engines command, in order.
+var engineCapabilities = []string{"pcre2", "multiline", "column", "type filters", "globs"}
+
+func probeEngines() []engineInfo {
+	rg := engineInfo{name: "rg", available: commandExists("rg")}
+	if rg.available {
+		rg.version = commandVersion("rg")
+		rg.capabilities = map[string]bool{
+			// ripgrep may be built without PCRE2, in which case this exits non-zero
+			"pcre2":        exec.Command("rg", "--pcre2-version").Run() == nil,
+			"multiline":    true,
+			"column":       true,
+			"type filters": true,
+			"globs":        true,
+		}
+	}
+
+	grep := engineInfo{name: "grep", available: commandExists("grep")}
+	if grep.available {
+		grep.version = commandVersion("grep")
+		// Patterns are passed as POSIX extended regexes (-E) and globs are
+		// approximated with --include/--exclude; file types are not
+		// translated for grep.
+		grep.capabilities = map[string]bool{
+			"globs": true,
+		}
+	}
+
+	gitGrep := engineInfo{name: "git grep", available: commandExists("git")}
+	if gitGrep.available {
+		gitGrep.version, _ = runGitCmd(".", "--version")
+		gitGrep.capabilities = map[string]bool{
+			"column": true,
+			"globs":  true,
+		}
+	}
+	return []engineInfo{rg, grep, gitGrep}
+}
+
+func runEngines() error {
+	engines := probeEngines()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{headerColor("Capability")}
+	for _, e := range engines {
+		header = append(header, headerColor(e.name))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	row := []string{"available"}
+	for _, e := range engines {
+		row = append(row, yesNo(e.available))
+	}
+	fmt.Fprintln(tw, strings.Join(row, "\t"))
+	for _, capability := range engineCapabilities {
+		row := []string{capability}
+		for _, e := range engines {
+			if !e.available {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, yesNo(e.capabilities[capability]))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	for _, e := range engines {
+		if e.available {
+			fmt.Printf("%s: %s\n", e.name, e.version)
+		}
+	}
+	fmt.Printf("🔧 Engine for checked-out branches: %s (git grep is used with --checkout-strategy none and --tracked-only)\n", selectedEngine())
+	return nil
+}
+
+func yesNo(ok bool) string {
+	if ok {
+		return "yes"
+	}
+	return "no"
+}
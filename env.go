@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// envVarPrefix starts the environment variables that set the flags, e.g.
+// GRS_REGEX for --regex.
+const envVarPrefix = "GRS_"
+
+// flagEnvVar returns the environment variable of the flag name.
+func flagEnvVar(name string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// addFlagEnvVars lets every flag be set from its GRS_ environment variable
+// as well, for CI jobs and containers configured without arguments. A flag on
+// the command line still wins over the variable.
+func addFlagEnvVars(flags []cli.Flag) {
+	for _, f := range flags {
+		switch f := f.(type) {
+		case *cli.BoolFlag:
+			f.EnvVars = append(f.EnvVars, flagEnvVar(f.Name))
+		case *cli.IntFlag:
+			f.EnvVars = append(f.EnvVars, flagEnvVar(f.Name))
+		case *cli.Uint64Flag:
+			f.EnvVars = append(f.EnvVars, flagEnvVar(f.Name))
+		case *cli.DurationFlag:
+			f.EnvVars = append(f.EnvVars, flagEnvVar(f.Name))
+		case *cli.StringFlag:
+			f.EnvVars = append(f.EnvVars, flagEnvVar(f.Name))
+		case *cli.StringSliceFlag:
+			f.EnvVars = append(f.EnvVars, flagEnvVar(f.Name))
+		}
+	}
+}
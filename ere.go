@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// usesERE reports whether grep -E or git grep -E sees the patterns, which
+// read them as POSIX extended regexes rather than as RE2 like the rest of the
+// tool.
+func (o *Options) usesERE() bool {
+	if o.CheckoutStrategy == "none" || o.TrackedOnly || o.SearchSubmodules || o.SearchStash || o.IncludeDangling || o.Prioritize {
+		return true
+	}
+	return containsString(o.searchEngines(), "grep")
+}
+
+// ereEscapes lists the escapes of RE2 and PCRE that POSIX extended regexes do
+// not have (GNU grep does understand \w, \W, \s, \S, \b and \B), with what
+// they mean.
+var ereEscapes = map[byte]string{
+	'd': "digit class", 'D': "non-digit class",
+	'A': "start-of-text anchor", 'z': "end-of-text anchor", 'Z': "end-of-text anchor",
+	'p': "Unicode class", 'P': "Unicode class", 'x': "hex escape", 'Q': "literal quoting",
+	't': "tab escape", 'n': "newline escape", 'r': "carriage return escape", 'f': "form feed escape", 'v': "vertical tab escape",
+}
+
+// ereIssues returns the constructs of p that do not mean the same in POSIX
+// extended regexes as in RE2. Inside a bracket expression a backslash is a
+// literal in ERE, so an escape there matches a backslash and the letter.
+func ereIssues(p string) []string {
+	var issues []string
+	inBracket := false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '\\' && i+1 < len(p):
+			next := p[i+1]
+			switch {
+			case inBracket && (next >= 'a' && next <= 'z' || next >= 'A' && next <= 'Z'):
+				issues = append(issues, fmt.Sprintf("\\%c inside [...] (a literal backslash and %c)", next, next))
+			case !inBracket && ereEscapes[next] != "":
+				issues = append(issues, fmt.Sprintf("\\%c (%s)", next, ereEscapes[next]))
+			}
+			if !inBracket {
+				i++
+			}
+		case c == '[' && !inBracket:
+			inBracket = true
+			// A ] right after [ or [^ is part of the set
+			if i+1 < len(p) && p[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(p) && p[i+1] == ']' {
+				i++
+			}
+			// Skip [:class:] and friends as a whole
+		case c == '[' && inBracket && i+1 < len(p) && strings.ContainsRune(":.=", rune(p[i+1])):
+			if end := strings.Index(p[i+2:], string(p[i+1])+"]"); end >= 0 {
+				i += end + 3
+			}
+		case c == ']' && inBracket:
+			inBracket = false
+		case c == '(' && !inBracket && i+1 < len(p) && p[i+1] == '?':
+			issues = append(issues, "(?...) group or flags")
+		case strings.ContainsRune("*+?}", rune(c)) && !inBracket && i+1 < len(p) && p[i+1] == '?':
+			issues = append(issues, fmt.Sprintf("lazy quantifier %c? (greedy in ERE)", c))
+			i++
+		}
+	}
+	return issues
+}
+
+// ereClasses are the --translate-ere replacements of escapes outside and
+// inside bracket expressions.
+var (
+	ereClasses        = map[byte]string{'d': "[0-9]", 'D': "[^0-9]", 't': "\t"}
+	ereBracketClasses = map[byte]string{'d': "0-9", 's': "[:space:]", 'w': "[:alnum:]_", 't': "\t"}
+)
+
+// translateERE rewrites the common RE2 constructs of p that POSIX extended
+// regexes lack into their ERE equivalents, for --translate-ere: \d, \D and \t,
+// the same escapes inside bracket expressions along with \s and \w, and
+// non-capturing groups (?:...), which become plain groups.
+func translateERE(p string) string {
+	var b strings.Builder
+	inBracket := false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '\\' && i+1 < len(p):
+			classes := ereClasses
+			if inBracket {
+				classes = ereBracketClasses
+			}
+			if r, ok := classes[p[i+1]]; ok {
+				b.WriteString(r)
+				i++
+				continue
+			}
+			if !inBracket {
+				b.WriteByte(c)
+				i++
+				c = p[i]
+			}
+		case c == '[' && !inBracket:
+			inBracket = true
+			b.WriteByte(c)
+			if i+1 < len(p) && p[i+1] == '^' {
+				i++
+				b.WriteByte(p[i])
+			}
+			if i+1 < len(p) && p[i+1] == ']' {
+				i++
+				b.WriteByte(p[i])
+			}
+			continue
+		case c == '[' && inBracket && i+1 < len(p) && strings.ContainsRune(":.=", rune(p[i+1])):
+			if end := strings.Index(p[i+2:], string(p[i+1])+"]"); end >= 0 {
+				b.WriteString(p[i : i+end+4])
+				i += end + 3
+				continue
+			}
+		case c == ']' && inBracket:
+			inBracket = false
+		case c == '(' && !inBracket && strings.HasPrefix(p[i:], "(?:"):
+			b.WriteByte(c)
+			i += 2
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// warnERE warns about the patterns that grep or git grep will read
+// differently from RE2, after --translate-ere when it is set.
+func warnERE(opts *Options) {
+	if !opts.usesERE() || opts.FixedStrings {
+		return
+	}
+	for _, p := range opts.Patterns {
+		if opts.TranslateERE {
+			p = translateERE(p)
+		}
+		issues := ereIssues(p)
+		if len(issues) == 0 {
+			continue
+		}
+		statusf("⚠️  Warning: regex %q uses %s, which grep -E and git grep -E (POSIX ERE) do not understand the same way.\n", p, strings.Join(issues, ", "))
+		if opts.TranslateERE {
+			statusln("   Matches found by grep or git grep may be wrong; use --engine rg with a checked-out strategy to be sure.")
+		} else {
+			statusln("   Matches found by grep or git grep may be wrong; pass --translate-ere to rewrite \\d and similar classes, or use --engine rg.")
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// explainRun describes in plain words what a search with opts would do,
+// without touching any repository.
+func explainRun(w io.Writer, opts *Options) {
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, "  • "+format+"\n", args...)
+	}
+
+	fmt.Fprintln(w, "This run would:")
+	if opts.Patch != "" {
+		line("search only the lines added by the patch %s, without running git", opts.Patch)
+	} else if opts.WorkingDiff {
+		line("search only the lines the staged and unstaged changes of %s add, without touching any branch (--working-diff)", strings.Join(opts.Repos, ", "))
+	} else {
+		line("search %d repository(ies): %s", len(opts.Repos), strings.Join(opts.Repos, ", "))
+	}
+	line("look for %s", opts.patternLabel())
+	if opts.FixedStrings {
+		line("read the patterns as literal strings, not regexes (--fixed-strings)")
+	}
+	if opts.TranslateERE && opts.usesERE() {
+		line("rewrite \\d, \\t and (?:...) in the patterns passed to grep -E and git grep -E (--translate-ere)")
+	}
+	for _, r := range opts.Rules {
+		line("tag matches of %s as rule %s (%s)", r.Pattern, r.Name, r.Severity)
+	}
+	switch {
+	case opts.IgnoreCase:
+		line("ignore case (--ignore-case)")
+	case opts.ignoreCase():
+		line("ignore case (--smart-case and the pattern is all lowercase)")
+	}
+
+	switch {
+	case len(opts.RefGlobs) > 0:
+		line("search every ref matching %s", strings.Join(opts.RefGlobs, ", "))
+	case len(opts.Branches) > 0:
+		line("search the branches %s", strings.Join(opts.Branches, ", "))
+	default:
+		var sources []string
+		if opts.SearchRemote {
+			sources = append(sources, "remote branch")
+		}
+		if opts.SearchLocal {
+			sources = append(sources, "local branch")
+		}
+		if opts.SearchTags {
+			sources = append(sources, "tag")
+		}
+		line("search every %s", strings.Join(sources, ", every "))
+		if opts.SearchLocal || opts.SearchTags {
+			line("search refs that point to the same commit only once")
+		}
+	}
+	if opts.AllowEmptyBranches {
+		line("only warn if fewer than %d branch(es) resolve", opts.MinBranches)
+	} else if opts.MinBranches > 0 {
+		line("abort if fewer than %d branch(es) resolve", opts.MinBranches)
+	}
+	if opts.StrictBranches {
+		line("abort if any of the --branches does not exist (--strict-branches)")
+	}
+	if len(opts.ExcludeBranches) > 0 {
+		line("skip branches matching %s", strings.Join(opts.ExcludeBranches, ", "))
+	}
+	if opts.BranchFilter != "" {
+		line("only search branches whose names match %s", opts.BranchFilter)
+	}
+	if opts.BranchExclude != "" {
+		line("skip branches whose names match %s", opts.BranchExclude)
+	}
+	if !opts.NoIgnoreBranches {
+		line("skip branches listed in %s, if the repository has one", branchIgnoreFile)
+	}
+	if opts.NewerThan != "" {
+		line("skip branches that do not contain %s", opts.NewerThan)
+	}
+	if opts.SinceTag != "" {
+		line("skip branches not updated since the commit date of tag %s", opts.SinceTag)
+	}
+	switch {
+	case opts.SinceLastRun && opts.ResetLastRun:
+		line("forget the previous run, search every branch and record this run (--since-last-run --reset-last-run)")
+	case opts.SinceLastRun:
+		line("skip branches not updated since the previous --since-last-run search, and record this run in the git directory")
+	case opts.ResetLastRun:
+		line("forget the previous --since-last-run search (--reset-last-run)")
+	}
+	if opts.ChangedSince != "" {
+		line("search only the files each branch added or modified since its merge-base with %s", opts.ChangedSince)
+	}
+	if opts.BranchSort != "" {
+		line("list the branches in git for-each-ref --sort=%s order", opts.BranchSort)
+	}
+	if opts.Prioritize {
+		line("pre-scan the branches and search those with the most matches first")
+	}
+
+	if opts.ReadOnly {
+		line("never fetch and refuse every git command that could modify the repository (--read-only)")
+	} else if opts.Offline {
+		line("never fetch or update branches; search the refs as they are cached locally (--offline)")
+	} else if !opts.SearchWorktrees {
+		line("run git fetch --all in each repository")
+		if opts.Deepen > 0 {
+			line("⚠️  in shallow clones, fetch %d more commits of every searched branch (--deepen); the history stays in the repository", opts.Deepen)
+		}
+	}
+	switch {
+	case opts.SearchWorktrees:
+		line("search each existing worktree as it is checked out; nothing is stashed, checked out or fetched")
+	case opts.CheckoutStrategy == "none":
+		line("search the branch refs directly with git grep; nothing is checked out or stashed")
+	case opts.CheckoutStrategy == "worktree":
+		line("check out each branch in a temporary worktree, leaving your checkout untouched")
+	default:
+		line("⚠️  stash your uncommitted changes (including untracked files), then check out every branch in your working tree")
+		if !opts.Yes {
+			line("ask first if you are on the default branch with uncommitted changes (--yes skips the question)")
+		}
+		switch opts.PullStrategy {
+		case "none":
+			line("search the local branches as they are, without updating them from %s (--pull-strategy none)", opts.RemoteName)
+		case "reset":
+			line("⚠️  fast-forward branches behind %s, and reset diverged ones to it, dropping their local commits (--pull-strategy reset)", opts.RemoteName)
+		case "skip":
+			line("fast-forward branches behind %s, and skip diverged ones (--pull-strategy skip)", opts.RemoteName)
+		default:
+			line("fast-forward branches behind %s, and search diverged ones as they are", opts.RemoteName)
+		}
+		switch opts.RestoreStrategy {
+		case "none":
+			line("⚠️  leave the repository on the last searched branch with your changes stashed (--restore-strategy none)")
+		case "branch-only":
+			line("⚠️  switch back to your branch but leave your changes stashed (--restore-strategy branch-only)")
+		default:
+			line("switch back to your branch and pop the stash at the end")
+		}
+		if opts.ForceCheckout {
+			line("⚠️  discard local modifications with git reset --hard whenever a checkout fails (--force-checkout)")
+		}
+		if opts.NoRestoreOnError {
+			line("leave the repository as it is if the search fails, printing how to restore it (--no-restore-on-error)")
+		}
+		if opts.HealthCheck {
+			line("fail if HEAD or git status differ from before the run once the repository was restored (--health-check)")
+		}
+		if opts.BatchSize > 0 {
+			line("every %d branches, return to your branch and stop unless it is clean (--batch-size)", opts.BatchSize)
+		}
+		if len(opts.SparsePaths) > 0 {
+			line("limit the checkout to %s with sparse-checkout and restore the previous setup afterwards", strings.Join(opts.SparsePaths, ", "))
+		}
+	}
+
+	switch {
+	case opts.CheckoutStrategy == "none" || opts.TrackedOnly:
+		line("use git grep as the engine, so only tracked files are searched")
+	case len(opts.searchEngines()) > 1:
+		line("run %s and merge their matches by file and line", strings.Join(opts.searchEngines(), " and "))
+	case opts.searchEngines()[0] == "rg":
+		line("use ripgrep as the engine, %s", workingSetLabel(opts))
+	case opts.Engine == "grep":
+		line("use grep as the engine, %s", workingSetLabel(opts))
+	default:
+		line("use grep as the engine (ripgrep was not found), %s", workingSetLabel(opts))
+	}
+	if opts.FollowSymlinks {
+		line("follow symbolic links into the files and directories they point to (rg -L, grep -R)")
+	}
+	switch opts.NewlineHandling {
+	case "crlf":
+		line("treat \\r\\n as a line ending too, so $ matches before it")
+	case "multiline":
+		line("let patterns match newlines and span several lines (rg --multiline)")
+	}
+	if opts.CompareEngines {
+		line("exit with status 1 if the engines do not match exactly the same lines")
+	}
+	if opts.StrictRegex {
+		if engines := strictEngines(opts); len(engines) > 0 {
+			line("check the patterns with %s first and fail with the engine's error if one rejects them (--strict-regex)", strings.Join(engines, ", "))
+		}
+	}
+	if opts.EngineVersionGuard != "" {
+		line("fail before searching unless ripgrep %s or newer is installed", opts.EngineVersionGuard)
+	}
+	if len(opts.RgArgs) > 0 {
+		line("pass %s to ripgrep unchecked", strings.Join(opts.RgArgs, " "))
+	}
+	if len(opts.GrepArgs) > 0 {
+		line("pass %s to grep unchecked", strings.Join(opts.GrepArgs, " "))
+	}
+	if len(opts.IncludeGlobs) > 0 || len(opts.ExcludeGlobs) > 0 {
+		globs := append(append([]string(nil), opts.IncludeGlobs...), prefixAll("!", opts.ExcludeGlobs)...)
+		if !containsString(opts.searchEngines(), "rg") && opts.CheckoutStrategy != "none" && !opts.TrackedOnly {
+			line("⚠️  ignore the globs %s because grep does not support them", strings.Join(globs, ", "))
+		} else {
+			line("only search files matching the globs %s", strings.Join(globs, ", "))
+		}
+	}
+
+	var globBranches []string
+	for branch := range opts.BranchGlobs {
+		globBranches = append(globBranches, branch)
+	}
+	sort.Strings(globBranches)
+	for _, branch := range globBranches {
+		line("use only the globs %s on branch %s", strings.Join(opts.BranchGlobs[branch], ", "), branch)
+	}
+
+	var extra []string
+	if opts.SearchCommits {
+		extra = append(extra, "commit messages")
+	}
+	if opts.SearchNotes {
+		extra = append(extra, "git notes")
+	}
+	if opts.SearchStash {
+		extra = append(extra, "stash entries")
+	}
+	if opts.SearchSubmodules {
+		extra = append(extra, "submodules")
+	}
+	if opts.IncludeDangling {
+		extra = append(extra, "unreachable objects")
+	}
+	if len(extra) > 0 {
+		line("also search %s", strings.Join(extra, ", "))
+	}
+	if opts.Author != "" || opts.Committer != "" {
+		line("keep only lines whose author/committer matches (one git blame per matched file)")
+	}
+	if opts.ContextLines > 0 {
+		line("record %d lines of context before and %d after each match", opts.BeforeLines, opts.AfterLines)
+	}
+	if opts.CountOccurrences {
+		line("count every match within the matching lines, not just the lines (--count-occurrences)")
+	}
+	if opts.CountUniqueFiles {
+		line("count the distinct files that matched on any branch (--count-unique-files)")
+	}
+	if opts.Blame {
+		line("show the commit, author and date that last changed each matched line")
+	}
+	switch {
+	case opts.MinLineLength > 0 && opts.MaxLineLength > 0:
+		line("drop matches on lines shorter than %d or longer than %d characters", opts.MinLineLength, opts.MaxLineLength)
+	case opts.MaxLineLength > 0:
+		line("drop matches on lines longer than %d characters", opts.MaxLineLength)
+	case opts.MinLineLength > 0:
+		line("drop matches on lines shorter than %d characters", opts.MinLineLength)
+	}
+	if opts.LineRange != "" {
+		line("only keep matches on lines %s of each file", opts.LineRange)
+	}
+	if opts.NotMatching != "" {
+		line("drop matched lines that also match %s", opts.NotMatching)
+	}
+	if opts.Sample > 0 {
+		line("print a random sample of %d matches at the end instead of every match", opts.Sample)
+	}
+	if opts.searchesHistory() {
+		flag := "-S (commits that change how often the pattern occurs)"
+		if opts.Pickaxe == "diff" {
+			flag = "-G (commits adding or removing a matching line)"
+		}
+		window := ""
+		if opts.HistorySince != "" {
+			window += " since " + opts.HistorySince
+		}
+		if opts.HistoryUntil != "" {
+			window += " until " + opts.HistoryUntil
+		}
+		line("search the history of each branch%s with git log %s instead of its files, without checking anything out", window, flag)
+	}
+	if opts.Aggregate {
+		line("print each distinct file:line:text match once at the end, followed by the branches it was found on (--aggregate)")
+	}
+	if opts.MaxPerBranch > 0 {
+		line("print at most %d matches per branch, still counting all of them", opts.MaxPerBranch)
+	}
+	if opts.MaxPerFile > 0 {
+		line("show at most %d matching lines per file on each branch", opts.MaxPerFile)
+	}
+	if opts.SkipAssumeUnchanged {
+		line("leave out files marked assume-unchanged or skip-worktree")
+	}
+	if opts.DedupeText {
+		line("report each distinct matched text only once per branch")
+	}
+	if opts.MinMatches > 0 {
+		line("only report branches with at least %d matches", opts.MinMatches)
+	}
+	if opts.FirstMatch {
+		line("stop at the first match")
+	}
+	if opts.MatchLimitTotal > 0 {
+		line("stop after %d matches in total", opts.MatchLimitTotal)
+	}
+	if opts.PreCommand != "" {
+		line("run %q in the checked-out tree before searching each branch", opts.PreCommand)
+	}
+	if opts.PostCommand != "" {
+		line("run %q once after the search, and fail if it fails", opts.PostCommand)
+	}
+	if opts.OnMatchExec != "" {
+		line("run %q once per match (up to %d at a time)", opts.OnMatchExec, opts.OnMatchJobs)
+	}
+
+	if opts.BranchTimeout > 0 {
+		line("give up on any branch that takes longer than %s and continue with the next", opts.BranchTimeout)
+	}
+	if opts.PatternTimeout > 0 {
+		line("skip a branch whose engine run takes longer than %s, reporting suspected catastrophic backtracking", opts.PatternTimeout)
+	}
+	if opts.InteractiveReview {
+		line("ask after every branch whether to continue, stop or re-run it (--interactive-confirm-per-branch)")
+	}
+	if opts.NormalizeBranches {
+		line("search a branch listed under a local and a remote name at the same commit once, as the %s name (--normalize-branch-names)", opts.PreferBranchName)
+	}
+	if opts.MatchAsYouGo {
+		line("print every match as soon as the engine reports it (--match-as-you-go)")
+	}
+	if opts.MaxBranchesParallel > 1 {
+		line("search up to %d branches at once, printing them in branch order", opts.MaxBranchesParallel)
+		if opts.MaxWorktrees > 0 {
+			line("keep at most %d temporary worktrees at once (--max-worktrees)", opts.MaxWorktrees)
+		}
+		if opts.ConcurrencyOrder == "by-size" {
+			line("start the branches with the fewest files first (--concurrency-order by-size)")
+		}
+	}
+	if opts.CacheDir != "" {
+		line("reuse the cached results in %s for branches whose tip commit is unchanged", opts.CacheDir)
+	}
+	if opts.WebhookURL != "" {
+		line("post the results as a Slack message to --webhook-url instead of printing them")
+	} else {
+		line("print results as %s", opts.OutputFormat)
+	}
+	if opts.OutputDir != "" {
+		line("also write one file per branch to %s", opts.OutputDir)
+	}
+	if opts.Watch {
+		line("keep running and search again whenever the refs change")
+	}
+	if opts.MaxRuntime > 0 {
+		line("stop after %s, finish the current branch, report partial results and exit with status 3", opts.MaxRuntime)
+	}
+	if opts.MaxOutputBytes > 0 {
+		line("stop once %d bytes of matches were printed and exit with status 4", opts.MaxOutputBytes)
+	}
+	if opts.FailOnSeverity != "" {
+		line("exit with status 5 if a rule of severity %s or higher matched", opts.FailOnSeverity)
+	}
+	line("exit with status 0 when something matched, 1 when nothing did and 2 on errors, like grep")
+}
+
+// prefixAll returns list with prefix prepended to every element.
+func prefixAll(prefix string, list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = prefix + s
+	}
+	return out
+}
+
+// workingSetLabel describes the files rg and grep search.
+func workingSetLabel(opts *Options) string {
+	if opts.IncludeIgnored {
+		return "including untracked, ignored and hidden files"
+	}
+	return "including untracked files but skipping those excluded by .gitignore"
+}
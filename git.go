@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// verboseGit echoes git's own stderr output when --verbose is set. By default
+// it is captured and only surfaced as part of the error of a failed command.
+var verboseGit = false
+
+// readOnlyGit makes runGitCmd refuse every git command that could modify the
+// repository (--read-only).
+var readOnlyGit = false
+
+// readOnlyGitCommands lists the git subcommands allowed in --read-only mode.
+// Subcommands that can also write are only allowed with their listing forms.
+var readOnlyGitCommands = map[string]func(args []string) bool{
+	"--version":    func([]string) bool { return true },
+	"blame":        func([]string) bool { return true },
+	"cat-file":     func([]string) bool { return true },
+	"config":       func(args []string) bool { return len(args) == 3 && args[1] == "--bool" },
+	"diff":         func([]string) bool { return true },
+	"for-each-ref": func([]string) bool { return true },
+	"fsck":         func([]string) bool { return true },
+	"grep":         func([]string) bool { return true },
+	"log":          func([]string) bool { return true },
+	"ls-files":     func([]string) bool { return true },
+	"ls-tree":      func([]string) bool { return true },
+	"merge-base":   func([]string) bool { return true },
+	"rev-parse":    func([]string) bool { return true },
+	"show":         func([]string) bool { return true },
+	"status":       func([]string) bool { return true },
+	"branch":       func(args []string) bool { return len(args) == 2 && args[1] == "-r" },
+	"notes":        func(args []string) bool { return len(args) == 2 && args[1] == "list" },
+	"remote":       func(args []string) bool { return len(args) == 1 },
+	"stash":        func(args []string) bool { return len(args) >= 2 && args[1] == "list" },
+	"submodule":    func(args []string) bool { return len(args) == 2 && args[1] == "status" },
+	"worktree":     func(args []string) bool { return len(args) >= 2 && args[1] == "list" },
+}
+
+// errReadOnly is returned for git commands blocked by --read-only.
+var errReadOnly = errors.New("refusing to run a git command that may modify the repository (--read-only)")
+
+// allowedInReadOnly reports whether git args only reads from the repository.
+func allowedInReadOnly(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	allowed, ok := readOnlyGitCommands[args[0]]
+	return ok && allowed(args)
+}
+
+// gitError is returned by runGitCmd when git exits unsuccessfully.
+type gitError struct {
+	args   []string
+	stderr string
+	err    error
+}
+
+func (e *gitError) Error() string {
+	if e.stderr != "" {
+		return e.stderr
+	}
+	return fmt.Sprintf("git %s: %v", strings.Join(e.args, " "), e.err)
+}
+
+func (e *gitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the process exit code carried by err, or -1 if err does not
+// come from a process that exited.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// runGitCmd runs git in repoPath and returns its trimmed stdout. Stderr is kept
+// separate so that progress and informational messages never end up in the
+// parsed output; it is reported through the returned error instead.
+func runGitCmd(repoPath string, args ...string) (string, error) {
+	return runGitCmdContext(context.Background(), repoPath, args...)
+}
+
+// runGitCmdContext is runGitCmd killing git once ctx is done, for the
+// commands that make up a branch search under --branch-timeout.
+func runGitCmdContext(ctx context.Context, repoPath string, args ...string) (string, error) {
+	if readOnlyGit && !allowedInReadOnly(args) {
+		err := fmt.Errorf("git %s: %w", strings.Join(args, " "), errReadOnly)
+		gitTrace.record(repoPath, args, time.Now(), 0, 0, err)
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repoPath
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	start := time.Now()
+	err := cmd.Run()
+	gitTrace.record(repoPath, args, start, out.Len(), errOut.Len(), err)
+	if verboseGit && errOut.Len() > 0 {
+		fmt.Fprintf(os.Stderr, "git %s: %s\n", strings.Join(args, " "), strings.TrimSpace(errOut.String()))
+	}
+	if err != nil {
+		return strings.TrimSpace(out.String()), &gitError{args: args, stderr: strings.TrimSpace(errOut.String()), err: err}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
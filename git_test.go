@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+// runApp runs the command line application with args in-process and returns
+// what it printed to stdout, without the status lines. Exit statuses are
+// returned as errors instead of ending the test binary.
+func runApp(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	defer func(w io.Writer) { statusWriter = w }(statusWriter)
+	statusWriter = io.Discard
+	var err error
+	out := captureStdout(t, func() {
+		app := newApp()
+		app.ExitErrHandler = func(*cli.Context, error) {}
+		err = app.Run(append([]string{"git-regex-search"}, args...))
+	})
+	return out, err
+}
+
+func TestAllowedInReadOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{name: "git grep", args: []string{"grep", "-n", "-I", "-E", "TODO", "origin/main"}, want: true},
+		{name: "rev-parse", args: []string{"rev-parse", "--verify", "--quiet", "main^{commit}"}, want: true},
+		{name: "for-each-ref", args: []string{"for-each-ref", "--format=%(refname)", "refs/heads"}, want: true},
+		{name: "list remote branches", args: []string{"branch", "-r"}, want: true},
+		{name: "list stashes", args: []string{"stash", "list"}, want: true},
+		{name: "list remotes", args: []string{"remote"}, want: true},
+		{name: "checkout", args: []string{"checkout", "--quiet", "develop"}},
+		{name: "pull", args: []string{"pull", "--ff-only"}},
+		{name: "fetch", args: []string{"fetch", "--all", "--quiet"}},
+		{name: "stash push", args: []string{"stash", "push", "--include-untracked"}},
+		{name: "stash pop", args: []string{"stash", "pop"}},
+		{name: "reset", args: []string{"reset", "--hard"}},
+		{name: "delete a branch", args: []string{"branch", "-D", "develop"}},
+		{name: "add a note", args: []string{"notes", "add", "-m", "x"}},
+		{name: "add a remote", args: []string{"remote", "add", "upstream", "https://example.com/x.git"}},
+		{name: "remove a remote", args: []string{"remote", "remove", "origin"}},
+		{name: "gc", args: []string{"gc"}},
+		{name: "no command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowedInReadOnly(tt.args); got != tt.want {
+				t.Errorf("allowedInReadOnly(%q) = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// repoState describes everything a write command could change: the checked
+// out branch, the working tree, the refs, the stashes and the reflog.
+func repoState(t *testing.T, repo string) string {
+	t.Helper()
+	var state []string
+	for _, args := range [][]string{
+		{"rev-parse", "--abbrev-ref", "HEAD"},
+		{"status", "--porcelain"},
+		{"for-each-ref", "--format=%(refname) %(objectname)"},
+		{"stash", "list"},
+		{"reflog", "--all"},
+	} {
+		state = append(state, gitfixture.Git(t, repo, args...))
+	}
+	return strings.Join(state, "\n")
+}
+
+func TestReadOnlyRunLeavesRepositoryAlone(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	// Uncommitted changes a checkout run would stash
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("edited TODO\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before := repoState(t, repo)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "branches"},
+		{name: "git grep strategy asked for", args: []string{"--checkout-strategy", "none"}},
+		{name: "commit messages and stashes", args: []string{"--search-commits", "--search-stash"}},
+		{name: "author filter", args: []string{"--author", "Fixture"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--repo", repo, "--regex", "TODO", "--read-only", "--output-format", "summary"}, tt.args...)
+			out, err := runApp(t, args...)
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if !strings.Contains(out, `"total_matches": 3`) {
+				t.Errorf("want 3 matches, got:\n%s", out)
+			}
+			if after := repoState(t, repo); after != before {
+				t.Errorf("repository changed:\n%s\nwant:\n%s", after, before)
+			}
+			if _, err := os.Stat(filepath.Join(repo, ".git", "worktrees")); !os.IsNotExist(err) {
+				t.Errorf("a worktree was added")
+			}
+		})
+	}
+}
+
+func TestRunGitCmdRefusesWritesInReadOnly(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	defer func(readOnly bool) { readOnlyGit = readOnly }(readOnlyGit)
+	readOnlyGit = true
+
+	if _, err := runGitCmd(repo, "checkout", "--quiet", "develop"); !errors.Is(err, errReadOnly) {
+		t.Fatalf("git checkout: err = %v, want %v", err, errReadOnly)
+	}
+	if branch, err := runGitCmd(repo, "rev-parse", "--abbrev-ref", "HEAD"); err != nil || branch != "main" {
+		t.Errorf("current branch = %q, %v, want main", branch, err)
+	}
+}
+
+func TestTraceRecordsReadOnlyCommands(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	trace := filepath.Join(t.TempDir(), "trace.jsonl")
+	if _, err := runApp(t, "--repo", repo, "--regex", "TODO", "--read-only", "--output-format", "summary", "--trace", trace); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	f, err := os.Open(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var greps int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec traceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("%v: %q", err, scanner.Text())
+		}
+		if rec.Dir != repo || rec.Time == "" {
+			t.Errorf("record %+v lacks the directory or time", rec)
+		}
+		if !allowedInReadOnly(rec.Args) {
+			t.Errorf("git %q ran in a read-only run", rec.Args)
+		}
+		if len(rec.Args) > 0 && rec.Args[0] == "grep" {
+			greps++
+		}
+	}
+	if greps != 2 {
+		t.Errorf("traced %d git grep commands, want one per branch", greps)
+	}
+}
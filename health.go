@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkRepoHealth returns repoPath to currentBranch between batches of
+// --batch-size and verifies that it is where a checkout-based search expects
+// it to be: on that branch (at originalHead when it was detached) with a
+// clean working tree. The problems found are reported with the state of the
+// repository, so the run can stop before drift produces wrong results.
+func checkRepoHealth(opts *Options, repoPath, currentBranch, originalHead string, searched int) error {
+	statusf("\n🩺 Returning to %s to check the repository after %d branches (--batch-size)...\n", branchColor(currentBranch), searched)
+	var problems []string
+	if err := checkoutBranch(opts, repoPath, currentBranch); err != nil {
+		problems = append(problems, err.Error())
+	}
+	branch, err := runGitCmd(repoPath, "rev-parse", "--abbrev-ref", "HEAD")
+	head, _ := runGitCmd(repoPath, "rev-parse", "HEAD")
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("HEAD does not resolve: %v", err))
+	case branch != currentBranch:
+		problems = append(problems, fmt.Sprintf("HEAD is on %s instead of %s", branch, currentBranch))
+	case currentBranch == "HEAD" && head != originalHead:
+		problems = append(problems, fmt.Sprintf("HEAD is at %s instead of %s", shortSHA(head), shortSHA(originalHead)))
+	}
+	status, err := runGitCmd(repoPath, "status", "--porcelain", "--untracked-files=all")
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("git status failed: %v", err))
+	case status != "":
+		lines := strings.Split(status, "\n")
+		problems = append(problems, fmt.Sprintf("the working tree is not clean (%d changed paths)", len(lines)))
+		for i, l := range lines {
+			if i == 10 {
+				problems = append(problems, fmt.Sprintf("   ... and %d more", len(lines)-i))
+				break
+			}
+			problems = append(problems, "   "+l)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	statusln("🚨 Repository health check failed:")
+	for _, p := range problems {
+		statusf("   %s\n", p)
+	}
+	statusf("   HEAD: %s (%s)\n", branch, shortSHA(head))
+	statusln("   The repository was left as it is and your changes are still stashed.")
+	statusf("   Inspect it, then restore manually with: git checkout %s && git stash pop\n", currentBranch)
+	return fmt.Errorf("repository health check failed after %d branches (--batch-size); stopping to avoid wrong results", searched)
+}
+
+// repoSnapshot is the state of a repository that --health-check expects a
+// run to leave unchanged.
+type repoSnapshot struct {
+	branch string
+	head   string
+	status []string
+}
+
+// takeSnapshot records the branch, HEAD commit and working tree status of
+// repoPath.
+func takeSnapshot(repoPath string) (repoSnapshot, error) {
+	var s repoSnapshot
+	var err error
+	if s.branch, err = runGitCmd(repoPath, "rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+		return s, fmt.Errorf("--health-check: HEAD does not resolve: %v", err)
+	}
+	s.head, _ = runGitCmd(repoPath, "rev-parse", "HEAD")
+	status, err := runGitCmd(repoPath, "status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return s, fmt.Errorf("--health-check: git status failed: %v", err)
+	}
+	if status != "" {
+		s.status = strings.Split(status, "\n")
+	}
+	return s, nil
+}
+
+// verifyRestored compares the state of repoPath after the run with before
+// (--health-check) and fails with the differences, so that a failed stash
+// pop or lost files do not go unnoticed.
+func verifyRestored(repoPath string, before repoSnapshot) error {
+	after, err := takeSnapshot(repoPath)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	if after.branch != before.branch {
+		problems = append(problems, fmt.Sprintf("HEAD is on %s instead of %s", after.branch, before.branch))
+	} else if after.head != before.head {
+		problems = append(problems, fmt.Sprintf("HEAD is at %s instead of %s", shortSHA(after.head), shortSHA(before.head)))
+	}
+	// "-" lines were in the status before the run only, "+" lines after it only
+	was := make(map[string]bool, len(before.status))
+	for _, l := range before.status {
+		was[l] = true
+	}
+	is := make(map[string]bool, len(after.status))
+	for _, l := range after.status {
+		is[l] = true
+	}
+	var diff []string
+	for _, l := range before.status {
+		if !is[l] {
+			diff = append(diff, "-"+l)
+		}
+	}
+	for _, l := range after.status {
+		if !was[l] {
+			diff = append(diff, "+"+l)
+		}
+	}
+	if len(diff) > 0 {
+		problems = append(problems, "the working tree differs from before the run (git status --porcelain):")
+		for _, l := range diff {
+			problems = append(problems, "   "+l)
+		}
+	}
+	if len(problems) == 0 {
+		statusln("🩺 Repository restored to its state before the run (--health-check)")
+		return nil
+	}
+
+	statusln("🚨 Repository health check failed, the run did not restore the repository:")
+	for _, p := range problems {
+		statusf("   %s\n", p)
+	}
+	if ref := tempStashRef(repoPath); ref != "" {
+		statusf("   Your changes are still in %s; restore them with: git checkout %s && git stash pop %s\n", ref, before.branch, ref)
+	}
+	return fmt.Errorf("repository health check failed for %s: it was not restored to its state before the run", repoPath)
+}
+
+// tempStashRef returns the stash@{N} name of the stash a checkout-based
+// search made of the user's changes, or "" if there is none.
+func tempStashRef(repoPath string) string {
+	out, err := runGitCmd(repoPath, "stash", "list", "--format=%gd%x00%gs")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if ref, subject, ok := strings.Cut(line, "\x00"); ok && strings.HasSuffix(subject, ": "+tempStashMessage) {
+			return ref
+		}
+	}
+	return ""
+}
+
+// reportUnrestored describes the state a failed checkout-based search left
+// the repository in with --no-restore-on-error, and how to restore it by hand.
+func reportUnrestored(opts *Options, repoPath, currentBranch string, cause error) {
+	statusln()
+	statusf("🛑 Search failed, leaving the repository as it is (--no-restore-on-error): %v\n", cause)
+	if branch, err := runGitCmd(repoPath, "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+		head, _ := runGitCmd(repoPath, "rev-parse", "--short", "HEAD")
+		statusf("   Checked out: %s at %s (was %s)\n", branch, head, currentBranch)
+	}
+	if status, err := runGitCmd(repoPath, "status", "--porcelain", "--untracked-files=all"); err == nil && status != "" {
+		statusf("   Working tree has %d changed files (git status)\n", len(strings.Split(status, "\n")))
+	}
+	ref := tempStashRef(repoPath)
+	if ref != "" {
+		statusf("   Your changes are stashed in %s (%s)\n", ref, tempStashMessage)
+	}
+
+	statusln("   Restore manually with:")
+	if len(opts.SparsePaths) > 0 {
+		statusln("     git sparse-checkout disable    (or set your previous patterns again)")
+	}
+	statusf("     git checkout %s\n", currentBranch)
+	if ref != "" {
+		statusf("     git stash pop %s\n", ref)
+	}
+}
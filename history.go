@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pickaxeModes lists the accepted values of --pickaxe: count runs git log -S,
+// which lists the commits that change how often the pattern occurs, and diff
+// runs git log -G, which lists those with an added or removed line matching it.
+var pickaxeModes = []string{"count", "diff"}
+
+// searchesHistory reports whether the commits that introduced or removed the
+// pattern are searched instead of the contents of the branches.
+func (o *Options) searchesHistory() bool {
+	return o.HistorySince != "" || o.HistoryUntil != "" || o.Pickaxe != ""
+}
+
+// pickaxePattern returns the patterns as the single extended regex git log -S
+// and -G take.
+func (o *Options) pickaxePattern() string {
+	var alternatives []string
+	for _, p := range o.Patterns {
+		switch {
+		case o.FixedStrings:
+			p = regexp.QuoteMeta(p)
+		case o.TranslateERE:
+			p = translateERE(p)
+		}
+		alternatives = append(alternatives, p)
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return "(" + strings.Join(alternatives, ")|(") + ")"
+}
+
+// searchPickaxe returns the commits of ref within --since/--until whose
+// changes add or remove the pattern, newest first, as matches carrying the
+// commit, its author and date and its subject.
+func searchPickaxe(repoPath string, opts *Options, ref string) ([]Match, error) {
+	args := []string{"log", ref, "--date=short", "--format=%H%x00%an%x00%ad%x00%s"}
+	if opts.HistorySince != "" {
+		args = append(args, "--since="+opts.HistorySince)
+	}
+	if opts.HistoryUntil != "" {
+		args = append(args, "--until="+opts.HistoryUntil)
+	}
+	if opts.ignoreCase() {
+		args = append(args, "--regexp-ignore-case")
+	}
+	if opts.Pickaxe == "diff" {
+		args = append(args, "-G"+opts.pickaxePattern())
+	} else {
+		args = append(args, "--pickaxe-regex", "-S"+opts.pickaxePattern())
+	}
+	out, err := opts.runGit(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v", err)
+	}
+	var matches []Match
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		matches = append(matches, Match{Commit: fields[0], Author: fields[1], Date: fields[2], Text: fields[3]})
+	}
+	return matches, nil
+}
+
+// searchHistory searches the history of every branch with git log -S or -G
+// (--pickaxe) rather than its files, so that the commits that introduced or
+// removed the pattern in a date window are reported. Nothing is checked out
+// or stashed.
+func searchHistory(opts *Options, repoPath, repoName string, res *Result) error {
+	fetchRemotes(opts, repoPath)
+
+	branches, err := listBranches(opts, repoPath)
+	if err != nil {
+		return err
+	}
+	window := "all history"
+	switch {
+	case opts.HistorySince != "" && opts.HistoryUntil != "":
+		window = fmt.Sprintf("%s to %s", opts.HistorySince, opts.HistoryUntil)
+	case opts.HistorySince != "":
+		window = "since " + opts.HistorySince
+	case opts.HistoryUntil != "":
+		window = "until " + opts.HistoryUntil
+	}
+	statusf("📜 Searching the history of %d branches (%s)...\n", len(branches), window)
+
+	for _, branch := range branches {
+		label := branchLabel(opts, repoPath, branch)
+		statusf("\n🔍 Searching branch: %s\n", branchColor(branch))
+		ref := branch
+		if !strings.HasPrefix(branch, "refs/") {
+			ref = branchRef(repoPath, branch)
+		}
+		matches, err := searchPickaxe(repoPath, opts, ref)
+		if err != nil {
+			return fmt.Errorf("history search failed on branch %s: %v", branch, err)
+		}
+		for i := range matches {
+			matches[i].Repo = repoName
+			matches[i].Branch = label
+		}
+		matches = res.limitTotal(opts.MatchLimitTotal, matches)
+		res.addBranch(repoName, label, matches)
+		if len(matches) > 0 {
+			statusf("✅ Found %d commits in %s\n", len(matches), branchColor(branch))
+			emitMatches(opts, res, matches)
+		}
+		if res.Summary.Stopped {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Package gitfixture builds throwaway git repositories for tests. A fixture is
+// a clone of a local "origin" repository holding the requested branches, so
+// that git branch -r, fetch and pull behave as in a real checkout.
+package gitfixture
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Branch is a branch of the fixture and the files committed on it, by path
+// relative to the repository root. A branch starts from the first branch
+// given, so files it does not mention are inherited from there.
+type Branch struct {
+	Name  string
+	Files map[string]string
+}
+
+// env isolates the fixture's git commands from the user's configuration and
+// makes the commits reproducible.
+var env = []string{
+	"GIT_CONFIG_NOSYSTEM=1",
+	"GIT_CONFIG_GLOBAL=" + os.DevNull,
+	"GIT_AUTHOR_NAME=Fixture",
+	"GIT_AUTHOR_EMAIL=fixture@example.com",
+	"GIT_AUTHOR_DATE=2024-01-01T00:00:00Z",
+	"GIT_COMMITTER_NAME=Fixture",
+	"GIT_COMMITTER_EMAIL=fixture@example.com",
+	"GIT_COMMITTER_DATE=2024-01-01T00:00:00Z",
+}
+
+// Git runs git in dir and returns its trimmed output, failing tb on error.
+func Git(tb testing.TB, dir string, args ...string) string {
+	tb.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		tb.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// New creates the fixture in a temporary directory removed after the test and
+// returns the path of the clone, checked out at the first branch.
+func New(tb testing.TB, branches ...Branch) string {
+	tb.Helper()
+	if len(branches) == 0 {
+		tb.Fatal("gitfixture: at least one branch is required")
+	}
+	root := tb.TempDir()
+	origin := filepath.Join(root, "origin")
+	if err := os.Mkdir(origin, 0o755); err != nil {
+		tb.Fatal(err)
+	}
+	Git(tb, origin, "init", "--quiet", "--initial-branch", branches[0].Name)
+
+	for i, b := range branches {
+		if i > 0 {
+			Git(tb, origin, "checkout", "--quiet", "-b", b.Name, branches[0].Name)
+		}
+		Commit(tb, origin, "add files on "+b.Name, b.Files)
+	}
+	Git(tb, origin, "checkout", "--quiet", branches[0].Name)
+
+	clone := filepath.Join(root, "clone")
+	Git(tb, root, "clone", "--quiet", origin, clone)
+	return clone
+}
+
+// Commit writes files into the repository at dir and commits them on the
+// current branch.
+func Commit(tb testing.TB, dir, message string, files map[string]string) {
+	tb.Helper()
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(files[p]), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	Git(tb, dir, "add", "--all")
+	Git(tb, dir, "commit", "--quiet", "--allow-empty", "-m", message)
+}
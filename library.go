@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// builtinSecrets is the pattern library of --builtin-secrets, in the
+// name:severity:regex form of --rule. The patterns stick to the syntax shared
+// by rg, grep -E and git grep -E.
+var builtinSecrets = []string{
+	"aws-access-key-id:high:(A3T[A-Z0-9]|AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16}",
+	"private-key:critical:-----BEGIN ([A-Z]+ )?PRIVATE KEY-----",
+	"github-token:high:gh[pousr]_[A-Za-z0-9]{36}",
+	"slack-token:high:xox[abprs]-[A-Za-z0-9-]{10,}",
+	"google-api-key:high:AIza[0-9A-Za-z_-]{35}",
+	"stripe-secret-key:high:[rs]k_live_[0-9A-Za-z]{24,}",
+	"jwt:medium:eyJ[A-Za-z0-9_-]{10,}\\.eyJ[A-Za-z0-9_-]{10,}\\.[A-Za-z0-9_-]{10,}",
+	`password-assignment:medium:[Pp][Aa][Ss][Ss][Ww][Oo][Rr][Dd][[:space:]]*[:=][[:space:]]*["'][^"'[:space:]]{6,}["']`,
+}
+
+// patternLibrary maps the names of reusable rules to them.
+type patternLibrary map[string]rule
+
+// loadPatternLibrary returns the built-in secret patterns, overridden by and
+// extended with the rules of the --pattern-library file at path if it is set.
+// The file holds one name:severity:regex rule per line; blank lines and lines
+// starting with # are skipped.
+func loadPatternLibrary(path string) (patternLibrary, error) {
+	lib := make(patternLibrary)
+	for _, spec := range builtinSecrets {
+		r, err := parseRule(spec)
+		if err != nil {
+			panic(err)
+		}
+		lib[r.Name] = r
+	}
+	if path == "" {
+		return lib, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --pattern-library: %v", err)
+	}
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		lib[r.Name] = r
+	}
+	return lib, nil
+}
+
+// names returns the names of the rules in the library, sorted.
+func (lib patternLibrary) names() []string {
+	names := make([]string, 0, len(lib))
+	for name := range lib {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// libraryRules returns the rules picked with --rule-from-library and, with
+// --builtin-secrets, every built-in secret pattern, each rule once.
+func libraryRules(lib patternLibrary, names []string, builtins bool) ([]rule, error) {
+	if builtins {
+		for _, spec := range builtinSecrets {
+			names = append(names, spec[:strings.Index(spec, ":")])
+		}
+	}
+	seen := make(map[string]bool)
+	var rules []rule
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		r, ok := lib[name]
+		if !ok {
+			return nil, fmt.Errorf("no pattern named %q in the pattern library (available: %s)", name, strings.Join(lib.names(), ", "))
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// localOnlyFiles returns the files of the index of repoPath marked
+// assume-unchanged or skip-worktree, typically local overrides of tracked
+// config (--skip-assume-unchanged). With sparse-checkout, skip-worktree only
+// marks the files left out of the checkout, so only assume-unchanged counts.
+func localOnlyFiles(repoPath string) (map[string]bool, error) {
+	out, err := runGitCmd(repoPath, "ls-files", "-v", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files -v failed: %v", err)
+	}
+	sparse, _ := runGitCmd(repoPath, "config", "--bool", "core.sparseCheckout")
+	files := make(map[string]bool)
+	for _, entry := range strings.Split(out, "\x00") {
+		// "<tag> <path>": a lowercase tag is assume-unchanged, S is skip-worktree
+		tag, file, ok := strings.Cut(entry, " ")
+		if !ok || len(tag) != 1 {
+			continue
+		}
+		assumeUnchanged := tag[0] >= 'a' && tag[0] <= 'z'
+		if assumeUnchanged || (tag == "S" && sparse != "true") {
+			files[file] = true
+		}
+	}
+	return files, nil
+}
+
+// dropLocalOnly removes the matches in files marked assume-unchanged or
+// skip-worktree.
+func dropLocalOnly(files map[string]bool, matches []Match) []Match {
+	if len(files) == 0 {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		if m.File == "" || !files[strings.TrimPrefix(path.Clean(m.File), "./")] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lockFileName = "git-regex-search.lock"
+
+// lockPollInterval is how often a held lock is retried with --wait.
+const lockPollInterval = 500 * time.Millisecond
+
+// acquireRepoLock creates an advisory lock file in the repository's git
+// directory so that two runs cannot stash and check out branches in the same
+// working tree at once. The returned function releases the lock.
+func acquireRepoLock(repoPath string, wait bool) (func(), error) {
+	gitDir, err := runGitCmd(repoPath, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git directory: %v", err)
+	}
+	lockPath := filepath.Join(gitDir, lockFileName)
+
+	announced := false
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			_ = f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file %s: %v", lockPath, err)
+		}
+
+		owner, _ := os.ReadFile(lockPath)
+		if !wait {
+			return nil, fmt.Errorf("another git-regex-search run (pid %s) holds %s; use --wait to wait for it, or remove the file if that run is no longer alive",
+				strings.TrimSpace(string(owner)), lockPath)
+		}
+		if !announced {
+			statusf("⏳ Waiting for another run (pid %s) to release %s...\n", strings.TrimSpace(string(owner)), lockPath)
+			announced = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
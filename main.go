@@ -1,86 +1,40 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
-	"strings"
+	"time"
 
-	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 )
 
 // version is injected at build time via -ldflags "-X main.version=<version>"
 var version = "dev"
 
-func runGitCmd(repoPath string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = repoPath
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	err := cmd.Run()
-	return strings.TrimSpace(out.String()), err
-}
-
-func commandExists(cmd string) bool {
-	_, err := exec.LookPath(cmd)
-	return err == nil
-}
-
-func grepRepo(repoPath, pattern string, includeGlobs, excludeGlobs []string) ([]string, error) {
-	var cmd *exec.Cmd
-	if commandExists("rg") {
-		args := []string{"-n", "-uu", "--pcre2"}
-		for _, g := range includeGlobs {
-			if strings.TrimSpace(g) == "" {
-				continue
-			}
-			args = append(args, "--glob", g)
-		}
-		for _, g := range excludeGlobs {
-			if strings.TrimSpace(g) == "" {
-				continue
-			}
-			args = append(args, "--glob", "!"+g)
-		}
-		args = append(args, pattern)
-		cmd = exec.Command("rg", args...)
-	} else {
-		cmd = exec.Command("grep", "-rnE", pattern, ".")
-	}
-
-	cmd.Dir = repoPath
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	err := cmd.Run()
-
-	if err != nil && out.Len() == 0 {
-		// Both rg and grep return non-zero if no matches are found
-		return nil, nil
+func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		// Like grep: 1 is kept for a search that found nothing
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
 	}
-	return strings.Split(strings.TrimSpace(out.String()), "\n"), nil
 }
 
-func main() {
+// newApp returns the command line application, with its flags and commands.
+func newApp() *cli.App {
 	app := &cli.App{
 		Name:    "git-regex-search",
 		Usage:   "Search for regex matches across branches in a git repository",
 		Version: version,
+		// Regexes and globs routinely contain commas, so slice flags are never split on them
+		DisableSliceFlagSeparator: true,
 		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:     "repo",
-				Usage:    "Path to the git repository",
-				Required: true,
+			&cli.StringSliceFlag{
+				Name:  "repo",
+				Usage: "Path to the git repository (required). Repeatable to search several repositories.",
 			},
-			&cli.StringFlag{
-				Name:     "regex",
-				Usage:    "Regular expression to search for",
-				Required: true,
+			&cli.StringSliceFlag{
+				Name:  "regex",
+				Usage: "Regular expression to search for (required). Repeatable; a line matches if any pattern matches.",
 			},
 			&cli.StringFlag{
 				Name:  "branches",
@@ -88,131 +42,727 @@ func main() {
 			},
 			&cli.StringSliceFlag{
 				Name:  "include-glob",
-				Usage: "Include only files/dirs matching glob (ripgrep only). Repeatable.",
+				Usage: "Include only files/dirs matching glob (approximated with grep --include without ripgrep). Repeatable.",
 			},
 			&cli.StringSliceFlag{
 				Name:  "exclude-glob",
-				Usage: "Exclude files/dirs matching glob (ripgrep only). Repeatable.",
+				Usage: "Exclude files/dirs matching glob (approximated with grep --exclude without ripgrep). Repeatable.",
+			},
+			&cli.StringFlag{
+				Name:  "author",
+				Usage: "Keep only matches whose line was last authored by someone matching this regex (runs git blame per matched file)",
+			},
+			&cli.StringFlag{
+				Name:  "committer",
+				Usage: "Keep only matches whose line was last committed by someone matching this regex (runs git blame per matched file)",
+			},
+			&cli.BoolFlag{
+				Name:  "first-match",
+				Usage: "Stop searching as soon as the first match is found (useful for existence checks)",
+			},
+			&cli.BoolFlag{
+				Name:  "nice",
+				Usage: "Reduce resource usage: run the engine at low priority with a single thread and pause between branches",
+			},
+			&cli.DurationFlag{
+				Name:  "nice-delay",
+				Usage: "Pause between branches in --nice mode",
+				Value: 200 * time.Millisecond,
+			},
+			&cli.IntFlag{
+				Name:  "threads",
+				Usage: "Number of threads ripgrep may use (ripgrep only, 0 = ripgrep default)",
+			},
+			&cli.BoolFlag{
+				Name:  "annotate-new",
+				Usage: "Mark matches that were not present on the previously searched branch as NEW",
+			},
+			&cli.StringFlag{
+				Name:    "output-format",
+				Aliases: []string{"format"},
+				Usage:   "Output format: text, table, count, count-table, summary, xml, junit, html, csv-wide, ndjson-with-summary, diffstat (needs --cache-dir), grep, sarif, yaml, slack, csv or json.",
+				Value:   "text",
+			},
+			&cli.StringFlag{
+				Name:    "newer-than",
+				Aliases: []string{"since-ref"},
+				Usage:   "Search only branches that contain the given commit or tag (branched off at or after it)",
+			},
+			&cli.BoolFlag{
+				Name:  "include-dangling",
+				Usage: "Also search unreachable commits and blobs, e.g. amended-away or reflog-only content (slow, best-effort)",
+			},
+			&cli.StringFlag{
+				Name:  "checkout-strategy",
+				Usage: "How branches are materialized: checkout (stash and check out in place), worktree (temporary worktree) or none (git grep against refs, never touches the working tree)",
+				Value: "checkout",
+			},
+			&cli.BoolFlag{
+				Name:  "no-checkout",
+				Usage: "Search each branch with git grep against its ref without checking it out, stashing or pulling (same as --checkout-strategy none)",
+			},
+			&cli.BoolFlag{
+				Name:  "worktree",
+				Usage: "Check out each branch in a temporary detached worktree that is removed afterwards, leaving your checkout and its changes alone (same as --checkout-strategy worktree)",
+			},
+			&cli.BoolFlag{
+				Name:  "search-commits",
+				Usage: "Also search commit messages on each branch (reported as branch:sha: subject)",
+			},
+			&cli.BoolFlag{
+				Name:  "search-notes",
+				Usage: "Also search git notes (reported under the notes label)",
+			},
+			&cli.BoolFlag{
+				Name:  "wait",
+				Usage: "Wait for another run holding the repository lock instead of failing immediately",
+			},
+			&cli.BoolFlag{
+				Name:    "only-matching",
+				Aliases: []string{"o"},
+				Usage:   "Print only the matched part of each line",
+			},
+			&cli.IntFlag{
+				Name:  "capture-group",
+				Usage: "Print only the given capture group of each match (implies --only-matching)",
+			},
+			&cli.BoolFlag{
+				Name:  "unique",
+				Usage: "With --only-matching, print each extracted value only once across all branches",
+			},
+			&cli.BoolFlag{
+				Name:  "match-branch-names",
+				Usage: "Match the regex against branch names instead of file contents and list the matching branches",
+			},
+			&cli.StringFlag{
+				Name:  "checkpoint",
+				Usage: "Record completed branches in this file and skip them when re-run with the same file",
+			},
+			&cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "Show git's own informational output (suppressed by default)",
+			},
+			&cli.StringFlag{
+				Name:  "restore-strategy",
+				Usage: "End-of-run cleanup in checkout mode: full (restore branch and stash), branch-only (leave changes stashed) or none (stay on the last searched branch)",
+				Value: "full",
+			},
+			&cli.BoolFlag{
+				Name:  "respect-export-ignore",
+				Usage: "Skip files marked export-ignore in the branch's top-level .gitattributes (what git archive would leave out)",
+			},
+			&cli.BoolFlag{
+				Name:    "files-with-matches",
+				Aliases: []string{"l"},
+				Usage:   "Print only the branch and name of each file with matches",
+			},
+			&cli.BoolFlag{
+				Name:  "print0",
+				Usage: "Print NUL-separated branch and file records for xargs -0 (implies --files-with-matches; status goes to stderr)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ref-glob",
+				Usage: "Search every ref matching this for-each-ref pattern (e.g. 'refs/pull/*/head') with git grep. Repeatable.",
+			},
+			&cli.BoolFlag{
+				Name:  "local",
+				Usage: "Search the local branches (git branch), including ones never pushed. Combinable with --remote and --tags",
+			},
+			&cli.BoolFlag{
+				Name:  "remote",
+				Usage: "Search the remote branches (git branch -r); the default when none of --local, --remote and --tags is given",
+			},
+			&cli.BoolFlag{
+				Name:  "tags",
+				Usage: "Search every tag with git grep (implies --checkout-strategy none). Combinable with --local and --remote",
+			},
+			&cli.StringFlag{
+				Name:  "remote-name",
+				Value: "origin",
+				Usage: "Remote whose branches are listed and pulled from, e.g. upstream in a fork workflow",
+			},
+			&cli.BoolFlag{
+				Name:  "summary-json",
+				Usage: "Emit only aggregate counts as a single JSON object (same as --output-format summary)",
+			},
+			&cli.BoolFlag{
+				Name:  "count",
+				Usage: "Print only the number of matches per branch, most first, and the total (same as --output-format count)",
+			},
+			&cli.BoolFlag{
+				Name:  "count-all",
+				Usage: "With --count, also list the branches without matches",
+			},
+			&cli.StringFlag{
+				Name:  "branch-separator",
+				Usage: "Line printed between the matches of consecutive branches (default: a blank line when progress goes to stderr)",
+			},
+			&cli.IntFlag{
+				Name:    "context",
+				Aliases: []string{"C"},
+				Usage:   "Record this many lines before and after each match with it (engine -C), shown in text output and as before_context/after_context in csv and the JSON formats",
+			},
+			&cli.IntFlag{
+				Name:    "before",
+				Aliases: []string{"B"},
+				Usage:   "Record this many lines before each match (engine -B); overrides --context for that side",
+			},
+			&cli.IntFlag{
+				Name:    "after",
+				Aliases: []string{"A"},
+				Usage:   "Record this many lines after each match (engine -A); overrides --context for that side",
+			},
+			&cli.StringFlag{
+				Name:  "context-separator",
+				Usage: "Separator the engine prints between non-adjacent groups of context lines (default: --)",
+			},
+			&cli.BoolFlag{
+				Name:  "search-submodules",
+				Usage: "Also search initialized submodules at the commit each branch pins them to",
+			},
+			&cli.BoolFlag{
+				Name:   "validate-output",
+				Usage:  "Check that JSON output decodes back into the same result before printing it (development aid)",
+				Hidden: true,
+			},
+			&cli.BoolFlag{
+				Name:    "smart-case",
+				Aliases: []string{"S"},
+				Usage:   "Search case-insensitively unless the pattern contains an uppercase letter",
+			},
+			&cli.BoolFlag{
+				Name:    "ignore-case",
+				Aliases: []string{"i"},
+				Usage:   "Search case-insensitively (engine -i); overrides --smart-case and composes with --fixed-strings",
+			},
+			&cli.StringFlag{
+				Name:  "pre-command",
+				Usage: "Shell command run in the checked-out tree before searching each branch, e.g. to generate code",
+			},
+			&cli.BoolFlag{
+				Name:  "ignore-pre-errors",
+				Usage: "Search a branch even if --pre-command failed on it",
+			},
+			&cli.BoolFlag{
+				Name:  "unshallow",
+				Usage: "Fetch the full history first when the repository is a shallow clone",
+			},
+			&cli.IntFlag{
+				Name:  "deepen",
+				Usage: "In a shallow clone, fetch this many more commits of each searched branch (git fetch --deepen) instead of the full history",
+			},
+			&cli.BoolFlag{
+				Name:  "glob-case-insensitive",
+				Usage: "Match --include-glob and --exclude-glob case-insensitively (does not affect the search pattern)",
+			},
+			&cli.BoolFlag{
+				Name:  "tracked-only",
+				Usage: "Search only files tracked by git (uses git grep on the checked-out tree instead of rg/grep)",
+			},
+			&cli.StringFlag{
+				Name:  "color",
+				Usage: "When to colorize output: auto (only when stdout is a terminal and NO_COLOR is unset), always or never",
+				Value: "auto",
+			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "Also write each branch's results to <dir>/<branch>.txt (.json/.xml/.html for those formats) as it is searched",
+			},
+			&cli.StringFlag{
+				Name:  "regex-flags",
+				Usage: "Go regexp flags (i, m, s, U) for the pattern used to validate and highlight matches, e.g. ms; the engine is not affected",
+			},
+			&cli.BoolFlag{
+				Name:  "search-stash",
+				Usage: "Also search every stash entry with git grep (reported as stash@{N})",
+			},
+			&cli.StringFlag{
+				Name:  "on-match-exec",
+				Usage: "Shell command run once per match after the search, with GRS_REPO, GRS_BRANCH, GRS_FILE, GRS_LINE, GRS_TEXT, GRS_COMMIT and GRS_PATTERN set",
+			},
+			&cli.IntFlag{
+				Name:  "on-match-jobs",
+				Usage: "Maximum number of --on-match-exec commands running at once",
+				Value: 4,
+			},
+			&cli.StringSliceFlag{
+				Name:  "sparse",
+				Usage: "In checkout mode, materialize and search only this directory using sparse-checkout. Repeatable.",
+			},
+			&cli.IntFlag{
+				Name:  "match-limit-total",
+				Usage: "Stop the whole search once this many matches were found across all branches and repositories (0 = no limit)",
+			},
+			&cli.StringFlag{
+				Name:    "changed-since",
+				Aliases: []string{"merge-base-scope"},
+				Usage:   "Search only the files each branch added or modified since its merge-base with this revision, skipping inherited code",
+			},
+			&cli.StringFlag{
+				Name:  "show-diff",
+				Usage: "After each branch's matches, show the hunks of git diff <base> <branch> that contain a matching line",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "Do not fetch or update branches: search the refs as they are cached locally (same as --pull-strategy none without the fetch)",
+			},
+			&cli.BoolFlag{
+				Name:  "read-only",
+				Usage: "Guarantee the repository is never modified: skip fetching, search refs with git grep and refuse any mutating git command",
+			},
+			&cli.BoolFlag{
+				Name:  "prioritize",
+				Usage: "Pre-scan all branches with git grep -c and search those with the most matches first",
+			},
+			&cli.StringFlag{
+				Name:  "invalid-utf8",
+				Usage: "How matched lines with invalid UTF-8 are recorded for structured output: sanitize (replace with U+FFFD) or base64 (also keep the raw bytes in text_base64)",
+				Value: "sanitize",
+			},
+			&cli.BoolFlag{
+				Name:  "watch",
+				Usage: "Keep running and search again whenever the repository's refs change (commits, fetches, new branches)",
+			},
+			&cli.DurationFlag{
+				Name:  "watch-interval",
+				Usage: "How often --watch checks the refs for changes",
+				Value: 2 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "watch-fetch-interval",
+				Usage: "How often --watch fetches the remotes to pick up pushed changes (0 = never)",
+				Value: time.Minute,
+			},
+			&cli.BoolFlag{
+				Name:  "explain",
+				Usage: "Describe what the run would do (engine, refs, checkout/stash/fetch, globs, exit status) and exit without searching",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run-destructive-check",
+				Usage: "Inspect each repository and list what a real run would change (stashed files, checked out, created or reset branches, network access), then exit without searching",
+			},
+			&cli.StringSliceFlag{
+				Name:  "rg-args",
+				Usage: "Extra argument passed unchecked to ripgrep, before the patterns. Repeatable, one argument each.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "grep-args",
+				Usage: "Extra argument passed unchecked to the grep fallback, before the patterns. Repeatable, one argument each.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "glob-for",
+				Usage: "Per-branch glob as branch=glob (prefix the glob with ! to exclude); replaces --include-glob/--exclude-glob on that branch. Repeatable.",
+			},
+			&cli.IntFlag{
+				Name:  "min-matches",
+				Usage: "Only report branches with at least this many matches; branches below it count as having none",
+			},
+			&cli.StringFlag{
+				Name:  "not-matching",
+				Usage: "Drop matched lines that also match this regex, e.g. '^\\s*//' to skip comments",
+			},
+			&cli.BoolFlag{
+				Name:  "force-checkout",
+				Usage: "DESTRUCTIVE: when checking out a branch fails, run git reset --hard and check it out with --force",
+			},
+			&cli.StringFlag{
+				Name:  "line-range",
+				Usage: "Only keep matches on lines from:to of each file, e.g. 1:50; either end may be omitted",
+			},
+			&cli.IntFlag{
+				Name:  "min-branches",
+				Usage: "Abort when fewer branches than this resolve, so a typo cannot pass for a clean result",
+				Value: 1,
+			},
+			&cli.BoolFlag{
+				Name:  "allow-empty-branches",
+				Usage: "Only warn instead of aborting when fewer than --min-branches branches resolve",
+			},
+			&cli.BoolFlag{
+				Name:  "strict-branches",
+				Usage: "Abort, listing them, when branches given with --branches do not exist, instead of skipping them with a warning",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-branch",
+				Usage: "Never search branches matching this glob (e.g. 'vendor/*'). Repeatable.",
+			},
+			&cli.StringFlag{
+				Name:  "branch-filter",
+				Usage: "Only search the listed branches whose names match this regex (e.g. '^(main|release/)')",
+			},
+			&cli.StringFlag{
+				Name:  "branch-exclude",
+				Usage: "Skip the listed branches whose names match this regex (e.g. '^(dependabot|renovate)/')",
+			},
+			&cli.BoolFlag{
+				Name:  "no-ignore-branches",
+				Usage: "Ignore the repository's .git-regex-search-ignore file",
+			},
+			&cli.StringSliceFlag{
+				Name:  "rule",
+				Usage: "Search for a named pattern given as name:severity:regex and tag its matches; severity is info, low, medium, high or critical. Repeatable",
+			},
+			&cli.StringFlag{
+				Name:  "pattern-library",
+				Usage: "File of reusable named patterns, one name:severity:regex per line, for --rule-from-library",
+			},
+			&cli.StringSliceFlag{
+				Name:  "rule-from-library",
+				Usage: "Search for the named patterns of --pattern-library or the built-in secret patterns as rules (comma-separated or repeated)",
+			},
+			&cli.BoolFlag{
+				Name:  "builtin-secrets",
+				Usage: "Search for every built-in secret pattern (AWS keys, private keys, tokens...) as a rule",
+			},
+			&cli.StringFlag{
+				Name:  "fail-on-severity",
+				Usage: "Exit with status 5 if a --rule of at least this severity matched",
+			},
+			&cli.BoolFlag{
+				Name:   "exit-status",
+				Usage:  "Kept for compatibility: runs always exit like grep, 0 if anything matched, 1 if the search found nothing, 2 on errors",
+				Hidden: true,
+			},
+			&cli.DurationFlag{
+				Name:  "max-runtime",
+				Usage: "Stop after this long (e.g. 10m), finishing the current branch and reporting partial results; exits with status 3",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-paths",
+				Value: true,
+				Usage: "Print repo-relative paths without the ./ prefix the grep fallback adds, so output is the same for every engine (--normalize-paths=false keeps the engine's paths)",
+			},
+			&cli.StringFlag{
+				Name:  "engine-version-guard",
+				Usage: "Fail before searching unless ripgrep of at least this version (e.g. 13.0.0) is installed",
+			},
+			&cli.StringFlag{
+				Name:  "patch",
+				Usage: "Search the lines added by this unified diff (- for stdin) instead of a repository; git is not used",
+			},
+			&cli.BoolFlag{
+				Name:  "no-pager",
+				Usage: "Do not pipe text output to $PAGER (less -FRX by default) when stdout is a terminal",
+			},
+			&cli.StringFlag{
+				Name:  "engine",
+				Value: "auto",
+				Usage: "Search engine for checked-out trees: auto (rg if installed, else grep), rg, grep, or all to run every installed engine and merge their matches",
+			},
+			&cli.StringFlag{
+				Name:  "regex-file",
+				Usage: "Also search for the regexes listed in this file, one per line (blank lines and # comments are skipped)",
+			},
+			&cli.StringFlag{
+				Name:  "branches-file",
+				Usage: "Also search the branches listed in this file, one per line (# comments allowed), like --branches",
+			},
+			&cli.StringFlag{
+				Name:    "repo-file",
+				Aliases: []string{"repo-from-file"},
+				Usage:   "Also search the repositories listed in this file, one path or clone URL per line (# comments allowed); a failing repository does not stop the others",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet-no-match",
+				Aliases: []string{"only-matching-branches"},
+				Usage:   "Print nothing for branches without matches; the summary still counts them",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Print no progress, status or warning lines, only the results (they go to stderr otherwise)",
+			},
+			&cli.StringFlag{
+				Name:  "post-command",
+				Usage: "Shell command run once after the search, with GRS_TOTAL_MATCHES, GRS_BRANCHES_WITH_MATCHES and other summary counts in its environment; the run fails if it does",
+			},
+			&cli.StringFlag{
+				Name:  "sort-branches",
+				Value: "name",
+				Usage: "Order to search branches in: name, recency (newest tip first) or none (git's order; the default with --branches)",
+			},
+			&cli.StringFlag{
+				Name:  "branch-sort",
+				Usage: "List branches with git for-each-ref --sort=<key> and search them in that order, e.g. -committerdate (newest first), refname or -creatordate",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-branch-names",
+				Usage: "Search a branch listed under a local and a remote name (main and upstream/main, refs/heads/x and refs/remotes/origin/x) only once when both point to the same commit",
+			},
+			&cli.StringFlag{
+				Name:  "prefer-branch-name",
+				Value: "local",
+				Usage: "Name --normalize-branch-names searches and reports such a branch under: local or remote",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-ref-prefix",
+				Usage: "Label matches with the full remote-tracking name (origin/feature/x) instead of the short branch name",
+			},
+			&cli.StringFlag{
+				Name:  "cache-dir",
+				Usage: "Cache each branch's results here, keyed by its tip commit and the search options; unchanged branches are not searched again",
+			},
+			&cli.IntFlag{
+				Name:    "max-branches-parallel",
+				Aliases: []string{"jobs"},
+				Usage:   "Search up to this many branches at once (worktree or none strategy); output still follows branch order",
+			},
+			&cli.StringFlag{
+				Name:    "concurrency-order",
+				Aliases: []string{"branch-concurrency-order"},
+				Value:   "fifo",
+				Usage:   "Order --max-branches-parallel starts branches in: fifo (branch order) or by-size (fewest files first, estimated with git ls-tree)",
+			},
+			&cli.IntFlag{
+				Name:  "max-worktrees",
+				Usage: "With --max-branches-parallel, keep at most this many temporary worktrees at once; extra ones are only created while all are busy",
+			},
+			&cli.StringFlag{
+				Name:  "trace",
+				Usage: "Write a JSON line per git command (arguments, exit code, duration, output size) to this file, for bug reports",
+			},
+			&cli.StringFlag{
+				Name:  "pull-strategy",
+				Value: "ff-only",
+				Usage: "How the checkout strategy updates a branch that has diverged from origin: ff-only (leave it), reset (reset to origin), skip (do not search it) or none (never pull)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "fields",
+				Usage: "Only include these match fields (comma-separated or repeated, e.g. file,line) in ndjson-with-summary match records",
+			},
+			&cli.BoolFlag{
+				Name:  "compare-engines-on-mismatch",
+				Usage: "Search with both rg and grep and fail the run if they match different lines, listing them (a CI check for non-portable patterns)",
+			},
+			&cli.StringFlag{
+				Name:  "since-tag",
+				Usage: "Search only branches updated after the commit date of this tag (and, with --search-commits, only newer commits)",
+			},
+			&cli.BoolFlag{
+				Name:  "since-last-run",
+				Usage: "Search only branches updated since the previous run with this flag, whose time is recorded in the repository's git directory",
+			},
+			&cli.BoolFlag{
+				Name:  "reset-last-run",
+				Usage: "Forget the time recorded by --since-last-run, so that every branch is searched again",
+			},
+			&cli.StringFlag{
+				Name:  "match-newline-handling",
+				Value: "lf",
+				Usage: "What ends a line for ^ and $: lf (every engine's default), crlf (also \\r\\n, for Windows files) or multiline (patterns may span lines; ripgrep only)",
+			},
+			&cli.BoolFlag{
+				Name:  "dedupe-text",
+				Usage: "On each branch, keep only the first match of each distinct matched text (e.g. one example of a line duplicated across many files)",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Search history instead of files: report the commits after this date (e.g. 2024-05-01 or '1 month ago') that added or removed the pattern (git log -S, see --pickaxe)",
+			},
+			&cli.StringFlag{
+				Name:  "until",
+				Usage: "Like --since, for the commits before this date",
+			},
+			&cli.StringFlag{
+				Name:  "pickaxe",
+				Value: "count",
+				Usage: "How --since/--until find commits: count (git log -S, the number of occurrences changed) or diff (git log -G, an added or removed line matches); setting it searches the whole history",
+			},
+			&cli.BoolFlag{
+				Name:  "aggregate",
+				Usage: "Print each distinct file:line:text match once at the end of the run, followed by the branches it appears on, instead of the matches of every branch",
+			},
+			&cli.BoolFlag{
+				Name:  "follow-symlinks",
+				Usage: "Search the targets of symbolic links too (rg -L, grep -R); without it rg skips symlinks",
+			},
+			&cli.BoolFlag{
+				Name:    "include-ignored",
+				Aliases: []string{"no-ignore"},
+				Usage:   "Also search files excluded by .gitignore, like build output (by default rg and grep search tracked and untracked, not ignored files)",
+			},
+			&cli.DurationFlag{
+				Name:  "branch-timeout",
+				Usage: "Give up on a branch whose checkout and search take longer than this (e.g. 2m), report it as timed out and continue with the next",
+			},
+			&cli.DurationFlag{
+				Name:  "pattern-timeout",
+				Usage: "Kill an engine still matching a branch after this long (e.g. 30s), report suspected catastrophic backtracking and skip the branch",
+			},
+			&cli.BoolFlag{
+				Name:    "blame",
+				Aliases: []string{"show-blame-commit"},
+				Usage:   "Attach the commit that last touched each matched line, with its author and date (one git blame per matched file)",
+			},
+			&cli.IntFlag{
+				Name:  "sample",
+				Usage: "Print only a random sample of this many matches, for spot-checking large result sets (counts still cover every match)",
+			},
+			&cli.Uint64Flag{
+				Name:  "seed",
+				Usage: "Seed for --sample, to draw the same sample again (the seed used is printed)",
+			},
+			&cli.StringFlag{
+				Name:  "path-style",
+				Value: "relative",
+				Usage: "How file paths are printed: relative (to the repository), absolute (for editors) or branch-qualified (branch:path, for reports)",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Do not ask before stashing uncommitted changes on the default branch in checkout mode (required when stdin is not a terminal)",
+			},
+			&cli.BoolFlag{
+				Name:  "search-worktrees",
+				Usage: "Search the worktrees already set up with git worktree, as they are checked out, instead of checking out branches; nothing is stashed or modified",
+			},
+			&cli.IntFlag{
+				Name:  "min-line-length",
+				Usage: "Drop matches whose whole line is shorter than this many characters",
+			},
+			&cli.IntFlag{
+				Name:  "max-line-length",
+				Usage: "Drop matches whose whole line is longer than this many characters, e.g. minified bundles",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-assume-unchanged",
+				Usage: "Leave out files marked assume-unchanged or skip-worktree in the index, such as local config overrides",
+			},
+			&cli.IntFlag{
+				Name:    "batch-size",
+				Aliases: []string{"branch-batch-size"},
+				Usage:   "After every N branches, return to the original branch and check that the repository is clean before going on (checkout strategy)",
+			},
+			&cli.BoolFlag{
+				Name:  "with-branch",
+				Usage: "Start --output-format grep lines with the branch, as branch:file:line:text",
+			},
+			&cli.IntFlag{
+				Name:  "max-matches-per-branch",
+				Usage: "Print at most this many matches per branch in text output, followed by how many were omitted (0 = unlimited); the branch counts still include them",
+			},
+			&cli.IntFlag{
+				Name:    "max-per-file",
+				Aliases: []string{"result-limit-per-file"},
+				Usage:   "Show at most this many matching lines per file on each branch, with a note of how many more there are",
+			},
+			&cli.BoolFlag{
+				Name:    "fixed-strings",
+				Aliases: []string{"F"},
+				Usage:   "Search for the patterns as literal strings, not regexes (engine -F), e.g. 'api_key=ABC/123+xyz' without escaping",
+			},
+			&cli.BoolFlag{
+				Name:  "translate-ere",
+				Usage: "Rewrite \\d, \\D, \\t and (?:...) in patterns into POSIX ERE for grep and git grep, which would otherwise read them differently",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "Read flags from this JSON file (as written by --dump-config); the command line and GRS_ environment variables take precedence",
+			},
+			&cli.BoolFlag{
+				Name:  "dump-config",
+				Usage: "Print the resolved flags as JSON for --config and exit without searching",
+			},
+			&cli.StringFlag{
+				Name:  "progress-format",
+				Value: "text",
+				Usage: "How progress is reported: text (status lines) or json (one JSON event per line on stderr, e.g. for progress bars)",
+			},
+			&cli.BoolFlag{
+				Name:  "count-occurrences",
+				Usage: "Also count every match within the matching lines, not just the lines, like rg --count-matches instead of rg --count",
+			},
+			&cli.StringFlag{
+				Name:  "webhook-url",
+				Usage: "Post the --output-format slack message to this Slack incoming webhook instead of printing it",
+			},
+			&cli.BoolFlag{
+				Name:    "strict-regex",
+				Aliases: []string{"strict"},
+				Usage:   "Before searching, run the patterns through every engine used on an empty file and fail with the engine's error if one rejects them",
+			},
+			&cli.BoolFlag{
+				Name:  "health-check",
+				Usage: "Record HEAD and git status before searching each repository and fail, showing the differences, if the run does not restore them exactly",
+			},
+			&cli.BoolFlag{
+				Name:  "no-restore-on-error",
+				Usage: "If the search of a repository fails in checkout mode, leave it on the failing branch with the changes stashed, and print its state and how to restore it, instead of restoring it",
+			},
+			&cli.BoolFlag{
+				Name:  "match-as-you-go",
+				Usage: "Print each match as soon as rg or grep reports it instead of once the whole branch was searched, for quick feedback on huge branches (text output, one branch at a time)",
+			},
+			&cli.Int64Flag{
+				Name:    "max-output-bytes",
+				Aliases: []string{"limit-output-bytes"},
+				Usage:   "Stop printing, and searching further branches, once the matches written to stdout reach this many bytes; exits with status 4",
+			},
+			&cli.BoolFlag{
+				Name:  "count-unique-files",
+				Usage: "Also report how many distinct files matched on any branch, counting a file found on several branches once (unique_files in the JSON formats)",
+			},
+			&cli.BoolFlag{
+				Name:  "interactive-confirm-per-branch",
+				Usage: "After each branch's results, ask whether to continue, stop, or re-run the branch with another regex or glob (needs a terminal; Ctrl-C aborts and restores the repository)",
+			},
+			&cli.BoolFlag{
+				Name:    "working-diff",
+				Aliases: []string{"diff-against-working-tree"},
+				Usage:   "Search only the lines added by the uncommitted changes of the repository (git diff --cached and git diff), e.g. as a pre-commit guard; no branch is searched",
 			},
 		},
+		Before: applyConfigFile,
+		Commands: []*cli.Command{
+			doctorCommand(),
+			benchmarkCommand(),
+			enginesCommand(),
+		},
 		Action: func(c *cli.Context) error {
-			repoPath, err := filepath.Abs(c.String("repo"))
+			// --repo and --regex are validated here rather than marked Required so
+			// that subcommands such as doctor can run without them.
+			if !(c.IsSet("repo") || c.IsSet("repo-file") || c.IsSet("patch")) || !(c.IsSet("regex") || c.IsSet("regex-file") || c.IsSet("rule") || c.IsSet("rule-from-library") || c.Bool("builtin-secrets")) {
+				_ = cli.ShowAppHelp(c)
+				return fmt.Errorf("required flags \"repo\" (or \"repo-file\" or \"patch\") and \"regex\" (or \"regex-file\", \"rule\", \"rule-from-library\" or \"builtin-secrets\") must be set")
+			}
+			opts, err := optionsFromContext(c)
 			if err != nil {
-				return fmt.Errorf("invalid repo path: %v", err)
+				return err
 			}
-
-			regex := c.String("regex")
-			branchesArg := c.String("branches")
-			includeGlobs := c.StringSlice("include-glob")
-			excludeGlobs := c.StringSlice("exclude-glob")
-
-			// Ensure repo exists
-			if _, err := os.Stat(filepath.Join(repoPath, ".git")); os.IsNotExist(err) {
-				return fmt.Errorf("not a git repository: %s", repoPath)
+			remoteName = opts.RemoteName
+			setStatusOutput(opts)
+			if opts.Explain {
+				explainRun(os.Stdout, opts)
+				return nil
 			}
-
-			// Get current branch
-			currentBranch, err := runGitCmd(repoPath, "rev-parse", "--abbrev-ref", "HEAD")
-			if err != nil {
-				return fmt.Errorf("failed to get current branch: %v", err)
+			if opts.DestructiveCheck {
+				fmt.Println("A real run would change:")
+				return reportDestructiveEffects(os.Stdout, opts)
 			}
-
-			fmt.Printf("📁 Repository: %s\n", repoPath)
-			fmt.Printf("🔍 Search pattern: %s\n", regex)
-			fmt.Printf("🌿 Current branch: %s\n", currentBranch)
-			fmt.Println()
-
-			// Warn if include/exclude globs provided but ripgrep is not available
-			if (len(includeGlobs) > 0 || len(excludeGlobs) > 0) && !commandExists("rg") {
-				fmt.Println("⚠️  Warning: include/exclude glob options require 'rg' (ripgrep). Options will be ignored because 'rg' was not found in PATH.")
+			if c.Bool("dump-config") {
+				fmt.Fprintln(os.Stderr, "Note: the configuration includes the search patterns, which may be sensitive")
+				return dumpConfig(os.Stdout, c)
 			}
-
-			// Stash changes
-			fmt.Println("💾 Stashing uncommitted changes...")
-			_, _ = runGitCmd(repoPath, "stash", "push", "-u", "-m", "git-regex-search-temp-stash")
-
-			// Pull remote branches list
-			fmt.Println("🌐 Fetching remote branches...")
-			_, _ = runGitCmd(repoPath, "fetch", "--all", "--quiet")
-
-			var branches []string
-			if branchesArg != "" {
-				branches = strings.Split(branchesArg, ",")
-			} else {
-				branchList, err := runGitCmd(repoPath, "branch", "-r")
-				if err != nil {
-					return fmt.Errorf("failed to list remote branches: %v", err)
-				}
-				for _, b := range strings.Split(branchList, "\n") {
-					b = strings.TrimSpace(b)
-					if b != "" && !strings.Contains(b, "->") {
-						branches = append(branches, strings.TrimPrefix(b, "origin/"))
-					}
-				}
+			stopTrace, err := startTrace(opts)
+			if err != nil {
+				return err
 			}
-
-			// Regex validation
-			if _, err := regexp.Compile(regex); err != nil {
-				return fmt.Errorf("invalid regex: %v", err)
+			defer stopTrace()
+			stopPager := startPager(opts)
+			defer stopPager()
+			if opts.Patch != "" {
+				return runPatch(opts)
 			}
-
-			branchColor := color.New(color.FgGreen).SprintFunc()
-			lineNumColor := color.New(color.FgYellow).SprintFunc()
-
-			fmt.Printf("Searching across %d branches...\n\n", len(branches))
-
-			for _, branch := range branches {
-				branch = strings.TrimSpace(branch)
-				if branch == "" {
-					continue
-				}
-
-				fmt.Printf("\n🔍 Searching branch: %s\n", branchColor(branch))
-				_, _ = runGitCmd(repoPath, "checkout", branch)
-				fmt.Printf("📥 Pulling latest changes for %s...\n", branchColor(branch))
-				_, _ = runGitCmd(repoPath, "pull", "origin", branch)
-				matches, err := grepRepo(repoPath, regex, includeGlobs, excludeGlobs)
-				if err != nil {
-					return fmt.Errorf("search failed on branch %s: %v", branch, err)
-				}
-
-				if len(matches) > 0 {
-					fmt.Printf("✅ Found %d matches in %s\n", len(matches), branchColor(branch))
-				} else {
-					fmt.Printf("❌ No matches found in %s\n", branchColor(branch))
-				}
-
-				for _, match := range matches {
-					parts := strings.SplitN(match, ":", 3)
-					if len(parts) < 3 {
-						continue
-					}
-					file := parts[0]
-					lineNum := parts[1]
-					lineText := parts[2]
-
-					fmt.Printf("%s:%s%s %s\n",
-						branchColor(branch),
-						file, lineNumColor(":"+lineNum),
-						lineText,
-					)
-				}
+			if opts.WorkingDiff {
+				return runWorkingDiff(opts)
 			}
-
-			fmt.Println()
-			// Restore original branch and stash
-			fmt.Printf("🔄 Restoring original branch: %s\n", currentBranch)
-			_, _ = runGitCmd(repoPath, "checkout", currentBranch)
-			fmt.Println("📤 Restoring stashed changes...")
-			_, _ = runGitCmd(repoPath, "stash", "pop")
-
-			fmt.Println("✨ Search completed!")
-			return nil
+			if opts.Watch {
+				return runWatch(opts)
+			}
+			return runSearch(opts)
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+	addFlagEnvVars(app.Flags)
+	return app
 }
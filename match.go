@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Match is a single matching line found on a branch.
+type Match struct {
+	Repo   string `json:"repo,omitempty"`
+	Branch string `json:"branch"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+	Text   string `json:"text"`
+	// TextBase64 holds the original bytes of Text when they were not valid UTF-8 (--invalid-utf8 base64).
+	TextBase64 string `json:"text_base64,omitempty"`
+	// Commit is set for commit message and notes matches instead of File.
+	Commit string `json:"commit,omitempty"`
+	// Date is the author date of a commit found by --since, --until or --pickaxe.
+	Date string `json:"date,omitempty"`
+	// Binary is set for "binary file matches" notices, which carry no line.
+	Binary bool `json:"binary,omitempty"`
+	// Pattern is the pattern that matched when several patterns are searched.
+	Pattern   string `json:"pattern,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Committer string `json:"committer,omitempty"`
+	// BlameCommit and BlameDate are the last commit of the line and its author date (--blame).
+	BlameCommit string `json:"blame_commit,omitempty"`
+	BlameDate   string `json:"blame_date,omitempty"`
+	// Rule and Severity are those of the --rule whose pattern matched.
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	// New is set by --annotate-new when the match was absent from the previously searched branch.
+	New bool `json:"new,omitempty"`
+	// Occurrences is how often the patterns match within the line (--count-occurrences).
+	Occurrences int `json:"occurrences,omitempty"`
+	// BeforeContext and AfterContext are the lines around the match (--context).
+	BeforeContext []string `json:"before_context,omitempty"`
+	AfterContext  []string `json:"after_context,omitempty"`
+
+	// moreInFile counts the matches of the file left out after this one by
+	// --max-per-file.
+	moreInFile int
+}
+
+// label returns the branch label of the match, qualified with the repository
+// name when several repositories are searched.
+func (m Match) label() string {
+	if m.Repo != "" {
+		return m.Repo + ":" + m.Branch
+	}
+	return m.Branch
+}
+
+// key identifies a match independently of the branch it was found on.
+func (m Match) key() string {
+	return fmt.Sprintf("%s:%d:%s", m.File, m.Line, m.Text)
+}
+
+// parseMatch parses a match line as printed by grep -n -Z (`file\0line:text`)
+// or git grep -n -z (`file\0line\0text`). File names cannot contain a NUL, so
+// the first one ends them. Lines without a NUL are read as `file:line:text`,
+// where file names may contain colons themselves, so the file ends at the
+// first colon that is followed by a line number and another colon.
+func parseMatch(raw string) (Match, bool) {
+	if file, rest, ok := strings.Cut(raw, "\x00"); ok {
+		line, sep, text, ok := splitLineNumber(rest)
+		if !ok || sep == '-' {
+			return Match{}, false
+		}
+		return Match{File: file, Line: line, Text: trimLineEnding(text)}, true
+	}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != ':' {
+			continue
+		}
+		j := i + 1
+		for j < len(raw) && raw[j] >= '0' && raw[j] <= '9' {
+			j++
+		}
+		if j == i+1 || j == len(raw) || raw[j] != ':' {
+			continue
+		}
+		line, err := strconv.Atoi(raw[i+1 : j])
+		if err != nil {
+			return Match{}, false
+		}
+		return Match{File: raw[:i], Line: line, Text: trimLineEnding(raw[j+1:])}, true
+	}
+	return Match{}, false
+}
+
+// splitLineNumber splits what follows the file name of a NUL-separated match
+// or context line into the line number, the separator after it (':' for
+// matches and '-' for context lines with grep -Z, NUL for both with
+// git grep -z) and the text.
+func splitLineNumber(rest string) (line int, sep byte, text string, ok bool) {
+	j := 0
+	for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+		j++
+	}
+	if j == 0 || j == len(rest) || (rest[j] != ':' && rest[j] != '-' && rest[j] != 0) {
+		return 0, 0, "", false
+	}
+	line, err := strconv.Atoi(rest[:j])
+	if err != nil {
+		return 0, 0, "", false
+	}
+	return line, rest[j], rest[j+1:], true
+}
+
+// binaryMatchText is the text recorded for binary file matches.
+const binaryMatchText = "binary file matches"
+
+// parseEngineLine parses a line of rg/grep output, recognizing the notices both
+// engines print instead of a line when a binary file matches:
+//
+//	path: binary file matches (found "\0" byte around offset 12)   (rg)
+//	grep: path: binary file matches                                   (GNU grep >= 3.5)
+//	Binary file path matches                                          (older grep)
+func parseEngineLine(raw string) (Match, bool) {
+	if file, ok := parseBinaryNotice(raw); ok {
+		return Match{File: normalizePath(file), Text: binaryMatchText, Binary: true}, true
+	}
+	m, ok := parseMatch(raw)
+	m.File = normalizePath(m.File)
+	return m, ok
+}
+
+// normalizePaths is set from --normalize-paths for the current run.
+var normalizePaths = true
+
+// normalizePath returns file in the repo-relative, slash-separated form git
+// grep prints, so that grep's "./src/x.go" and rg's "src/x.go" compare equal.
+func normalizePath(file string) string {
+	if !normalizePaths || file == "" {
+		return file
+	}
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(file)), "./")
+}
+
+func parseBinaryNotice(raw string) (string, bool) {
+	if strings.HasPrefix(raw, "Binary file ") && strings.HasSuffix(raw, " matches") {
+		return strings.TrimSuffix(strings.TrimPrefix(raw, "Binary file "), " matches"), true
+	}
+	idx := strings.Index(raw, ": binary file matches")
+	if idx < 0 {
+		return "", false
+	}
+	file := strings.TrimPrefix(raw[:idx], "grep: ")
+	rest := raw[idx+len(": binary file matches"):]
+	if rest != "" && !strings.HasPrefix(rest, " (") {
+		return "", false
+	}
+	return file, true
+}
+
+// parseRefMatch parses a `ref:file:line:text` line as printed by git grep <ref>.
+func parseRefMatch(raw, ref string) (Match, bool) {
+	if !strings.HasPrefix(raw, ref+":") {
+		return Match{}, false
+	}
+	return parseMatch(strings.TrimPrefix(raw, ref+":"))
+}
+
+// extractValues applies --capture-group and --unique to matches produced in
+// only-matching mode, where each match's text is the matched substring.
+func extractValues(opts *Options, res *Result, matches []Match) []Match {
+	if !opts.onlyMatching() {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		if opts.CaptureGroup > 0 && m.Commit == "" {
+			p := opts.patternFor(m.Text)
+			if p < 0 {
+				continue
+			}
+			sub := opts.patternREs[p].FindStringSubmatch(m.Text)
+			if sub == nil {
+				continue
+			}
+			m.Text = sub[opts.CaptureGroup]
+		}
+		if opts.Unique {
+			if res.seenValues == nil {
+				res.seenValues = make(map[string]bool)
+			}
+			if res.seenValues[m.Text] {
+				continue
+			}
+			res.seenValues[m.Text] = true
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// dedupeText keeps only the first match of each distinct matched text on a
+// branch (--dedupe-text), e.g. one example of a boilerplate line copied into
+// many files. The matched part of the line is compared, not the whole line.
+// Binary notices are kept.
+func dedupeText(opts *Options, matches []Match) []Match {
+	if !opts.DedupeText {
+		return matches
+	}
+	seen := make(map[string]bool)
+	var kept []Match
+	for _, m := range matches {
+		if !m.Binary {
+			text := m.Text
+			if !opts.onlyMatching() {
+				if found := opts.re.FindString(m.Text); found != "" {
+					text = found
+				}
+			}
+			if seen[text] {
+				continue
+			}
+			seen[text] = true
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// limitPerFile keeps at most --max-per-file matches of each file, so that a
+// single noisy file does not drown out the rest of a branch. The last match
+// kept of a file records how many were left out. Commit and note matches have
+// no file and are kept.
+func limitPerFile(opts *Options, matches []Match) []Match {
+	if opts.MaxPerFile <= 0 {
+		return matches
+	}
+	count := make(map[string]int)
+	last := make(map[string]int)
+	var kept []Match
+	for _, m := range matches {
+		if m.File == "" {
+			kept = append(kept, m)
+			continue
+		}
+		count[m.File]++
+		if count[m.File] > opts.MaxPerFile {
+			kept[last[m.File]].moreInFile++
+			continue
+		}
+		last[m.File] = len(kept)
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// filterNotMatching drops the matches whose text also matches --not-matching.
+// Binary notices carry no text and are kept.
+func filterNotMatching(opts *Options, matches []Match) []Match {
+	if opts.notMatchingRe == nil {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		if m.Binary || !opts.notMatchingRe.MatchString(m.Text) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// filterLineLength keeps only the matches whose whole line is within
+// --min-line-length and --max-line-length characters, e.g. to drop hits in
+// minified bundles. Binary notices have no line and are kept.
+func filterLineLength(opts *Options, matches []Match) []Match {
+	if opts.MinLineLength == 0 && opts.MaxLineLength == 0 {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		n := utf8.RuneCountInString(m.Text)
+		if !m.Binary && (n < opts.MinLineLength || (opts.MaxLineLength > 0 && n > opts.MaxLineLength)) {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// filterLineRange keeps only the file matches within --line-range. Binary
+// notices carry no line number and are dropped; commit and note matches are
+// not file content and are kept.
+func filterLineRange(opts *Options, matches []Match) []Match {
+	if opts.lineFrom == 0 && opts.lineTo == 0 {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		if m.Commit != "" {
+			kept = append(kept, m)
+			continue
+		}
+		if m.Binary || m.Line < opts.lineFrom || (opts.lineTo > 0 && m.Line > opts.lineTo) {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// countOccurrences sets the Occurrences of matches to the number of
+// non-overlapping matches of re in their text, and returns their sum. Every
+// match counts at least once: binary file notices carry no line, and with
+// --only-matching the text is a single match already. A nil re counts
+// nothing.
+func countOccurrences(re *regexp.Regexp, matches []Match) int {
+	if re == nil {
+		return 0
+	}
+	total := 0
+	for i := range matches {
+		n := 1
+		if !matches[i].Binary {
+			n = max(len(re.FindAllStringIndex(matches[i].Text, -1)), 1)
+		}
+		matches[i].Occurrences = n
+		total += n
+	}
+	return total
+}
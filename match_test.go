@@ -0,0 +1,183 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+func TestParseEngineLineBinaryNotices(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Match
+		ok   bool
+	}{
+		{
+			name: "rg",
+			raw:  "assets/logo.png: binary file matches (found \"\\0\" byte around offset 7)",
+			want: Match{File: "assets/logo.png", Text: binaryMatchText, Binary: true},
+			ok:   true,
+		},
+		{
+			name: "grep 3.5 and later",
+			raw:  "grep: bin/app: binary file matches",
+			want: Match{File: "bin/app", Text: binaryMatchText, Binary: true},
+			ok:   true,
+		},
+		{
+			name: "older grep",
+			raw:  "Binary file build/out.o matches",
+			want: Match{File: "build/out.o", Text: binaryMatchText, Binary: true},
+			ok:   true,
+		},
+		{
+			name: "match on a line mentioning binary files",
+			raw:  "notes.txt:3:grep: x: binary file matches later",
+			want: Match{File: "notes.txt", Line: 3, Text: "grep: x: binary file matches later"},
+			ok:   true,
+		},
+		{
+			name: "no line number",
+			raw:  "some message from the engine",
+			ok:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseEngineLine(tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("parseEngineLine(%q) ok = %v, want %v", tt.raw, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEngineLine(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEngineLineNormalizesPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		grep string
+		rg   string
+		want string
+	}{
+		{name: "top level", grep: "./a.txt:1:TODO", rg: "a.txt:1:TODO", want: "a.txt"},
+		{name: "nested", grep: "./src/x.go:1:TODO", rg: "src/x.go:1:TODO", want: "src/x.go"},
+		{name: "redundant separators", grep: ".//src/./x.go:1:TODO", rg: "src//x.go:1:TODO", want: "src/x.go"},
+		{name: "NUL-separated grep -Z", grep: "./src/x.go\x001:TODO", rg: "src/x.go:1:TODO", want: "src/x.go"},
+		{name: "binary notice", grep: "grep: ./src/x.bin: binary file matches", rg: "src/x.bin: binary file matches", want: "src/x.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromGrep, ok := parseEngineLine(tt.grep)
+			if !ok {
+				t.Fatalf("parseEngineLine(%q) failed", tt.grep)
+			}
+			fromRg, ok := parseEngineLine(tt.rg)
+			if !ok {
+				t.Fatalf("parseEngineLine(%q) failed", tt.rg)
+			}
+			if fromGrep.File != tt.want || fromRg.File != tt.want {
+				t.Errorf("files = %q (grep), %q (rg), want %q", fromGrep.File, fromRg.File, tt.want)
+			}
+			if !reflect.DeepEqual(fromGrep, fromRg) {
+				t.Errorf("grep-style %+v differs from rg-style %+v", fromGrep, fromRg)
+			}
+		})
+	}
+}
+
+func TestParseEngineLineKeepsPathsWithoutNormalizing(t *testing.T) {
+	defer func(normalize bool) { normalizePaths = normalize }(normalizePaths)
+	normalizePaths = false
+	if m, ok := parseEngineLine("./src/x.go:1:TODO"); !ok || m.File != "./src/x.go" {
+		t.Errorf("parseEngineLine() = %+v, %v, want the file as printed", m, ok)
+	}
+}
+
+func TestParseMatchColonsInFileNames(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Match
+		ok   bool
+	}{
+		{name: "plain", raw: "a.txt:2:TODO two", want: Match{File: "a.txt", Line: 2, Text: "TODO two"}, ok: true},
+		{name: "colon in the name", raw: "weird:name.txt:2:TODO two", want: Match{File: "weird:name.txt", Line: 2, Text: "TODO two"}, ok: true},
+		{name: "colons in the text", raw: "weird:name.txt:2:TODO: a:3:b", want: Match{File: "weird:name.txt", Line: 2, Text: "TODO: a:3:b"}, ok: true},
+		{name: "empty text", raw: "weird:name.txt:7:", want: Match{File: "weird:name.txt", Line: 7}, ok: true},
+		{name: "no line number", raw: "weird:name.txt:TODO", ok: false},
+		{name: "grep -Z", raw: "weird:name.txt\x002:TODO two", want: Match{File: "weird:name.txt", Line: 2, Text: "TODO two"}, ok: true},
+		{name: "git grep -z", raw: "weird:name.txt\x002\x00TODO two", want: Match{File: "weird:name.txt", Line: 2, Text: "TODO two"}, ok: true},
+		// The NUL ends the name even though it contains :digits: itself
+		{name: "digits in the name, grep -Z", raw: "v2:10:notes.txt\x002:TODO here", want: Match{File: "v2:10:notes.txt", Line: 2, Text: "TODO here"}, ok: true},
+		{name: "digits in the name, git grep -z", raw: "v2:10:notes.txt\x002\x00TODO: a:3:b", want: Match{File: "v2:10:notes.txt", Line: 2, Text: "TODO: a:3:b"}, ok: true},
+		{name: "grep -Z context line", raw: "weird:name.txt\x001-before", ok: false},
+		{name: "NUL without a line number", raw: "weird:name.txt\x00TODO", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMatch(tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("parseMatch(%q) ok = %v, want %v", tt.raw, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMatch(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextReadingsNULSeparated(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []contextReading
+	}{
+		{name: "grep -Z", raw: "v2:10:notes.txt\x001-a", want: []contextReading{{file: "v2:10:notes.txt", line: 1, text: "a"}}},
+		{name: "git grep -z", raw: "weird:name.txt\x001\x00x", want: []contextReading{{file: "weird:name.txt", line: 1, text: "x"}}},
+		{name: "grep -Z match line", raw: "weird:name.txt\x002:TODO two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contextReadings(tt.raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("contextReadings(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilesWithColonsInNames(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{
+			"weird:name.txt":  "x\nTODO two\ny\n",
+			"v2:10:notes.txt": "a\nTODO here\nb\n",
+		}},
+	)
+	want := "main:v2:10:notes.txt:2:TODO here\nmain:weird:name.txt:2:TODO two"
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "git grep", args: []string{"--checkout-strategy", "none"}},
+		{name: "git grep with context", args: []string{"--checkout-strategy", "none", "-C", "1"}},
+		{name: "grep", args: []string{"--checkout-strategy", "worktree", "--engine", "grep"}},
+		{name: "grep with context", args: []string{"--checkout-strategy", "worktree", "--engine", "grep", "-C", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--repo", repo, "--regex", "TODO", "--output-format", "grep", "--with-branch"}, tt.args...)
+			out, err := runApp(t, args...)
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if got := strings.TrimSpace(out); got != want {
+				t.Errorf("output = %q, want %q", got, want)
+			}
+		})
+	}
+}
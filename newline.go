@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// newlineModes lists the accepted values of --match-newline-handling. In
+// every mode ^ and $ anchor at line boundaries; the modes differ in what ends
+// a line and whether a match may cross one.
+//
+//   - lf: lines end at \n. A \r before it belongs to the line, so "foo$" does
+//     not match "foo\r\n". This is what rg, grep and git grep do by default.
+//   - crlf: lines end at \n or \r\n. rg runs with --crlf, $ in the patterns
+//     given to grep and git grep also accepts a \r before the newline, and the
+//     \r is dropped from the reported text.
+//   - multiline: patterns may match \n and span lines (rg --multiline). Only
+//     ripgrep can do this; use \A and \z to anchor at the start and end of
+//     the file.
+var newlineModes = []string{"lf", "crlf", "multiline"}
+
+// crlfLineEndings is set with --match-newline-handling crlf for the current run.
+var crlfLineEndings = false
+
+// trimLineEnding drops the \r of a CRLF line ending from text in crlf mode.
+func trimLineEnding(text string) string {
+	if !crlfLineEndings {
+		return text
+	}
+	return strings.TrimSuffix(text, "\r")
+}
+
+// checkLineByLine rejects a pattern with a literal newline, which can never
+// match line by line. rg refuses such a pattern while grep silently finds
+// nothing, so without this check the engines would disagree.
+func checkLineByLine(p string) error {
+	re, err := syntax.Parse(p, syntax.Perl)
+	if err != nil {
+		// Reported by the regular compilation
+		return nil
+	}
+	if hasLiteralNewline(re) {
+		return fmt.Errorf("regex %q matches a newline, which never happens line by line; use --match-newline-handling multiline (ripgrep only)", p)
+	}
+	return nil
+}
+
+func hasLiteralNewline(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpLiteral && strings.ContainsRune(string(re.Rune), '\n') {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasLiteralNewline(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// crlfAnchors rewrites every end-of-line anchor of the POSIX extended regex p
+// to also match before a \r, for grep and git grep in crlf mode. $ inside a
+// bracket expression or escaped with a backslash is a literal and kept.
+func crlfAnchors(p string) string {
+	var b strings.Builder
+	inBracket := false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '\\' && !inBracket && i+1 < len(p):
+			b.WriteByte(c)
+			i++
+			c = p[i]
+		case c == '[' && !inBracket:
+			inBracket = true
+			b.WriteByte(c)
+			// A ] right after [ or [^ is part of the set
+			if i+1 < len(p) && p[i+1] == '^' {
+				i++
+				b.WriteByte(p[i])
+			}
+			if i+1 < len(p) && p[i+1] == ']' {
+				i++
+				b.WriteByte(p[i])
+			}
+			continue
+		case c == ']' && inBracket:
+			inBracket = false
+		case c == '$' && !inBracket:
+			// grep -E has no \r escape, so the carriage return goes in as is
+			b.WriteString("\r?")
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// matchEnv returns the environment passed to --on-match-exec for m.
+func matchEnv(m Match) []string {
+	return append(os.Environ(),
+		"GRS_REPO="+m.Repo,
+		"GRS_BRANCH="+m.Branch,
+		"GRS_FILE="+m.File,
+		"GRS_LINE="+strconv.Itoa(m.Line),
+		"GRS_TEXT="+m.Text,
+		"GRS_COMMIT="+m.Commit,
+		"GRS_PATTERN="+m.Pattern,
+		"GRS_RULE="+m.Rule,
+		"GRS_SEVERITY="+m.Severity,
+	)
+}
+
+// runMatchHooks runs --on-match-exec through sh once per match, at most
+// --on-match-jobs at a time. Failures do not stop the other commands; they are
+// recorded as errors of the run.
+func runMatchHooks(opts *Options, res *Result) {
+	if len(res.Matches) == 0 {
+		return
+	}
+	jobs := opts.OnMatchJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	statusf("🪝 Running --on-match-exec for %d matches...\n", len(res.Matches))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []string
+	)
+	sem := make(chan struct{}, jobs)
+	for _, m := range res.Matches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m Match) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cmd := exec.Command("sh", "-c", opts.OnMatchExec)
+			cmd.Env = matchEnv(m)
+			out, err := cmd.CombinedOutput()
+			if verboseGit && len(out) > 0 {
+				fmt.Fprintf(os.Stderr, "on-match-exec: %s\n", strings.TrimSpace(string(out)))
+			}
+			if err != nil {
+				mu.Lock()
+				failures = append(failures, fmt.Sprintf("on-match-exec failed for %s:%s:%d: %v", m.label(), m.File, m.Line, err))
+				mu.Unlock()
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	for _, f := range failures {
+		res.addError("%s", f)
+	}
+}
@@ -0,0 +1,1242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-isatty"
+	"github.com/urfave/cli/v2"
+)
+
+// Options holds the parsed command line configuration for a search run.
+type Options struct {
+	Repos []string
+	// Patterns are the regexes to search for; a line matches if any of them matches.
+	Patterns     []string
+	Branches     []string
+	IncludeGlobs []string
+	ExcludeGlobs []string
+	Author       string
+	Committer    string
+	FirstMatch   bool
+	Nice         bool
+	NiceDelay    time.Duration
+	Threads      int
+	AnnotateNew  bool
+	OutputFormat string
+	NewerThan    string
+	// IncludeDangling also searches unreachable commits and blobs.
+	IncludeDangling bool
+	// CheckoutStrategy controls how each branch is materialized, see checkoutStrategies.
+	CheckoutStrategy string
+	SearchCommits    bool
+	SearchNotes      bool
+	WaitForLock      bool
+	OnlyMatching     bool
+	// CaptureGroup prints only the given capture group of each match (implies OnlyMatching).
+	CaptureGroup int
+	Unique       bool
+	// MatchBranchNames applies the pattern to branch names instead of file contents.
+	MatchBranchNames bool
+	Checkpoint       string
+	Verbose          bool
+	RestoreStrategy  string
+	// RespectExportIgnore drops matches in paths marked export-ignore in .gitattributes.
+	RespectExportIgnore bool
+	FilesWithMatches    bool
+	// Print0 prints NUL-separated branch/file records (implies FilesWithMatches).
+	Print0 bool
+	// RefGlobs selects arbitrary refs (e.g. refs/pull/*/head) to search with git grep.
+	RefGlobs []string
+	// SearchLocal, SearchRemote and SearchTags pick the refs listed when no
+	// --branches or --ref-glob is given; remote branches when none is set.
+	SearchLocal  bool
+	SearchRemote bool
+	SearchTags   bool
+	// RemoteName is the remote branches are listed from and pulled from.
+	RemoteName string
+	// BranchSeparator is printed between the match groups of consecutive branches.
+	BranchSeparator  string
+	ContextSeparator string
+	// ContextLines is the larger of BeforeLines and AfterLines; context is
+	// recorded when it is positive.
+	ContextLines int
+	// BeforeLines and AfterLines are the lines recorded before and after each
+	// match (--before and --after, both --context by default).
+	BeforeLines int
+	AfterLines  int
+	// SearchSubmodules also searches initialized submodules at their pinned commits.
+	SearchSubmodules bool
+	// ValidateOutput round-trips JSON output through its Go types before printing it.
+	ValidateOutput bool
+	// SmartCase searches case-insensitively unless a pattern contains an uppercase letter.
+	SmartCase bool
+	// IgnoreCase always searches case-insensitively (-i).
+	IgnoreCase bool
+	// PreCommand is run through sh in the checked-out tree before each branch is searched.
+	PreCommand string
+	// PostCommand is run through sh once after the whole search.
+	PostCommand     string
+	IgnorePreErrors bool
+	// Unshallow fetches the full history of shallow clones before searching.
+	Unshallow bool
+	// Deepen is the number of commits fetched with git fetch --deepen for every searched branch of a shallow clone.
+	Deepen int
+	// GlobCaseInsensitive makes --include-glob/--exclude-glob ignore case; the pattern is unaffected.
+	GlobCaseInsensitive bool
+	// TrackedOnly searches only files tracked by git, using git grep on the checked-out tree.
+	TrackedOnly bool
+	// Color is one of colorModes.
+	Color string
+	// OutputDir additionally writes the results of every branch to a file of its own.
+	OutputDir string
+	// RegexFlags are Go regexp flags (i, m, s, U) applied to the Go-side
+	// pattern used for validation and highlighting; the engine is unaffected.
+	RegexFlags string
+	// SearchStash also searches every stash entry, labeled stash@{N}.
+	SearchStash bool
+	// OnMatchExec is run through sh for every match, with the match in GRS_* variables.
+	OnMatchExec string
+	OnMatchJobs int
+	// SparsePaths limits checkout mode to these directories via sparse-checkout.
+	SparsePaths []string
+	// MatchLimitTotal stops the whole search once this many matches were collected.
+	MatchLimitTotal int
+	// ShowDiff is the base revision whose diff against each branch is shown for matching lines.
+	ShowDiff string
+	// ChangedSince limits each branch to the files it changed since its merge-base with this revision.
+	ChangedSince string
+	// ReadOnly never fetches and refuses every git command that could write to the repository.
+	ReadOnly bool
+	// Offline skips git fetch and the branch updates, searching the refs as
+	// they are cached locally.
+	Offline bool
+	// Prioritize searches the branches with the most pre-scanned matches first.
+	Prioritize bool
+	// InvalidUTF8 is one of invalidUTF8Modes.
+	InvalidUTF8 string
+	// Watch re-runs the search whenever the refs of the repositories change.
+	Watch              bool
+	WatchInterval      time.Duration
+	WatchFetchInterval time.Duration
+	// Explain describes what the run would do instead of searching.
+	Explain bool
+	// MaxOutputBytes caps the bytes of matches written to stdout.
+	MaxOutputBytes int64
+	// WorkingDiff searches only the lines added by the uncommitted changes.
+	WorkingDiff bool
+	// InteractiveReview asks what to do after the results of every branch.
+	InteractiveReview bool
+	// MatchAsYouGo prints matches while the engine is still searching the branch.
+	MatchAsYouGo bool
+	// onEngineMatch receives every match of the branch being searched as the
+	// engine reports it, with --match-as-you-go.
+	onEngineMatch func(Match)
+	// NoRestoreOnError leaves the repository as a failed run left it.
+	NoRestoreOnError bool
+	// HealthCheck verifies that the repository is left as it was found.
+	HealthCheck bool
+	// DestructiveCheck reports the changes a run would make to each repository instead of searching.
+	DestructiveCheck bool
+	// RgArgs and GrepArgs are passed unchecked to rg or grep, before the patterns.
+	RgArgs   []string
+	GrepArgs []string
+	// BranchGlobs overrides the include/exclude globs for individual branches;
+	// globs starting with "!" exclude.
+	BranchGlobs map[string][]string
+	// MinMatches suppresses the matches of branches with fewer matches than this.
+	MinMatches int
+	// NotMatching drops matched lines that also match this regex.
+	NotMatching string
+	// ForceCheckout discards local modifications when a branch checkout fails (destructive).
+	ForceCheckout bool
+	// LineRange limits file matches to the lines from:to, either end optional.
+	LineRange string
+	// MinBranches is the number of branches that must resolve unless AllowEmptyBranches is set.
+	MinBranches        int
+	AllowEmptyBranches bool
+	// StrictBranches aborts when a --branches entry does not exist instead of
+	// skipping it.
+	StrictBranches bool
+	// ExcludeBranches are branch globs never searched, in addition to those in
+	// the repository's .git-regex-search-ignore unless NoIgnoreBranches is set.
+	ExcludeBranches  []string
+	NoIgnoreBranches bool
+	// BranchFilter and BranchExclude are regexes the names of the enumerated
+	// branches must and must not match.
+	BranchFilter  string
+	BranchExclude string
+	// SortBranches is the order branches are searched in; see branchSortOrders.
+	SortBranches string
+	// BranchSort is a git for-each-ref --sort key the branches are listed by.
+	BranchSort string
+	// NormalizeBranches searches a branch listed under a local and a remote
+	// name at the same commit only once.
+	NormalizeBranches bool
+	// PreferBranchName is the name such a branch is searched under: local or remote.
+	PreferBranchName string
+	// KeepRefPrefix reports branches under their remote-tracking names.
+	KeepRefPrefix bool
+	// Rules are named patterns with a severity; their patterns are appended
+	// to Patterns.
+	Rules []rule
+	// FailOnSeverity makes the run exit with status 5 when a match of a rule
+	// with at least this severity is found.
+	FailOnSeverity string
+	// MaxRuntime stops the search between branches once it has run this long;
+	// 0 means no limit.
+	MaxRuntime time.Duration
+	// NormalizePaths strips the "./" grep prefixes engine paths with.
+	NormalizePaths bool
+	// EngineVersionGuard is the minimum ripgrep version the run requires.
+	EngineVersionGuard string
+	// Patch is a unified diff whose added lines are searched instead of a
+	// repository; "-" reads it from stdin.
+	Patch string
+	// NoPager disables piping text output to $PAGER on a terminal.
+	NoPager bool
+	// Engine selects the search engine for checked-out trees; see engineChoices.
+	Engine string
+	// RepoFile lists further repositories to search, one path or URL per
+	// line. A repository that fails is reported and the others still run.
+	RepoFile string
+	// RegexFile and BranchesFile list further patterns and branches to search,
+	// one per line.
+	RegexFile    string
+	BranchesFile string
+	// QuietNoMatch prints nothing for branches without matches.
+	QuietNoMatch bool
+	// Quiet drops the progress and status lines, leaving only the results.
+	Quiet bool
+	// CacheDir stores per-branch results keyed by tip commit and options.
+	CacheDir string
+	// MaxBranchesParallel is the number of branches searched concurrently.
+	MaxBranchesParallel int
+	// ConcurrencyOrder is the order --max-branches-parallel starts branches in.
+	ConcurrencyOrder string
+	// MaxWorktrees caps the temporary worktrees that exist at once with --max-branches-parallel.
+	MaxWorktrees int
+	// BatchSize is the number of branches checked out between the checks of --batch-size.
+	BatchSize int
+	// Trace is the file receiving a JSON line per git command.
+	Trace string
+	// PullStrategy decides how the checkout strategy updates branches; one of pullStrategies.
+	PullStrategy string
+	// TranslateERE rewrites RE2-only classes such as \d for grep -E and git grep -E.
+	TranslateERE bool
+	// FixedStrings searches for the patterns as literal strings (-F).
+	FixedStrings bool
+	// StrictRegex checks the patterns with every engine used before searching.
+	StrictRegex bool
+	// WebhookURL is the Slack incoming webhook the slack output is posted to instead of printed.
+	WebhookURL string
+	// CountOccurrences counts every match within a line rather than matching lines.
+	CountOccurrences bool
+	// CountUniqueFiles reports how many distinct files matched on any branch.
+	CountUniqueFiles bool
+	// ProgressFormat is how progress is reported: text status lines or JSON events on stderr.
+	ProgressFormat string
+	// WithBranch prefixes --output-format grep lines with the branch.
+	WithBranch bool
+	// Fields limits ndjson-with-summary match records to these Match fields.
+	Fields []string
+	// CompareEngines runs rg and grep and fails the run when they disagree.
+	CompareEngines bool
+	// SinceTag limits the search to branches and commits newer than this tag.
+	SinceTag string
+	// SinceLastRun limits the search to branches updated since the previous --since-last-run search.
+	SinceLastRun bool
+	// ResetLastRun forgets the time of the previous --since-last-run search.
+	ResetLastRun bool
+	// NewlineHandling is one of newlineModes.
+	NewlineHandling string
+	// DedupeText keeps one match per distinct matched text on each branch.
+	DedupeText bool
+	// Aggregate prints each distinct match once, with the branches it is on.
+	Aggregate bool
+	// CountAll lists the branches without matches in the --count table too.
+	CountAll bool
+	// HistorySince and HistoryUntil bound the commits searched with git log
+	// -S or -G, as Pickaxe (one of pickaxeModes) selects.
+	HistorySince string
+	HistoryUntil string
+	Pickaxe      string
+	// IncludeIgnored makes rg and grep search files excluded by .gitignore too.
+	IncludeIgnored bool
+	// FollowSymlinks makes rg and grep search the targets of symbolic links.
+	FollowSymlinks bool
+	// BranchTimeout bounds the search of a single branch; 0 means no limit.
+	BranchTimeout time.Duration
+	// PatternTimeout bounds a single engine run on a branch; 0 means no limit.
+	PatternTimeout time.Duration
+	// Blame attaches the last commit, author and date of each matched line.
+	Blame bool
+	// Sample prints only this many randomly chosen matches; Seed makes the choice reproducible.
+	Sample int
+	Seed   uint64
+	// PathStyle is how file paths are printed; one of pathStyles.
+	PathStyle string
+	// Yes skips the confirmation before stashing work on the default branch.
+	Yes bool
+	// SearchWorktrees searches the existing worktrees in place instead of branches.
+	SearchWorktrees bool
+	// MinLineLength and MaxLineLength bound the length of matched lines; 0 means no bound.
+	MinLineLength int
+	MaxLineLength int
+	// MaxPerFile caps the matches shown per file on a branch.
+	MaxPerFile int
+	// MaxPerBranch caps the matches printed per branch in text output; the
+	// branch is still counted with all of them.
+	MaxPerBranch int
+	// SkipAssumeUnchanged drops matches in files marked assume-unchanged or skip-worktree.
+	SkipAssumeUnchanged bool
+
+	// re matches any of the patterns; patternREs holds them individually.
+	re         *regexp.Regexp
+	patternREs []*regexp.Regexp
+	// patternOrigins names the --regex-file line each pattern was read from,
+	// or is empty for patterns given otherwise.
+	patternOrigins []string
+	// sinceTime is the --since-tag commit date in the repository being searched.
+	sinceTime int64
+	// changedFiles are the --changed-since files of the branch being searched;
+	// nil without --changed-since.
+	changedFiles []string
+	// ctx bounds the commands of a branch search with --branch-timeout.
+	ctx context.Context
+
+	// branchSeparatorSet records an explicit --branch-separator, which may be empty.
+	branchSeparatorSet bool
+	// lineFrom and lineTo are the parsed --line-range bounds; 0 means open.
+	lineFrom, lineTo int
+
+	authorRe      *regexp.Regexp
+	committerRe   *regexp.Regexp
+	notMatchingRe *regexp.Regexp
+
+	// branchFilterRe and branchExcludeRe are the compiled --branch-filter and
+	// --branch-exclude; nil when unset.
+	branchFilterRe, branchExcludeRe *regexp.Regexp
+}
+
+func optionsFromContext(c *cli.Context) (*Options, error) {
+	opts := &Options{
+		Patterns:            c.StringSlice("regex"),
+		IncludeGlobs:        c.StringSlice("include-glob"),
+		ExcludeGlobs:        c.StringSlice("exclude-glob"),
+		Author:              c.String("author"),
+		Committer:           c.String("committer"),
+		FirstMatch:          c.Bool("first-match"),
+		Nice:                c.Bool("nice"),
+		NiceDelay:           c.Duration("nice-delay"),
+		Threads:             c.Int("threads"),
+		AnnotateNew:         c.Bool("annotate-new"),
+		OutputFormat:        c.String("output-format"),
+		WithBranch:          c.Bool("with-branch"),
+		ProgressFormat:      c.String("progress-format"),
+		CountOccurrences:    c.Bool("count-occurrences"),
+		CountUniqueFiles:    c.Bool("count-unique-files"),
+		WebhookURL:          c.String("webhook-url"),
+		StrictRegex:         c.Bool("strict-regex"),
+		TranslateERE:        c.Bool("translate-ere"),
+		FixedStrings:        c.Bool("fixed-strings"),
+		NewerThan:           c.String("newer-than"),
+		IncludeDangling:     c.Bool("include-dangling"),
+		CheckoutStrategy:    c.String("checkout-strategy"),
+		SearchCommits:       c.Bool("search-commits"),
+		SearchNotes:         c.Bool("search-notes"),
+		WaitForLock:         c.Bool("wait"),
+		OnlyMatching:        c.Bool("only-matching"),
+		CaptureGroup:        c.Int("capture-group"),
+		Unique:              c.Bool("unique"),
+		MatchBranchNames:    c.Bool("match-branch-names"),
+		Checkpoint:          c.String("checkpoint"),
+		Verbose:             c.Bool("verbose"),
+		RestoreStrategy:     c.String("restore-strategy"),
+		RespectExportIgnore: c.Bool("respect-export-ignore"),
+		FilesWithMatches:    c.Bool("files-with-matches"),
+		Print0:              c.Bool("print0"),
+		RefGlobs:            c.StringSlice("ref-glob"),
+		SearchLocal:         c.Bool("local"),
+		SearchRemote:        c.Bool("remote"),
+		SearchTags:          c.Bool("tags"),
+		RemoteName:          c.String("remote-name"),
+		ContextSeparator:    c.String("context-separator"),
+		ContextLines:        c.Int("context"),
+		BeforeLines:         c.Int("context"),
+		AfterLines:          c.Int("context"),
+		SearchSubmodules:    c.Bool("search-submodules"),
+		ValidateOutput:      c.Bool("validate-output"),
+		SmartCase:           c.Bool("smart-case"),
+		IgnoreCase:          c.Bool("ignore-case"),
+		PreCommand:          c.String("pre-command"),
+		PostCommand:         c.String("post-command"),
+		SortBranches:        c.String("sort-branches"),
+		BranchSort:          c.String("branch-sort"),
+		KeepRefPrefix:       c.Bool("keep-ref-prefix"),
+		NormalizeBranches:   c.Bool("normalize-branch-names"),
+		PreferBranchName:    c.String("prefer-branch-name"),
+		IgnorePreErrors:     c.Bool("ignore-pre-errors"),
+		Unshallow:           c.Bool("unshallow"),
+		Deepen:              c.Int("deepen"),
+		GlobCaseInsensitive: c.Bool("glob-case-insensitive"),
+		TrackedOnly:         c.Bool("tracked-only"),
+		Color:               c.String("color"),
+		OutputDir:           c.String("output-dir"),
+		RegexFlags:          c.String("regex-flags"),
+		SearchStash:         c.Bool("search-stash"),
+		OnMatchExec:         c.String("on-match-exec"),
+		OnMatchJobs:         c.Int("on-match-jobs"),
+		MatchLimitTotal:     c.Int("match-limit-total"),
+		ShowDiff:            c.String("show-diff"),
+		ChangedSince:        c.String("changed-since"),
+		ReadOnly:            c.Bool("read-only"),
+		Offline:             c.Bool("offline"),
+		Prioritize:          c.Bool("prioritize"),
+		InvalidUTF8:         c.String("invalid-utf8"),
+		Watch:               c.Bool("watch"),
+		WatchInterval:       c.Duration("watch-interval"),
+		WatchFetchInterval:  c.Duration("watch-fetch-interval"),
+		Explain:             c.Bool("explain"),
+		DestructiveCheck:    c.Bool("dry-run-destructive-check"),
+		HealthCheck:         c.Bool("health-check"),
+		NoRestoreOnError:    c.Bool("no-restore-on-error"),
+		MatchAsYouGo:        c.Bool("match-as-you-go"),
+		InteractiveReview:   c.Bool("interactive-confirm-per-branch"),
+		WorkingDiff:         c.Bool("working-diff"),
+		MaxOutputBytes:      c.Int64("max-output-bytes"),
+		RgArgs:              c.StringSlice("rg-args"),
+		GrepArgs:            c.StringSlice("grep-args"),
+		MinMatches:          c.Int("min-matches"),
+		NotMatching:         c.String("not-matching"),
+		ForceCheckout:       c.Bool("force-checkout"),
+		LineRange:           c.String("line-range"),
+		MinBranches:         c.Int("min-branches"),
+		StrictBranches:      c.Bool("strict-branches"),
+		AllowEmptyBranches:  c.Bool("allow-empty-branches"),
+		ExcludeBranches:     c.StringSlice("exclude-branch"),
+		BranchFilter:        c.String("branch-filter"),
+		BranchExclude:       c.String("branch-exclude"),
+		NoIgnoreBranches:    c.Bool("no-ignore-branches"),
+		FailOnSeverity:      c.String("fail-on-severity"),
+		MaxRuntime:          c.Duration("max-runtime"),
+		NormalizePaths:      c.Bool("normalize-paths"),
+		EngineVersionGuard:  c.String("engine-version-guard"),
+		Patch:               c.String("patch"),
+		NoPager:             c.Bool("no-pager"),
+		Engine:              c.String("engine"),
+		RepoFile:            c.String("repo-file"),
+		RegexFile:           c.String("regex-file"),
+		BranchesFile:        c.String("branches-file"),
+		QuietNoMatch:        c.Bool("quiet-no-match"),
+		Quiet:               c.Bool("quiet"),
+		CacheDir:            c.String("cache-dir"),
+		MaxBranchesParallel: c.Int("max-branches-parallel"),
+		BatchSize:           c.Int("batch-size"),
+		MaxWorktrees:        c.Int("max-worktrees"),
+		ConcurrencyOrder:    c.String("concurrency-order"),
+		Trace:               c.String("trace"),
+		PullStrategy:        c.String("pull-strategy"),
+		Fields:              splitList(c.StringSlice("fields")),
+		CompareEngines:      c.Bool("compare-engines-on-mismatch"),
+		SinceTag:            c.String("since-tag"),
+		SinceLastRun:        c.Bool("since-last-run"),
+		ResetLastRun:        c.Bool("reset-last-run"),
+		NewlineHandling:     c.String("match-newline-handling"),
+		DedupeText:          c.Bool("dedupe-text"),
+		Aggregate:           c.Bool("aggregate"),
+		HistorySince:        c.String("since"),
+		HistoryUntil:        c.String("until"),
+		IncludeIgnored:      c.Bool("include-ignored"),
+		FollowSymlinks:      c.Bool("follow-symlinks"),
+		BranchTimeout:       c.Duration("branch-timeout"),
+		PatternTimeout:      c.Duration("pattern-timeout"),
+		Blame:               c.Bool("blame"),
+		Sample:              c.Int("sample"),
+		Seed:                c.Uint64("seed"),
+		PathStyle:           c.String("path-style"),
+		Yes:                 c.Bool("yes"),
+		SearchWorktrees:     c.Bool("search-worktrees"),
+		MinLineLength:       c.Int("min-line-length"),
+		MaxLineLength:       c.Int("max-line-length"),
+		SkipAssumeUnchanged: c.Bool("skip-assume-unchanged"),
+		MaxPerFile:          c.Int("max-per-file"),
+		MaxPerBranch:        c.Int("max-matches-per-branch"),
+		CountAll:            c.Bool("count-all"),
+	}
+
+	// Several checks below depend on whether branches were listed
+	if branchesArg := c.String("branches"); branchesArg != "" {
+		opts.Branches = strings.Split(branchesArg, ",")
+	}
+	if opts.BranchesFile != "" {
+		branches, err := readListFile(opts.BranchesFile, "branches-file")
+		if err != nil {
+			return nil, err
+		}
+		if len(branches) == 0 {
+			return nil, fmt.Errorf("--branches-file %s lists no branches", opts.BranchesFile)
+		}
+		opts.Branches = append(opts.Branches, branches...)
+	}
+
+	if c.IsSet("branch-separator") {
+		opts.BranchSeparator = c.String("branch-separator")
+		opts.branchSeparatorSet = true
+	}
+	if c.Bool("summary-json") {
+		opts.OutputFormat = "summary"
+	}
+	if c.Bool("count") {
+		opts.OutputFormat = "count"
+	}
+	if opts.CountAll && opts.OutputFormat != "count" {
+		return nil, fmt.Errorf("--count-all requires --count")
+	}
+	if c.Bool("no-checkout") {
+		if c.IsSet("checkout-strategy") && opts.CheckoutStrategy != "none" {
+			return nil, fmt.Errorf("--no-checkout cannot be combined with --checkout-strategy %s", opts.CheckoutStrategy)
+		}
+		opts.CheckoutStrategy = "none"
+	}
+	if c.Bool("worktree") {
+		if c.Bool("no-checkout") {
+			return nil, fmt.Errorf("--worktree cannot be combined with --no-checkout")
+		}
+		if c.IsSet("checkout-strategy") && opts.CheckoutStrategy != "worktree" {
+			return nil, fmt.Errorf("--worktree cannot be combined with --checkout-strategy %s", opts.CheckoutStrategy)
+		}
+		opts.CheckoutStrategy = "worktree"
+	}
+	if opts.RemoteName == "" || strings.ContainsAny(opts.RemoteName, "/ ") {
+		return nil, fmt.Errorf("invalid --remote-name %q (expected the name of a remote, as listed by git remote)", opts.RemoteName)
+	}
+	// --tags, --ref-glob and --read-only imply the none strategy; it is set
+	// here, before any check that depends on the strategy
+	if opts.SearchTags {
+		// Tags are not branches to check out and pull, they are searched in place
+		if c.IsSet("checkout-strategy") && opts.CheckoutStrategy != "none" {
+			return nil, fmt.Errorf("--tags requires --checkout-strategy none")
+		}
+		opts.CheckoutStrategy = "none"
+	}
+	if len(opts.RefGlobs) > 0 {
+		// Arbitrary refs cannot be checked out as branches, they are searched in place
+		if c.IsSet("checkout-strategy") && opts.CheckoutStrategy != "none" {
+			return nil, fmt.Errorf("--ref-glob requires --checkout-strategy none")
+		}
+		if len(opts.Branches) > 0 {
+			return nil, fmt.Errorf("--ref-glob cannot be combined with --branches")
+		}
+		opts.CheckoutStrategy = "none"
+	}
+	if opts.ReadOnly {
+		// Only git grep against refs works without touching the repository
+		if c.IsSet("checkout-strategy") && opts.CheckoutStrategy != "none" {
+			return nil, fmt.Errorf("--read-only requires --checkout-strategy none")
+		}
+		if opts.Unshallow {
+			return nil, fmt.Errorf("--read-only cannot be combined with --unshallow")
+		}
+		if opts.Deepen > 0 {
+			return nil, fmt.Errorf("--read-only cannot be combined with --deepen")
+		}
+		if opts.SinceLastRun || opts.ResetLastRun {
+			return nil, fmt.Errorf("--read-only cannot be combined with --since-last-run or --reset-last-run, which write to the git directory")
+		}
+		opts.CheckoutStrategy = "none"
+	}
+	if !containsString(outputFormats, opts.OutputFormat) {
+		return nil, fmt.Errorf("invalid --output-format %q (expected one of: %s)", opts.OutputFormat, strings.Join(outputFormats, ", "))
+	}
+	if !containsString(progressFormats, opts.ProgressFormat) {
+		return nil, fmt.Errorf("invalid --progress-format %q (expected one of: %s)", opts.ProgressFormat, strings.Join(progressFormats, ", "))
+	}
+	if opts.FixedStrings {
+		if opts.TranslateERE {
+			return nil, fmt.Errorf("--fixed-strings cannot be combined with --translate-ere: there is no regex to translate")
+		}
+		if opts.CaptureGroup > 0 {
+			return nil, fmt.Errorf("--fixed-strings cannot be combined with --capture-group: a literal has no groups")
+		}
+	}
+	if opts.ContextLines < 0 {
+		return nil, fmt.Errorf("invalid --context %d (expected a number of lines, 0 or more)", opts.ContextLines)
+	}
+	if c.IsSet("before") {
+		opts.BeforeLines = c.Int("before")
+	}
+	if c.IsSet("after") {
+		opts.AfterLines = c.Int("after")
+	}
+	if opts.BeforeLines < 0 || opts.AfterLines < 0 {
+		return nil, fmt.Errorf("invalid --before/--after %d/%d (expected numbers of lines, 0 or more)", opts.BeforeLines, opts.AfterLines)
+	}
+	opts.ContextLines = max(opts.BeforeLines, opts.AfterLines)
+	if opts.WebhookURL != "" {
+		if opts.OutputFormat != "slack" {
+			return nil, fmt.Errorf("--webhook-url posts the slack output; it needs --output-format slack")
+		}
+		if !strings.HasPrefix(opts.WebhookURL, "https://") && !strings.HasPrefix(opts.WebhookURL, "http://") {
+			return nil, fmt.Errorf("invalid --webhook-url %q (expected an http:// or https:// URL)", opts.WebhookURL)
+		}
+	}
+	if opts.FollowSymlinks && (opts.CheckoutStrategy == "none" || opts.TrackedOnly || opts.Patch != "") {
+		return nil, fmt.Errorf("--follow-symlinks needs rg or grep on a checkout; git grep searches the link itself, not its target")
+	}
+	if opts.ChangedSince != "" && (opts.Patch != "" || opts.SearchWorktrees) {
+		return nil, fmt.Errorf("--changed-since compares branches with their merge-base; it cannot be combined with --patch or --search-worktrees")
+	}
+	if opts.WithBranch && opts.OutputFormat != "grep" {
+		return nil, fmt.Errorf("--with-branch only applies to --output-format grep")
+	}
+	if opts.OutputFormat == "diffstat" && opts.CacheDir == "" {
+		return nil, fmt.Errorf("--output-format diffstat needs --cache-dir to compare with the previous run")
+	}
+
+	if !containsString(invalidUTF8Modes, opts.InvalidUTF8) {
+		return nil, fmt.Errorf("invalid --invalid-utf8 %q (expected one of: %s)", opts.InvalidUTF8, strings.Join(invalidUTF8Modes, ", "))
+	}
+
+	if !containsString(colorModes, opts.Color) {
+		return nil, fmt.Errorf("invalid --color %q (expected one of: %s)", opts.Color, strings.Join(colorModes, ", "))
+	}
+
+	if !containsString(engineChoices, opts.Engine) {
+		return nil, fmt.Errorf("invalid --engine %q (expected one of: %s)", opts.Engine, strings.Join(engineChoices, ", "))
+	}
+	if opts.CompareEngines {
+		if c.IsSet("engine") && opts.Engine != "all" {
+			return nil, fmt.Errorf("--compare-engines-on-mismatch runs every engine; it cannot be combined with --engine %s", opts.Engine)
+		}
+		if opts.CheckoutStrategy == "none" || opts.TrackedOnly {
+			return nil, fmt.Errorf("--compare-engines-on-mismatch needs checked-out trees; git grep searches instead with --checkout-strategy none (also implied by --read-only, --tags and --ref-glob) and --tracked-only")
+		}
+		for _, e := range []string{"rg", "grep"} {
+			if !commandExists(e) {
+				return nil, fmt.Errorf("--compare-engines-on-mismatch needs both rg and grep, but %s is not installed", e)
+			}
+		}
+		if opts.CacheDir != "" {
+			return nil, fmt.Errorf("--compare-engines-on-mismatch cannot be combined with --cache-dir, which skips the engines for cached branches")
+		}
+		opts.Engine = "all"
+	}
+	if (opts.Engine == "rg" || opts.Engine == "grep") && !commandExists(opts.Engine) {
+		return nil, fmt.Errorf("--engine %s: %s is not installed", opts.Engine, opts.Engine)
+	}
+
+	if !containsString(checkoutStrategies, opts.CheckoutStrategy) {
+		return nil, fmt.Errorf("invalid --checkout-strategy %q (expected one of: %s)", opts.CheckoutStrategy, strings.Join(checkoutStrategies, ", "))
+	}
+
+	if strings.Trim(opts.RegexFlags, "imsU") != "" {
+		return nil, fmt.Errorf("invalid --regex-flags %q (expected a combination of: i, m, s, U)", opts.RegexFlags)
+	}
+
+	if opts.RegexFile != "" {
+		patterns, numbers, err := readListFileLines(opts.RegexFile, "regex-file")
+		if err != nil {
+			return nil, err
+		}
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("--regex-file %s lists no patterns", opts.RegexFile)
+		}
+		opts.patternOrigins = make([]string, len(opts.Patterns), len(opts.Patterns)+len(patterns))
+		for _, n := range numbers {
+			opts.patternOrigins = append(opts.patternOrigins, fmt.Sprintf("--regex-file %s:%d", opts.RegexFile, n))
+		}
+		opts.Patterns = append(opts.Patterns, patterns...)
+	}
+
+	rules := make([]rule, 0, len(c.StringSlice("rule")))
+	for _, spec := range c.StringSlice("rule") {
+		r, err := parseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	if c.IsSet("pattern-library") && !c.IsSet("rule-from-library") {
+		return nil, fmt.Errorf("--pattern-library needs --rule-from-library to pick the patterns to search for")
+	}
+	if c.IsSet("rule-from-library") || c.Bool("builtin-secrets") {
+		lib, err := loadPatternLibrary(c.String("pattern-library"))
+		if err != nil {
+			return nil, err
+		}
+		picked, err := libraryRules(lib, splitList(c.StringSlice("rule-from-library")), c.Bool("builtin-secrets"))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, picked...)
+	}
+	for _, r := range rules {
+		r.index = len(opts.Patterns)
+		opts.Patterns = append(opts.Patterns, r.Pattern)
+		opts.Rules = append(opts.Rules, r)
+	}
+	if opts.FailOnSeverity != "" {
+		if severityRank(opts.FailOnSeverity) < 0 {
+			return nil, fmt.Errorf("invalid --fail-on-severity %q (expected one of: %s)", opts.FailOnSeverity, strings.Join(severities, ", "))
+		}
+		if len(opts.Rules) == 0 {
+			return nil, fmt.Errorf("--fail-on-severity requires at least one --rule")
+		}
+		if opts.Watch {
+			return nil, fmt.Errorf("--fail-on-severity cannot be combined with --watch")
+		}
+	}
+
+	for _, spec := range c.StringSlice("glob-for") {
+		branch, glob, ok := strings.Cut(spec, "=")
+		if !ok || branch == "" || glob == "" {
+			return nil, fmt.Errorf("invalid --glob-for %q (expected branch=glob)", spec)
+		}
+		if opts.BranchGlobs == nil {
+			opts.BranchGlobs = make(map[string][]string)
+		}
+		opts.BranchGlobs[branch] = append(opts.BranchGlobs[branch], glob)
+	}
+
+	if opts.Watch && opts.WatchInterval <= 0 {
+		return nil, fmt.Errorf("--watch-interval must be positive")
+	}
+
+	if opts.LineRange != "" {
+		var err error
+		if opts.lineFrom, opts.lineTo, err = parseLineRange(opts.LineRange); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.EngineVersionGuard != "" {
+		if _, ok := parseVersion(opts.EngineVersionGuard); !ok {
+			return nil, fmt.Errorf("invalid --engine-version-guard %q (expected a version such as 13.0.0)", opts.EngineVersionGuard)
+		}
+	}
+	if opts.Patch != "" && opts.Watch {
+		return nil, fmt.Errorf("--patch cannot be combined with --watch")
+	}
+	if len(opts.Fields) > 0 {
+		if opts.OutputFormat != "ndjson-with-summary" {
+			return nil, fmt.Errorf("--fields only applies to --output-format ndjson-with-summary")
+		}
+		for _, f := range opts.Fields {
+			if _, ok := matchFieldIndex[f]; !ok {
+				return nil, fmt.Errorf("invalid --fields entry %q (expected one of: %s)", f, strings.Join(matchFieldNames(), ", "))
+			}
+		}
+	}
+	if !containsString(newlineModes, opts.NewlineHandling) {
+		return nil, fmt.Errorf("invalid --match-newline-handling %q (expected one of: %s)", opts.NewlineHandling, strings.Join(newlineModes, ", "))
+	}
+	if opts.NewlineHandling == "multiline" {
+		if opts.Patch != "" || opts.CheckoutStrategy == "none" || opts.TrackedOnly || opts.Engine == "all" || opts.searchEngines()[0] != "rg" {
+			return nil, fmt.Errorf("--match-newline-handling multiline needs ripgrep as the only engine on checked-out trees; grep and git grep match line by line")
+		}
+	}
+	if !containsString(pullStrategies, opts.PullStrategy) {
+		return nil, fmt.Errorf("invalid --pull-strategy %q (expected one of: %s)", opts.PullStrategy, strings.Join(pullStrategies, ", "))
+	}
+	if opts.SearchWorktrees && (opts.MatchBranchNames || len(opts.Branches) > 0 || len(opts.RefGlobs) > 0) {
+		return nil, fmt.Errorf("--search-worktrees searches the worktrees instead of branches; it cannot be combined with --branches, --ref-glob or --match-branch-names")
+	}
+	if opts.MinLineLength < 0 || opts.MaxLineLength < 0 {
+		return nil, fmt.Errorf("--min-line-length and --max-line-length must not be negative")
+	}
+	if opts.MaxLineLength > 0 && opts.MinLineLength > opts.MaxLineLength {
+		return nil, fmt.Errorf("--min-line-length %d is greater than --max-line-length %d", opts.MinLineLength, opts.MaxLineLength)
+	}
+	if (opts.MinLineLength > 0 || opts.MaxLineLength > 0) && opts.onlyMatching() {
+		return nil, fmt.Errorf("--min-line-length and --max-line-length filter on the whole line, which --only-matching does not keep")
+	}
+	if !containsString(pathStyles, opts.PathStyle) {
+		return nil, fmt.Errorf("invalid --path-style %q (expected one of: %s)", opts.PathStyle, strings.Join(pathStyles, ", "))
+	}
+	if opts.Sample < 0 {
+		return nil, fmt.Errorf("--sample must not be negative")
+	}
+	if opts.Sample > 0 && containsString([]string{"summary", "count", "count-table", "diffstat"}, opts.OutputFormat) {
+		return nil, fmt.Errorf("--sample picks matches to print; --output-format %s only prints counts", opts.OutputFormat)
+	}
+	if opts.Sample > 0 && opts.Watch {
+		return nil, fmt.Errorf("--sample cannot be combined with --watch")
+	}
+	if opts.BranchTimeout < 0 {
+		return nil, fmt.Errorf("--branch-timeout must not be negative")
+	}
+	if opts.PatternTimeout < 0 {
+		return nil, fmt.Errorf("--pattern-timeout must not be negative")
+	}
+	if opts.MaxBranchesParallel < 0 {
+		return nil, fmt.Errorf("--max-branches-parallel must not be negative")
+	}
+	if opts.MaxBranchesParallel > 1 && opts.CheckoutStrategy == "checkout" {
+		return nil, fmt.Errorf("--max-branches-parallel needs --checkout-strategy worktree or none (--no-checkout); the checkout strategy has a single working tree")
+	}
+	if opts.MaxPerFile < 0 {
+		return nil, fmt.Errorf("--max-per-file must not be negative")
+	}
+	if c.IsSet("pickaxe") || opts.HistorySince != "" || opts.HistoryUntil != "" {
+		opts.Pickaxe = c.String("pickaxe")
+		if !containsString(pickaxeModes, opts.Pickaxe) {
+			return nil, fmt.Errorf("invalid --pickaxe %q (expected one of: %s)", opts.Pickaxe, strings.Join(pickaxeModes, ", "))
+		}
+		// The history is searched instead of the files
+		for _, f := range []struct {
+			set  bool
+			flag string
+		}{
+			{opts.ContextLines > 0, "--context, --before and --after"},
+			{opts.SearchCommits, "--search-commits"},
+			{opts.MatchBranchNames, "--match-branch-names"},
+			{opts.filesOnly(), "--files-with-matches and --print0"},
+			{opts.Blame, "--blame"},
+			{opts.SearchWorktrees, "--search-worktrees"},
+			{opts.Patch != "", "--patch"},
+			{opts.WorkingDiff, "--working-diff"},
+			{opts.onlyMatching(), "--only-matching and --capture-group"},
+		} {
+			if f.set {
+				return nil, fmt.Errorf("--since, --until and --pickaxe search commits, not files, and cannot be combined with %s", f.flag)
+			}
+		}
+	}
+	if opts.Aggregate {
+		switch {
+		case !opts.streamsText():
+			return nil, fmt.Errorf("--aggregate only applies to the text output format")
+		case opts.Sample > 0:
+			return nil, fmt.Errorf("--aggregate cannot be combined with --sample")
+		case opts.filesOnly():
+			return nil, fmt.Errorf("--aggregate cannot be combined with --files-with-matches or --print0")
+		}
+	}
+	if opts.MaxPerBranch < 0 {
+		return nil, fmt.Errorf("--max-matches-per-branch must not be negative")
+	}
+	if opts.Deepen < 0 {
+		return nil, fmt.Errorf("--deepen must not be negative")
+	}
+	if opts.SinceLastRun && opts.SinceTag != "" {
+		return nil, fmt.Errorf("--since-last-run cannot be combined with --since-tag")
+	}
+	if opts.Deepen > 0 && opts.Unshallow {
+		return nil, fmt.Errorf("--deepen cannot be combined with --unshallow, which fetches the whole history")
+	}
+	if !containsString(concurrencyOrders, opts.ConcurrencyOrder) {
+		return nil, fmt.Errorf("invalid --concurrency-order %q (expected one of: %s)", opts.ConcurrencyOrder, strings.Join(concurrencyOrders, ", "))
+	}
+	if opts.ConcurrencyOrder != "fifo" && opts.MaxBranchesParallel <= 1 {
+		return nil, fmt.Errorf("--concurrency-order %s requires --max-branches-parallel greater than 1", opts.ConcurrencyOrder)
+	}
+	if opts.MaxWorktrees < 0 {
+		return nil, fmt.Errorf("--max-worktrees must not be negative")
+	}
+	if opts.MaxWorktrees > 0 && opts.CheckoutStrategy != "worktree" {
+		return nil, fmt.Errorf("--max-worktrees requires --checkout-strategy worktree")
+	}
+	if opts.BatchSize < 0 {
+		return nil, fmt.Errorf("--batch-size must not be negative")
+	}
+	if opts.MaxRuntime < 0 {
+		return nil, fmt.Errorf("--max-runtime must not be negative")
+	}
+	if opts.MaxRuntime > 0 && opts.Watch {
+		return nil, fmt.Errorf("--max-runtime cannot be combined with --watch")
+	}
+	if opts.MinMatches < 0 {
+		return nil, fmt.Errorf("--min-matches must not be negative")
+	}
+
+	if opts.MatchLimitTotal < 0 {
+		return nil, fmt.Errorf("--match-limit-total must not be negative")
+	}
+
+	if opts.CaptureGroup < 0 {
+		return nil, fmt.Errorf("--capture-group must not be negative")
+	}
+
+	if !containsString(restoreStrategies, opts.RestoreStrategy) {
+		return nil, fmt.Errorf("invalid --restore-strategy %q (expected one of: %s)", opts.RestoreStrategy, strings.Join(restoreStrategies, ", "))
+	}
+	if !containsString(branchNamePreferences, opts.PreferBranchName) {
+		return nil, fmt.Errorf("invalid --prefer-branch-name %q (expected one of: %s)", opts.PreferBranchName, strings.Join(branchNamePreferences, ", "))
+	}
+	if opts.WorkingDiff && (opts.Patch != "" || opts.Watch) {
+		return nil, fmt.Errorf("--working-diff cannot be combined with --patch or --watch")
+	}
+	if opts.InteractiveReview && opts.Watch {
+		return nil, fmt.Errorf("--interactive-confirm-per-branch cannot be combined with --watch")
+	}
+	if opts.MaxOutputBytes < 0 {
+		return nil, fmt.Errorf("--max-output-bytes must not be negative")
+	}
+	if opts.MatchAsYouGo {
+		if err := streamableEngine(opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.NoRestoreOnError && opts.CheckoutStrategy != "checkout" {
+		return nil, fmt.Errorf("--no-restore-on-error requires --checkout-strategy checkout; the other strategies never touch the working tree")
+	}
+	if opts.HealthCheck && opts.RestoreStrategy != "full" {
+		return nil, fmt.Errorf("--health-check verifies that the repository is restored; it cannot be combined with --restore-strategy %s", opts.RestoreStrategy)
+	}
+
+	if opts.ShowDiff != "" && (!opts.streamsText() || opts.filesOnly()) {
+		return nil, fmt.Errorf("--show-diff only applies to the text output format")
+	}
+
+	if opts.filesOnly() && !opts.streamsText() {
+		return nil, fmt.Errorf("--files-with-matches and --print0 only apply to the text output format")
+	}
+	if opts.Offline {
+		if opts.Unshallow {
+			return nil, fmt.Errorf("--offline cannot be combined with --unshallow, which fetches")
+		}
+		if opts.Deepen > 0 {
+			return nil, fmt.Errorf("--offline cannot be combined with --deepen, which fetches")
+		}
+		if c.IsSet("pull-strategy") && opts.PullStrategy != "none" {
+			return nil, fmt.Errorf("--offline cannot be combined with --pull-strategy %s", opts.PullStrategy)
+		}
+		opts.PullStrategy = "none"
+	}
+
+	if len(c.StringSlice("sparse")) > 0 {
+		if opts.CheckoutStrategy != "checkout" {
+			return nil, fmt.Errorf("--sparse requires --checkout-strategy checkout")
+		}
+		var err error
+		if opts.SparsePaths, err = cleanSparsePaths(c.StringSlice("sparse")); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.BatchSize > 0 && opts.CheckoutStrategy != "checkout" {
+		return nil, fmt.Errorf("--batch-size requires --checkout-strategy checkout")
+	}
+
+	if opts.PreCommand != "" && opts.CheckoutStrategy == "none" {
+		return nil, fmt.Errorf("--pre-command needs a checked-out tree (--checkout-strategy checkout or worktree)")
+	}
+
+	var err error
+	if opts.Author != "" {
+		if opts.authorRe, err = regexp.Compile(opts.Author); err != nil {
+			return nil, fmt.Errorf("invalid --author pattern: %v", err)
+		}
+	}
+	if opts.Committer != "" {
+		if opts.committerRe, err = regexp.Compile(opts.Committer); err != nil {
+			return nil, fmt.Errorf("invalid --committer pattern: %v", err)
+		}
+	}
+	if opts.NotMatching != "" {
+		if opts.notMatchingRe, err = regexp.Compile(opts.NotMatching); err != nil {
+			return nil, fmt.Errorf("invalid --not-matching pattern: %v", err)
+		}
+	}
+	if opts.BranchFilter != "" {
+		if opts.branchFilterRe, err = regexp.Compile(opts.BranchFilter); err != nil {
+			return nil, fmt.Errorf("invalid --branch-filter pattern: %v", err)
+		}
+	}
+	if opts.BranchExclude != "" {
+		if opts.branchExcludeRe, err = regexp.Compile(opts.BranchExclude); err != nil {
+			return nil, fmt.Errorf("invalid --branch-exclude pattern: %v", err)
+		}
+	}
+
+	repos := c.StringSlice("repo")
+	if opts.RepoFile != "" {
+		listed, err := readRepoFile(opts.RepoFile)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, listed...)
+	}
+	for _, r := range repos {
+		if isRepoURL(r) {
+			if opts.Watch {
+				return nil, fmt.Errorf("--watch cannot watch the remote repository %s", r)
+			}
+			if opts.Offline {
+				return nil, fmt.Errorf("--offline cannot clone the remote repository %s", r)
+			}
+			opts.Repos = append(opts.Repos, r)
+			continue
+		}
+		repoPath, err := filepath.Abs(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid repo path: %v", err)
+		}
+		opts.Repos = append(opts.Repos, repoPath)
+	}
+
+	if opts.SearchLocal || opts.SearchRemote || opts.SearchTags {
+		if len(opts.Branches) > 0 || len(opts.RefGlobs) > 0 {
+			return nil, fmt.Errorf("--local, --remote and --tags cannot be combined with --branches or --ref-glob")
+		}
+	} else {
+		opts.SearchRemote = true
+	}
+	if (opts.BranchFilter != "" || opts.BranchExclude != "") && len(opts.Branches) > 0 {
+		return nil, fmt.Errorf("--branch-filter and --branch-exclude narrow the enumerated branches; they cannot be combined with --branches")
+	}
+	// An explicit --branches list is searched in the given order, and
+	// --branch-sort leaves the order to git, unless --sort-branches says
+	// otherwise
+	if !c.IsSet("sort-branches") && (len(opts.Branches) > 0 || opts.BranchSort != "") {
+		opts.SortBranches = "none"
+	}
+	if opts.BranchSort != "" && len(opts.Branches) > 0 {
+		return nil, fmt.Errorf("--branch-sort orders the branches git lists; it cannot be combined with --branches")
+	}
+	if !containsString(branchSortOrders, opts.SortBranches) {
+		return nil, fmt.Errorf("invalid --sort-branches %q (expected one of: %s)", opts.SortBranches, strings.Join(branchSortOrders, ", "))
+	}
+
+	return opts, nil
+}
+
+// engineThreads returns the thread count to pass to ripgrep, or 0 to let it decide.
+// Nice mode defaults to a single thread unless --threads was given explicitly.
+func (o *Options) engineThreads() int {
+	if o.Threads > 0 {
+		return o.Threads
+	}
+	if o.Nice {
+		return 1
+	}
+	return 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// context returns the context the commands of a branch search run under.
+func (o *Options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// contextArgs returns the -B and -A arguments that make rg, grep and git grep
+// print the context lines --context, --before and --after record.
+func (o *Options) contextArgs() []string {
+	var args []string
+	if o.BeforeLines > 0 {
+		args = append(args, "-B", strconv.Itoa(o.BeforeLines))
+	}
+	if o.AfterLines > 0 {
+		args = append(args, "-A", strconv.Itoa(o.AfterLines))
+	}
+	return args
+}
+
+// withContext returns a copy of o whose branch search commands run under ctx.
+func (o *Options) withContext(ctx context.Context) *Options {
+	c := *o
+	c.ctx = ctx
+	return &c
+}
+
+// runGit runs git like runGitCmd, under the context of the branch search.
+func (o *Options) runGit(repoPath string, args ...string) (string, error) {
+	return runGitCmdContext(o.context(), repoPath, args...)
+}
+
+// splitList flattens the values of a repeatable flag that also accepts
+// comma-separated lists, dropping empty entries.
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// onlyMatching reports whether only the matched part of each line is printed.
+func (o *Options) onlyMatching() bool {
+	return o.OnlyMatching || o.CaptureGroup > 0
+}
+
+// occurrenceRE returns the regex whose matches --count-occurrences counts,
+// or nil without it.
+func (o *Options) occurrenceRE() *regexp.Regexp {
+	if !o.CountOccurrences {
+		return nil
+	}
+	return o.re
+}
+
+// patternLabel returns the patterns for display in status lines.
+func (o *Options) patternLabel() string {
+	return strings.Join(o.Patterns, ", ")
+}
+
+// engineArgs returns the patterns as repeated -e arguments for grep and git
+// grep, rewritten for ERE with --translate-ere and with $ adapted to CRLF line
+// endings in crlf mode.
+func (o *Options) engineArgs() []string {
+	var args []string
+	for _, p := range o.Patterns {
+		if o.FixedStrings {
+			args = append(args, "-e", p)
+			continue
+		}
+		if o.TranslateERE {
+			p = translateERE(p)
+		}
+		if o.NewlineHandling == "crlf" {
+			p = crlfAnchors(p)
+		}
+		args = append(args, "-e", p)
+	}
+	return args
+}
+
+// matcherFlag returns the grep and git grep option that selects how the
+// patterns are read: -E for extended regexes, or -F with --fixed-strings.
+// GNU grep refuses both at once, so it replaces -E rather than following it.
+func (o *Options) matcherFlag() string {
+	if o.FixedStrings {
+		return "-F"
+	}
+	return "-E"
+}
+
+// rgPatternArgs returns the patterns as repeated -e arguments for rg, which
+// handles line endings itself.
+func (o *Options) rgPatternArgs() []string {
+	var args []string
+	if o.FixedStrings {
+		args = append(args, "-F")
+	}
+	for _, p := range o.Patterns {
+		args = append(args, "-e", p)
+	}
+	return args
+}
+
+// patternFor returns the index of the first pattern matching text, or -1.
+func (o *Options) patternFor(text string) int {
+	for i, re := range o.patternREs {
+		if re.MatchString(text) {
+			return i
+		}
+	}
+	return -1
+}
+
+// filesOnly reports whether only the names of matching files are printed.
+func (o *Options) filesOnly() bool {
+	return o.FilesWithMatches || o.Print0
+}
+
+// branchSeparator returns the line printed between the match groups of two
+// branches. By default the progress messages already separate branches when
+// they share stdout with the matches; otherwise a blank line is used.
+func (o *Options) branchSeparator() (string, bool) {
+	if o.branchSeparatorSet {
+		return o.BranchSeparator, true
+	}
+	if statusWriter == os.Stdout || statusWriter == os.Stderr && isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd()) {
+		return "", false
+	}
+	return "", true
+}
+
+// ignoreCase reports whether the search is case-insensitive: always with
+// --ignore-case, and with --smart-case when no pattern contains an uppercase
+// letter. Like ripgrep, escaped characters such as \S or \W do not count as
+// uppercase.
+func (o *Options) ignoreCase() bool {
+	if o.IgnoreCase {
+		return true
+	}
+	if !o.SmartCase {
+		return false
+	}
+	for _, p := range o.Patterns {
+		runes := []rune(p)
+		for i := 0; i < len(runes); i++ {
+			if runes[i] == '\\' && !o.FixedStrings {
+				i++
+				continue
+			}
+			if unicode.IsUpper(runes[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// forBranch returns the options to search branch with: a copy using the
+// --glob-for globs of the branch instead of the global ones, if it has any.
+func (o *Options) forBranch(branch string) *Options {
+	globs, ok := o.BranchGlobs[branch]
+	if !ok {
+		return o
+	}
+	c := *o
+	c.IncludeGlobs, c.ExcludeGlobs = nil, nil
+	for _, g := range globs {
+		if exclude, ok := strings.CutPrefix(g, "!"); ok {
+			c.ExcludeGlobs = append(c.ExcludeGlobs, exclude)
+		} else {
+			c.IncludeGlobs = append(c.IncludeGlobs, g)
+		}
+	}
+	return &c
+}
+
+// parseLineRange parses a --line-range of the form from:to, where either bound
+// may be left out (e.g. 1:50, 100: or :20).
+func parseLineRange(s string) (int, int, error) {
+	fromStr, toStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid --line-range %q (expected from:to, e.g. 1:50)", s)
+	}
+	var from, to int
+	var err error
+	if fromStr != "" {
+		if from, err = strconv.Atoi(fromStr); err != nil || from < 1 {
+			return 0, 0, fmt.Errorf("invalid --line-range %q: start must be a positive line number", s)
+		}
+	}
+	if toStr != "" {
+		if to, err = strconv.Atoi(toStr); err != nil || to < 1 {
+			return 0, 0, fmt.Errorf("invalid --line-range %q: end must be a positive line number", s)
+		}
+	}
+	if to > 0 && from > to {
+		return 0, 0, fmt.Errorf("invalid --line-range %q: start is after end", s)
+	}
+	if from == 0 && to == 0 {
+		return 0, 0, fmt.Errorf("invalid --line-range %q (expected from:to, e.g. 1:50)", s)
+	}
+	return from, to, nil
+}
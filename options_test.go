@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+// TestStrategyDependentOptions checks options against the checkout strategy
+// the run ends up with, including when another flag implies it.
+func TestStrategyDependentOptions(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "worktrees and branches", args: []string{"--search-worktrees", "--branches", "main"}, wantErr: "--search-worktrees searches the worktrees"},
+		{name: "ref glob and branches", args: []string{"--ref-glob", "refs/heads/*", "--branches", "main"}, wantErr: "--ref-glob cannot be combined with --branches"},
+		{name: "ref glob in parallel", args: []string{"--ref-glob", "refs/remotes/origin/*", "--max-branches-parallel", "4"}},
+		{name: "read-only in parallel", args: []string{"--read-only", "--jobs", "4"}},
+		{name: "read-only following symlinks", args: []string{"--read-only", "--follow-symlinks"}, wantErr: "--follow-symlinks needs rg or grep on a checkout"},
+		{name: "read-only comparing engines", args: []string{"--read-only", "--compare-engines-on-mismatch"}, wantErr: "--compare-engines-on-mismatch needs checked-out trees"},
+		{name: "read-only multiline matching", args: []string{"--read-only", "--match-newline-handling", "multiline"}, wantErr: "--match-newline-handling multiline needs ripgrep"},
+		{name: "ref glob multiline matching", args: []string{"--ref-glob", "refs/heads/*", "--match-newline-handling", "multiline"}, wantErr: "--match-newline-handling multiline needs ripgrep"},
+		{name: "read-only keeping a failed checkout", args: []string{"--read-only", "--no-restore-on-error"}, wantErr: "--no-restore-on-error requires --checkout-strategy checkout"},
+		{name: "tags keeping a failed checkout", args: []string{"--tags", "--no-restore-on-error"}, wantErr: "--no-restore-on-error requires --checkout-strategy checkout"},
+		{name: "tags following symlinks", args: []string{"--tags", "--follow-symlinks"}, wantErr: "--follow-symlinks needs rg or grep on a checkout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--repo", repo, "--regex", "TODO", "--output-format", "summary"}, tt.args...)
+			_, err := runApp(t, args...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("run failed: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
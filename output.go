@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// statusWriter receives the progress, status and warning lines. They go to
+// stderr so that stdout only carries results, and are dropped with --quiet.
+var statusWriter io.Writer = os.Stderr
+
+// setStatusOutput silences the status lines for --quiet.
+func setStatusOutput(opts *Options) {
+	statusWriter = os.Stderr
+	if opts.Quiet {
+		statusWriter = io.Discard
+	}
+}
+
+func statusf(format string, args ...interface{}) {
+	fmt.Fprintf(statusWriter, format, args...)
+}
+
+func statusln(args ...interface{}) {
+	fmt.Fprintln(statusWriter, args...)
+}
+
+// colorModes lists the accepted values of --color.
+var colorModes = []string{"auto", "always", "never"}
+
+// setColorMode decides once whether output is colorized. The color functions
+// below are created at startup, so color.NoColor has to be set explicitly for
+// them to stop emitting escape codes when stdout is redirected.
+func setColorMode(mode string) {
+	switch mode {
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	default:
+		fd := os.Stdout.Fd()
+		_, noColorEnv := os.LookupEnv("NO_COLOR")
+		color.NoColor = noColorEnv || os.Getenv("TERM") == "dumb" ||
+			!(isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd))
+	}
+}
+
+var (
+	branchColor  = color.New(color.FgGreen).SprintFunc()
+	lineNumColor = color.New(color.FgYellow).SprintFunc()
+	newColor     = color.New(color.FgMagenta, color.Bold).SprintFunc()
+	matchColor   = color.New(color.FgRed, color.Bold).SprintFunc()
+	blameColor   = color.New(color.FgHiBlack).SprintFunc()
+	contextColor = color.New(color.Faint).SprintFunc()
+	patternColor = color.New(color.FgCyan).SprintFunc()
+)
+
+// severityColors colors the rule tag of a match by its severity.
+var severityColors = map[string]func(a ...interface{}) string{
+	"info":     color.New(color.FgCyan).SprintFunc(),
+	"low":      color.New(color.FgBlue).SprintFunc(),
+	"medium":   color.New(color.FgYellow).SprintFunc(),
+	"high":     color.New(color.FgRed).SprintFunc(),
+	"critical": color.New(color.FgRed, color.Bold).SprintFunc(),
+}
+
+func severityColor(severity string) func(a ...interface{}) string {
+	if c, ok := severityColors[severity]; ok {
+		return c
+	}
+	return fmt.Sprint
+}
+
+// highlightMatches wraps every match of re in s with the match color.
+func highlightMatches(re *regexp.Regexp, s string) string {
+	locs := re.FindAllStringIndex(s, -1)
+	if locs == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		if loc[0] == loc[1] {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(matchColor(s[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// highlightLine highlights the matches of re in a matched line for the text
+// output, unless re is nil or colors are off.
+func highlightLine(re *regexp.Regexp, s string) string {
+	if re == nil || color.NoColor {
+		return s
+	}
+	return highlightMatches(re, s)
+}
+
+// printTextMatches writes matches in the default `branch:file:line text`
+// format, with the matches of re in each matched line highlighted. re may be
+// nil, and nothing is highlighted when colors are off.
+func printTextMatches(w io.Writer, re *regexp.Regexp, matches []Match) {
+	// Last line printed of the file, so that context shared by close
+	// matches is printed once, as grep -C does
+	var lastFile string
+	lastLine := 0
+	for i, m := range matches {
+		var tag, repoPrefix string
+		if m.New {
+			tag = newColor("[NEW] ")
+		}
+		if m.Rule != "" {
+			tag += severityColor(m.Severity)("[" + ruleLabel(m) + "] ")
+		} else if m.Pattern != "" {
+			tag += patternColor("[" + m.Pattern + "] ")
+		}
+		if m.Repo != "" {
+			repoPrefix = m.Repo + ":"
+		}
+		if m.Binary {
+			fmt.Fprintf(w, "%s%s%s:%s (%s)\n", tag, repoPrefix, branchColor(m.Branch), m.File, binaryMatchText)
+			continue
+		}
+		if m.Commit != "" {
+			var by string
+			if m.Date != "" {
+				by = " " + blameColor(fmt.Sprintf("(%s %s)", m.Author, m.Date))
+			}
+			fmt.Fprintf(w, "%s%s%s:%s: %s%s\n", tag, repoPrefix, branchColor(m.Branch), lineNumColor(shortSHA(m.Commit)), highlightLine(re, m.Text), by)
+			continue
+		}
+		var blame string
+		if m.BlameCommit != "" {
+			blame = " " + blameColor(fmt.Sprintf("(%s %s %s)", shortSHA(m.BlameCommit), m.Author, m.BlameDate))
+		}
+		file := m.label() + "\x00" + m.File
+		if file != lastFile {
+			lastFile, lastLine = file, 0
+		}
+		// Context lines are marked with a dash, as grep -C does, and dimmed
+		for j, text := range m.BeforeContext {
+			if n := m.Line - len(m.BeforeContext) + j; n > lastLine {
+				fmt.Fprintf(w, "%s%s:%s%s %s\n", repoPrefix, branchColor(m.Branch), m.File, lineNumColor(fmt.Sprintf("-%d", n)), contextColor(text))
+			}
+		}
+		fmt.Fprintf(w, "%s%s%s:%s%s %s%s\n",
+			tag,
+			repoPrefix,
+			branchColor(m.Branch),
+			m.File, lineNumColor(fmt.Sprintf(":%d", m.Line)),
+			highlightLine(re, m.Text),
+			blame,
+		)
+		lastLine = m.Line
+		for j, text := range m.AfterContext {
+			n := m.Line + 1 + j
+			if i+1 < len(matches) && matches[i+1].label()+"\x00"+matches[i+1].File == file && n >= matches[i+1].Line {
+				// The next match prints the rest
+				break
+			}
+			fmt.Fprintf(w, "%s%s:%s%s %s\n", repoPrefix, branchColor(m.Branch), m.File, lineNumColor(fmt.Sprintf("-%d", n)), contextColor(text))
+			lastLine = n
+		}
+		if m.moreInFile > 0 {
+			fmt.Fprintf(w, "  … (%d more in this file)\n", m.moreInFile)
+		}
+	}
+}
+
+// shortSHA abbreviates a commit SHA for display.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// emitMatches streams the matches of one branch in text mode, or as records
+// with ndjson-with-summary or grep. Other structured formats are rendered
+// once at the end of the run instead. Stdout is not buffered, so every
+// branch's matches reach a pipe as soon as the branch is done; keep it that
+// way rather than adding a flush interval.
+func emitMatches(opts *Options, res *Result, matches []Match) {
+	if opts.Sample > 0 || opts.Aggregate {
+		// Held back until finishRun has drawn the sample or merged the branches
+		return
+	}
+	matches = displayMatches(opts, res, matches)
+	switch opts.OutputFormat {
+	case "ndjson-with-summary":
+		_ = writeNDJSONMatches(matchOutput, matches, opts.Fields)
+		return
+	case "grep":
+		printGrepMatches(matchOutput, opts, matches)
+		return
+	}
+	if !opts.streamsText() || len(matches) == 0 {
+		return
+	}
+	if res.emittedGroups > 0 {
+		if sep, ok := opts.branchSeparator(); ok {
+			fmt.Fprintln(matchOutput, sep)
+		}
+	}
+	res.emittedGroups++
+	if opts.filesOnly() {
+		printMatchingFiles(matchOutput, opts, matches)
+		return
+	}
+	omitted := 0
+	if opts.MaxPerBranch > 0 && len(matches) > opts.MaxPerBranch {
+		omitted = len(matches) - opts.MaxPerBranch
+		matches = matches[:opts.MaxPerBranch]
+	}
+	printTextMatches(matchOutput, opts.re, matches)
+	if omitted > 0 {
+		fmt.Fprintf(matchOutput, "… (%s more matches omitted, --max-matches-per-branch)\n", groupThousands(omitted))
+	}
+}
+
+// groupThousands formats n with commas between groups of three digits, e.g.
+// 1,250.
+func groupThousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// printMatchingFiles writes each file with matches once, as `branch:file` lines
+// or, with --print0, as NUL-terminated `branch\0file\0` records.
+func printMatchingFiles(w io.Writer, opts *Options, matches []Match) {
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		if m.File == "" || seen[m.File] {
+			continue
+		}
+		seen[m.File] = true
+		if opts.Print0 {
+			fmt.Fprintf(w, "%s\x00%s\x00", m.label(), m.File)
+		} else {
+			fmt.Fprintf(w, "%s:%s\n", branchColor(m.label()), m.File)
+		}
+	}
+}
+
+// outputFormats lists the accepted values of --output-format.
+var outputFormats = []string{"text", "table", "count", "count-table", "summary", "xml", "junit", "html", "csv-wide", "ndjson-with-summary", "diffstat", "grep", "sarif", "yaml", "slack", "csv", "json"}
+
+// streamsText reports whether matches are printed per branch as they are found
+// rather than rendered once at the end of the run.
+func (o *Options) streamsText() bool {
+	return o.OutputFormat == "text"
+}
+
+// pathStyles lists the accepted values of --path-style.
+var pathStyles = []string{"relative", "absolute", "branch-qualified"}
+
+// displayMatches returns copies of matches whose File is rendered according to
+// --path-style. Matches keep repo-relative paths everywhere else, e.g. for
+// git blame, the cache and the checkpoint.
+func displayMatches(opts *Options, res *Result, matches []Match) []Match {
+	if opts.PathStyle == "relative" || opts.PathStyle == "" {
+		return matches
+	}
+	shown := make([]Match, len(matches))
+	for i, m := range matches {
+		// Dangling blobs have no path
+		if m.File != "" && !strings.HasPrefix(m.File, "blob:") {
+			switch opts.PathStyle {
+			case "absolute":
+				if root, ok := res.worktreePaths[m.label()]; ok {
+					m.File = filepath.Join(root, filepath.FromSlash(m.File))
+				} else if root, ok := res.repoPaths[m.Repo]; ok {
+					m.File = filepath.Join(root, filepath.FromSlash(m.File))
+				} else if abs, err := filepath.Abs(m.File); err == nil {
+					m.File = abs
+				}
+			case "branch-qualified":
+				m.File = m.label() + ":" + m.File
+			}
+		}
+		shown[i] = m
+	}
+	return shown
+}
+
+// renderResults writes the buffered results in one of the structured formats.
+func renderResults(w io.Writer, opts *Options, res *Result) error {
+	switch opts.OutputFormat {
+	case "count":
+		return renderBranchCounts(w, opts, res)
+	case "count-table":
+		return renderCountTable(w, opts, res)
+	case "summary":
+		return renderSummaryJSON(w, res, opts.ValidateOutput)
+	case "table":
+		return renderTable(w, res)
+	case "xml":
+		return renderXML(w, res)
+	case "junit":
+		return renderJUnit(w, opts, res)
+	case "html":
+		return renderHTML(w, opts, res)
+	case "csv-wide":
+		return renderCSVWide(w, res)
+	case "ndjson-with-summary":
+		return renderNDJSONSummary(w, res)
+	case "diffstat":
+		return renderDiffstat(w, opts, res)
+	case "sarif":
+		return renderSARIF(w, opts, res)
+	case "yaml":
+		return renderYAML(w, res)
+	case "slack":
+		return renderSlack(w, opts, res)
+	case "csv":
+		return renderCSV(w, opts, res)
+	case "json":
+		return renderJSON(w, res)
+	case "grep":
+		// Streamed per branch, there is no summary to add
+		return nil
+	}
+	return fmt.Errorf("unsupported output format: %s", opts.OutputFormat)
+}
+
+type xmlResults struct {
+	XMLName             xml.Name   `xml:"results"`
+	TotalMatches        int        `xml:"total,attr"`
+	BranchesSearched    int        `xml:"branches_searched,attr"`
+	BranchesWithMatches int        `xml:"branches_with_matches,attr"`
+	Matches             []xmlMatch `xml:"match"`
+}
+
+type xmlMatch struct {
+	Repo     string `xml:"repo,attr,omitempty"`
+	Branch   string `xml:"branch,attr"`
+	File     string `xml:"file,attr,omitempty"`
+	Commit   string `xml:"commit,attr,omitempty"`
+	Pattern  string `xml:"pattern,attr,omitempty"`
+	Rule     string `xml:"rule,attr,omitempty"`
+	Severity string `xml:"severity,attr,omitempty"`
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Author   string `xml:"author,attr,omitempty"`
+	New      bool   `xml:"new,attr,omitempty"`
+	Binary   bool   `xml:"binary,attr,omitempty"`
+	Base64   string `xml:"text_base64,attr,omitempty"`
+	Text     string `xml:",chardata"`
+}
+
+func renderXML(w io.Writer, res *Result) error {
+	doc := xmlResults{
+		TotalMatches:        res.Summary.TotalMatches,
+		BranchesSearched:    res.Summary.BranchesSearched,
+		BranchesWithMatches: res.Summary.BranchesWithMatches,
+	}
+	for _, m := range res.Matches {
+		doc.Matches = append(doc.Matches, xmlMatch{
+			Repo:     m.Repo,
+			Branch:   m.Branch,
+			File:     m.File,
+			Commit:   m.Commit,
+			Pattern:  m.Pattern,
+			Rule:     m.Rule,
+			Severity: m.Severity,
+			Line:     m.Line,
+			Column:   m.Column,
+			Author:   m.Author,
+			New:      m.New,
+			Binary:   m.Binary,
+			Base64:   m.TextBase64,
+			Text:     m.Text,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// renderCSVWide writes one CSV row per file with a match count column for
+// every searched branch, suited for spreadsheet heatmaps. Files without
+// matches on a branch get 0. Commit and note matches have no file and are
+// left out.
+func renderCSVWide(w io.Writer, res *Result) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"file"}
+	column := make(map[string]int, len(res.Branches))
+	for _, b := range res.Branches {
+		label := b.Branch
+		if b.Repo != "" {
+			label = b.Repo + ":" + b.Branch
+		}
+		if _, ok := column[label]; ok {
+			continue
+		}
+		column[label] = len(header) - 1
+		header = append(header, label)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	var files []string
+	counts := make(map[string][]int)
+	for _, m := range res.Matches {
+		if m.File == "" || m.Commit != "" {
+			continue
+		}
+		file := m.File
+		if m.Repo != "" {
+			file = m.Repo + ":" + file
+		}
+		if _, ok := counts[file]; !ok {
+			files = append(files, file)
+			counts[file] = make([]int, len(header)-1)
+		}
+		counts[file][column[m.label()]]++
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		row := []string{file}
+		for _, n := range counts[file] {
+			row = append(row, strconv.Itoa(n))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// renderCSV writes one CSV row per match. With --context the rows carry the
+// surrounding lines in before_context and after_context, one line per line
+// of the cell; quoting keeps such cells intact in spreadsheets.
+func renderCSV(w io.Writer, opts *Options, res *Result) error {
+	cw := csv.NewWriter(w)
+	header := []string{"repo", "branch", "file", "line", "column", "commit", "rule", "severity", "text"}
+	if opts.ContextLines > 0 {
+		header = append(header, "before_context", "after_context")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, m := range res.Matches {
+		var line, column string
+		if m.Line > 0 {
+			line = strconv.Itoa(m.Line)
+		}
+		if m.Column > 0 {
+			column = strconv.Itoa(m.Column)
+		}
+		text := m.Text
+		if m.Binary {
+			text = binaryMatchText
+		}
+		row := []string{m.Repo, m.Branch, m.File, line, column, m.Commit, m.Rule, m.Severity, text}
+		if opts.ContextLines > 0 {
+			row = append(row, strings.Join(m.BeforeContext, "\n"), strings.Join(m.AfterContext, "\n"))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
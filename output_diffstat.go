@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// lastRunFile holds the per-branch counts of the previous run in a
+// --cache-dir key directory, for --output-format diffstat.
+const lastRunFile = "last-run.json"
+
+// loadLastRun returns the per-branch counts recorded by the previous run with
+// the same search options, or nil if there was none.
+func loadLastRun(opts *Options) ([]BranchResult, error) {
+	dir, err := cacheKeyDir(opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, lastRunFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous run: %v", err)
+	}
+	var branches []BranchResult
+	if err := json.Unmarshal(data, &branches); err != nil {
+		return nil, fmt.Errorf("failed to parse previous run: %v", err)
+	}
+	return branches, nil
+}
+
+// saveLastRun records the per-branch counts of this run for the next diffstat.
+func saveLastRun(opts *Options, res *Result) error {
+	dir, err := cacheKeyDir(opts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	branches := res.Branches
+	if branches == nil {
+		branches = []BranchResult{}
+	}
+	data, err := json.Marshal(branches)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, lastRunFile)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to record run: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// formatDelta renders a count change as +N, -N or 0.
+func formatDelta(n int) string {
+	if n > 0 {
+		return fmt.Sprintf("+%d", n)
+	}
+	return fmt.Sprint(n)
+}
+
+// renderDiffstat compares the per-branch counts of this run with the previous
+// run recorded in --cache-dir. Growing counts are shown in the match color,
+// branches that are gone are listed with their old count.
+func renderDiffstat(w io.Writer, opts *Options, res *Result) error {
+	previous, err := loadLastRun(opts)
+	if err != nil {
+		return err
+	}
+	before := make(map[string]int, len(previous))
+	for _, b := range previous {
+		before[Match{Repo: b.Repo, Branch: b.Branch}.label()] = b.Matches
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", headerColor("Branch"), headerColor("Previous"), headerColor("Current"), headerColor("Change"))
+	var totalBefore, totalNow int
+	seen := make(map[string]bool, len(res.Branches))
+	for _, b := range res.Branches {
+		label := Match{Repo: b.Repo, Branch: b.Branch}.label()
+		seen[label] = true
+		old, ok := before[label]
+		prevCol := fmt.Sprint(old)
+		if !ok {
+			prevCol = "-"
+		}
+		delta := formatDelta(b.Matches - old)
+		if b.Matches > old {
+			delta = matchColor(delta)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", branchColor(label), prevCol, b.Matches, delta)
+		totalBefore += old
+		totalNow += b.Matches
+	}
+	for _, b := range previous {
+		label := Match{Repo: b.Repo, Branch: b.Branch}.label()
+		if seen[label] {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t-\t%s\n", branchColor(label), b.Matches, formatDelta(-b.Matches))
+		totalBefore += b.Matches
+	}
+	fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", headerColor("Total"), totalBefore, totalNow, formatDelta(totalNow-totalBefore))
+	if previous == nil {
+		fmt.Fprintln(tw, "(no previous run with these options; counts are compared against 0)")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// unsafeFileChars matches the characters replaced when a branch name is
+// turned into a file name.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// outputExtension returns the file extension used by --output-dir for format.
+func outputExtension(format string) string {
+	switch format {
+	case "summary", "slack", "json":
+		return ".json"
+	case "xml", "junit":
+		return ".xml"
+	case "html":
+		return ".html"
+	case "csv", "csv-wide":
+		return ".csv"
+	case "ndjson-with-summary":
+		return ".ndjson"
+	case "sarif":
+		return ".sarif"
+	case "yaml":
+		return ".yaml"
+	}
+	return ".txt"
+}
+
+// branchFileName turns branch into a safe file name, e.g. feature/login
+// becomes feature_login. Names already handed out get a numeric suffix so two
+// branches never share a file.
+func (r *Result) branchFileName(repo, branch, ext string) string {
+	base := strings.Trim(unsafeFileChars.ReplaceAllString(branch, "_"), "._")
+	if base == "" {
+		base = "branch"
+	}
+	if repo != "" {
+		base = unsafeFileChars.ReplaceAllString(repo, "_") + "_" + base
+	}
+	if r.outputFiles == nil {
+		r.outputFiles = make(map[string]bool)
+	}
+	name := base + ext
+	for i := 2; r.outputFiles[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	r.outputFiles[name] = true
+	return name
+}
+
+// writeBranchFile writes the matches of a single branch to its own file in
+// --output-dir, rendered in the selected output format without colors.
+func writeBranchFile(opts *Options, res *Result, repo, branch string, matches []Match) error {
+	if err := os.MkdirAll(opts.OutputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	path := filepath.Join(opts.OutputDir, res.branchFileName(repo, branch, outputExtension(opts.OutputFormat)))
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer f.Close()
+
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	matches = displayMatches(opts, res, matches)
+	switch {
+	case opts.streamsText() && opts.filesOnly():
+		printMatchingFiles(f, opts, matches)
+	case opts.streamsText():
+		printTextMatches(f, opts.re, matches)
+	case opts.OutputFormat == "grep":
+		printGrepMatches(f, opts, matches)
+	case opts.OutputFormat == "ndjson-with-summary":
+		if err := writeNDJSONMatches(f, matches, opts.Fields); err != nil {
+			return err
+		}
+		branchRes := &Result{}
+		branchRes.addBranch(repo, branch, matches)
+		branchRes.Summary.Repositories = 1
+		if err := renderNDJSONSummary(f, branchRes); err != nil {
+			return err
+		}
+	default:
+		branchRes := &Result{invalidUTF8: opts.InvalidUTF8, occurrenceRE: opts.occurrenceRE()}
+		branchRes.addBranch(repo, branch, matches)
+		branchRes.Summary.Repositories = 1
+		if err := renderResults(f, opts, branchRes); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
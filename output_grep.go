@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// printGrepMatches writes matches the way plain grep does, as uncolored
+// `file:line:text` lines, for --output-format grep. With --with-branch every
+// line starts with `branch:` like git grep output for a revision. Commit
+// message matches have no file and are written as `commit:text`.
+func printGrepMatches(w io.Writer, opts *Options, matches []Match) {
+	for _, m := range matches {
+		var prefix string
+		if opts.WithBranch {
+			prefix = m.label() + ":"
+		}
+		switch {
+		case m.Binary:
+			fmt.Fprintf(w, "Binary file %s%s matches\n", prefix, m.File)
+		case m.File == "" && m.Commit != "":
+			fmt.Fprintf(w, "%s%s:%s\n", prefix, m.Commit, m.Text)
+		default:
+			fmt.Fprintf(w, "%s%s:%d:%s\n", prefix, m.File, m.Line, m.Text)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// htmlReport is the data rendered by htmlTemplate.
+type htmlReport struct {
+	Patterns string
+	Summary  Summary
+	Branches []htmlBranch
+	Errors   []string
+}
+
+type htmlBranch struct {
+	Name    string
+	Matches []htmlMatch
+}
+
+type htmlMatch struct {
+	Location string
+	Rule     string
+	Severity string
+	Text     template.HTML
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>git-regex-search: {{.Patterns}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.8em; text-align: left; }
+th { background: #f6f8fa; }
+details { margin: 0.4em 0; }
+summary { cursor: pointer; font-weight: 600; }
+.count { color: #57606a; font-weight: normal; }
+pre { background: #f6f8fa; padding: 0.2em 0.5em; margin: 0.2em 0; white-space: pre-wrap; word-break: break-all; }
+.loc { color: #0969da; }
+mark { background: #fff8c5; color: #cf222e; font-weight: 600; }
+.errors { color: #cf222e; }
+.sev-info { color: #0969da; }
+.sev-low { color: #1a7f37; }
+.sev-medium { color: #9a6700; }
+.sev-high, .sev-critical { color: #cf222e; font-weight: 600; }
+</style>
+</head>
+<body>
+<h1>git-regex-search report</h1>
+<p>Pattern: <code>{{.Patterns}}</code></p>
+<table>
+<tr><th>Matches</th><th>Branches with matches</th><th>Branches searched</th><th>Repositories</th></tr>
+<tr><td>{{.Summary.TotalMatches}}</td><td>{{.Summary.BranchesWithMatches}}</td><td>{{.Summary.BranchesSearched}}</td><td>{{.Summary.Repositories}}</td></tr>
+</table>
+{{if .Summary.Stopped}}<p>The search was stopped early.</p>
+{{end}}{{range .Branches}}<details{{if .Matches}} open{{end}}>
+<summary>{{.Name}} <span class="count">({{len .Matches}} matches)</span></summary>
+{{range .Matches}}<pre>{{if .Rule}}<span class="sev-{{.Severity}}">[{{.Severity}}:{{.Rule}}]</span> {{end}}<span class="loc">{{.Location}}</span> {{.Text}}</pre>
+{{end}}</details>
+{{end}}{{if .Errors}}<h2>Errors</h2>
+<ul class="errors">
+{{range .Errors}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// highlightHTML escapes s and wraps every match of re in <mark>.
+func highlightHTML(re *regexp.Regexp, s string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if loc[1] == loc[0] {
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(s[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(s[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(s[last:]))
+	return template.HTML(b.String())
+}
+
+// renderHTML writes a self-contained HTML report with a summary table and one
+// collapsible section per searched branch.
+func renderHTML(w io.Writer, opts *Options, res *Result) error {
+	report := htmlReport{
+		Patterns: opts.patternLabel(),
+		Summary:  res.Summary,
+		Errors:   res.Errors,
+	}
+
+	byBranch := map[string][]Match{}
+	for _, m := range res.Matches {
+		k := m.Repo + "\x00" + m.Branch
+		byBranch[k] = append(byBranch[k], m)
+	}
+	for _, b := range res.Branches {
+		branch := htmlBranch{Name: b.Branch}
+		if b.Repo != "" {
+			branch.Name = b.Repo + ":" + b.Branch
+		}
+		for _, m := range byBranch[b.Repo+"\x00"+b.Branch] {
+			hm := htmlMatch{Location: junitCaseName(m), Rule: m.Rule, Severity: m.Severity}
+			switch {
+			case m.Binary:
+				hm.Text = template.HTML(template.HTMLEscapeString(binaryMatchText))
+			case opts.re != nil:
+				hm.Text = highlightHTML(opts.re, m.Text)
+			default:
+				hm.Text = template.HTML(template.HTMLEscapeString(m.Text))
+			}
+			branch.Matches = append(branch.Matches, hm)
+		}
+		report.Branches = append(report.Branches, branch)
+	}
+	return htmlTemplate.Execute(w, report)
+}
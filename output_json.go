@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonDocument is the single document written by --output-format json.
+type jsonDocument struct {
+	Matches  []Match        `json:"matches"`
+	Summary  Summary        `json:"summary"`
+	Branches []BranchResult `json:"branches"`
+	Errors   []string       `json:"errors"`
+}
+
+// renderJSON writes all matches and the summary as one indented JSON
+// document. Matches carry the fields of the ndjson-with-summary records, so a
+// consumer can switch between the two formats without renaming anything.
+func renderJSON(w io.Writer, res *Result) error {
+	doc := jsonDocument{Matches: res.Matches, Summary: res.Summary, Branches: res.Branches, Errors: res.Errors}
+	if doc.Matches == nil {
+		doc.Matches = []Match{}
+	}
+	if doc.Branches == nil {
+		doc.Branches = []BranchResult{}
+	}
+	if doc.Errors == nil {
+		doc.Errors = []string{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// renderJUnit writes the result as a JUnit XML report: every branch is a
+// testsuite and every match a failing testcase in it. Branches without matches
+// get a single passing testcase so they still show up in test dashboards.
+func renderJUnit(w io.Writer, opts *Options, res *Result) error {
+	doc := junitTestSuites{Name: "git-regex-search: " + opts.patternLabel()}
+
+	byBranch := map[string][]Match{}
+	for _, m := range res.Matches {
+		k := m.Repo + "\x00" + m.Branch
+		byBranch[k] = append(byBranch[k], m)
+	}
+	for _, b := range res.Branches {
+		name := b.Branch
+		if b.Repo != "" {
+			name = b.Repo + ":" + b.Branch
+		}
+		suite := junitTestSuite{Name: name}
+		for _, m := range byBranch[b.Repo+"\x00"+b.Branch] {
+			failure := &junitFailure{Message: "pattern matched", Text: m.Text}
+			if m.Rule != "" {
+				failure.Message = fmt.Sprintf("rule %s matched (%s)", m.Rule, m.Severity)
+				failure.Type = m.Severity
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      junitCaseName(m),
+				Classname: name,
+				Failure:   failure,
+			})
+			suite.Failures++
+		}
+		if len(suite.Cases) == 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{Name: "no matches", Classname: name})
+		}
+		suite.Tests = len(suite.Cases)
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Suites = append(doc.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitCaseName identifies a match within its branch.
+func junitCaseName(m Match) string {
+	if m.Commit != "" {
+		return "commit " + shortSHA(m.Commit)
+	}
+	if m.Binary {
+		return m.File
+	}
+	return fmt.Sprintf("%s:%d", m.File, m.Line)
+}
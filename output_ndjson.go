@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ndjsonMatch is a match record of --output-format ndjson-with-summary.
+type ndjsonMatch struct {
+	Type string `json:"type"`
+	Match
+}
+
+// ndjsonSummary is the final record of --output-format ndjson-with-summary.
+type ndjsonSummary struct {
+	Type string `json:"type"`
+	Summary
+	Branches []BranchResult `json:"branches"`
+	Errors   []string       `json:"errors"`
+}
+
+// writeNDJSONMatches writes one {"type":"match",...} line per match, limited
+// to fields when --fields is set.
+func writeNDJSONMatches(w io.Writer, matches []Match, fields []string) error {
+	enc := json.NewEncoder(w)
+	for _, m := range matches {
+		if len(fields) > 0 {
+			line, err := projectMatch(m, fields)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := enc.Encode(ndjsonMatch{Type: "match", Match: m}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderNDJSONSummary writes the {"type":"summary",...} trailer that ends an
+// ndjson-with-summary stream. The match records were already streamed per
+// branch by emitMatches.
+func renderNDJSONSummary(w io.Writer, res *Result) error {
+	doc := ndjsonSummary{Type: "summary", Summary: res.Summary, Branches: res.Branches, Errors: res.Errors}
+	if doc.Branches == nil {
+		doc.Branches = []BranchResult{}
+	}
+	if doc.Errors == nil {
+		doc.Errors = []string{}
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// matchFieldIndex maps the JSON field names of Match to their struct field
+// index, for --fields.
+var matchFieldIndex = func() map[string]int {
+	index := make(map[string]int)
+	t := reflect.TypeOf(Match{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			index[name] = i
+		}
+	}
+	return index
+}()
+
+// matchFieldNames returns the names accepted by --fields, sorted.
+func matchFieldNames() []string {
+	names := make([]string, 0, len(matchFieldIndex))
+	for name := range matchFieldIndex {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// projectMatch encodes the fields of m selected with --fields, in the order
+// they were given. Unlike the full record, empty fields are kept so that every
+// line has the same keys.
+func projectMatch(m Match, fields []string) ([]byte, error) {
+	v := reflect.ValueOf(m)
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"match"`)
+	for _, name := range fields {
+		value, err := json.Marshal(v.Field(matchFieldIndex[name]).Interface())
+		if err != nil {
+			return nil, err
+		}
+		key, _ := json.Marshal(name)
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
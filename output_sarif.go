@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// sarifLog is the document of --output-format sarif, a SARIF 2.1.0 log with a
+// single run.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+// sarifRule describes a --rule, or a plain --regex pattern, once; results
+// refer to it by id and index.
+type sarifRule struct {
+	ID                   string               `json:"id"`
+	Name                 string               `json:"name,omitempty"`
+	ShortDescription     sarifText            `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration   `json:"defaultConfiguration"`
+	Properties           *sarifRuleProperties `json:"properties,omitempty"`
+}
+
+type sarifRuleProperties struct {
+	// SecuritySeverity is the score GitHub code scanning ranks alerts by.
+	SecuritySeverity string   `json:"security-severity"`
+	Tags             []string `json:"tags"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                `json:"ruleId"`
+	RuleIndex  int                   `json:"ruleIndex"`
+	Level      string                `json:"level"`
+	Message    sarifText             `json:"message"`
+	Locations  []sarifLocation       `json:"locations,omitempty"`
+	Properties sarifResultProperties `json:"properties"`
+}
+
+type sarifResultProperties struct {
+	Repo   string `json:"repo,omitempty"`
+	Branch string `json:"branch"`
+	Commit string `json:"commit,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// sarifLevels maps rule severities to SARIF result levels, and
+// sarifSecuritySeverities to the scores of GitHub code scanning.
+var (
+	sarifLevels = map[string]string{
+		"info": "note", "low": "note", "medium": "warning", "high": "error", "critical": "error",
+	}
+	sarifSecuritySeverities = map[string]string{
+		"info": "0.0", "low": "2.0", "medium": "5.0", "high": "8.0", "critical": "9.5",
+	}
+)
+
+// sarifRules returns the rules of the SARIF log: every --rule once, keyed by
+// its name, followed by the plain --regex patterns as pattern-1, pattern-2 and
+// so on. It also returns the index of the rule of every position in
+// opts.Patterns and of every --rule name.
+func sarifRules(opts *Options) ([]sarifRule, map[int]int, map[string]int) {
+	var rules []sarifRule
+	byPattern := make(map[int]int)
+	byName := make(map[string]int)
+	for _, r := range opts.Rules {
+		if i, ok := byName[r.Name]; ok {
+			// Several patterns for one rule
+			byPattern[r.index] = i
+			rules[i].ShortDescription.Text += " or " + r.Pattern
+			continue
+		}
+		byName[r.Name] = len(rules)
+		byPattern[r.index] = len(rules)
+		rules = append(rules, sarifRule{
+			ID:                   r.Name,
+			Name:                 r.Name,
+			ShortDescription:     sarifText{Text: fmt.Sprintf("Matches %s", r.Pattern)},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevels[r.Severity]},
+			Properties:           &sarifRuleProperties{SecuritySeverity: sarifSecuritySeverities[r.Severity], Tags: []string{r.Severity}},
+		})
+	}
+	plain := 0
+	for i, p := range opts.Patterns {
+		if _, ok := byPattern[i]; ok {
+			continue
+		}
+		plain++
+		byPattern[i] = len(rules)
+		rules = append(rules, sarifRule{
+			ID:                   "pattern-" + strconv.Itoa(plain),
+			ShortDescription:     sarifText{Text: fmt.Sprintf("Matches %s", p)},
+			DefaultConfiguration: sarifConfiguration{Level: "warning"},
+		})
+	}
+	return rules, byPattern, byName
+}
+
+// renderSARIF writes the result as a SARIF 2.1.0 log for code scanning tools.
+// Each rule is described once under tool.driver.rules and every match is a
+// result referring to it, with the branch it was found on as a property.
+func renderSARIF(w io.Writer, opts *Options, res *Result) error {
+	rules, byPattern, byName := sarifRules(opts)
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "git-regex-search", Version: version, Rules: rules}},
+		Results: []sarifResult{},
+	}
+	for _, m := range res.Matches {
+		index, ok := byName[m.Rule]
+		if !ok {
+			index = byPattern[max(opts.patternFor(m.Text), 0)]
+		}
+		result := sarifResult{
+			RuleID:     rules[index].ID,
+			RuleIndex:  index,
+			Level:      rules[index].DefaultConfiguration.Level,
+			Message:    sarifText{Text: fmt.Sprintf("%s matched on %s: %s", rules[index].ID, m.label(), m.Text)},
+			Properties: sarifResultProperties{Repo: m.Repo, Branch: m.Branch, Commit: m.Commit},
+		}
+		if m.Binary {
+			result.Message.Text = fmt.Sprintf("%s matched on %s in a binary file", rules[index].ID, m.label())
+		}
+		if m.File != "" {
+			loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: sarifURI(m.File)}}
+			if !m.Binary && m.Line > 0 {
+				loc.Region = &sarifRegion{StartLine: m.Line, StartColumn: m.Column}
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: loc}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	doc := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// sarifURI returns file as a SARIF artifact URI: relative paths stay relative
+// to the repository root, absolute ones (--path-style absolute) become file
+// URIs.
+func sarifURI(file string) string {
+	if filepath.IsAbs(file) {
+		return "file://" + filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(file)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+// TestSARIFStructure checks the parts of the SARIF 2.1.0 schema that code
+// scanning relies on, and that every rule is defined once.
+func TestSARIFStructure(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "key AKIA1234567890ABCDEF\n// TODO tidy\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "FIXME later\nTODO again\n"}},
+	)
+	out, err := runApp(t, "--repo", repo, "--checkout-strategy", "none", "--output-format", "sarif",
+		"--rule", "aws-key:high:AKIA[0-9A-Z]{16}", "--rule", "todo:low:TODO", "--rule", "todo:low:FIXME", "--regex", "later")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	var doc struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID                   string                 `json:"id"`
+						ShortDescription     struct{ Text string }  `json:"shortDescription"`
+						DefaultConfiguration struct{ Level string } `json:"defaultConfiguration"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string                `json:"ruleId"`
+				RuleIndex int                   `json:"ruleIndex"`
+				Level     string                `json:"level"`
+				Message   struct{ Text string } `json:"message"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string } `json:"artifactLocation"`
+						Region           *struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if doc.Version != "2.1.0" || doc.Schema == "" {
+		t.Errorf("version = %q, $schema = %q, want a 2.1.0 log", doc.Version, doc.Schema)
+	}
+	if len(doc.Runs) != 1 {
+		t.Fatalf("%d runs, want 1", len(doc.Runs))
+	}
+	run := doc.Runs[0]
+	if run.Tool.Driver.Name == "" {
+		t.Error("tool.driver.name is empty")
+	}
+
+	levels := map[string]bool{"none": true, "note": true, "warning": true, "error": true}
+	var ids []string
+	seen := map[string]bool{}
+	for _, r := range run.Tool.Driver.Rules {
+		if seen[r.ID] {
+			t.Errorf("rule %s defined twice", r.ID)
+		}
+		seen[r.ID] = true
+		ids = append(ids, r.ID)
+		if r.ShortDescription.Text == "" || !levels[r.DefaultConfiguration.Level] {
+			t.Errorf("rule %s lacks a description or a valid level: %+v", r.ID, r)
+		}
+	}
+	if want := []string{"aws-key", "todo", "pattern-1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("rules = %v, want %v", ids, want)
+	}
+
+	counts := map[string]int{}
+	for _, res := range run.Results {
+		if res.RuleIndex < 0 || res.RuleIndex >= len(ids) || ids[res.RuleIndex] != res.RuleID {
+			t.Errorf("result refers to rule %s at index %d, which is not defined there", res.RuleID, res.RuleIndex)
+			continue
+		}
+		counts[res.RuleID]++
+		if !levels[res.Level] || res.Message.Text == "" {
+			t.Errorf("result of %s lacks a message or a valid level", res.RuleID)
+		}
+		if len(res.Locations) != 1 || res.Locations[0].PhysicalLocation.ArtifactLocation.URI == "" {
+			t.Errorf("result of %s lacks a location", res.RuleID)
+		} else if r := res.Locations[0].PhysicalLocation.Region; r == nil || r.StartLine < 1 {
+			t.Errorf("result of %s lacks a start line", res.RuleID)
+		}
+	}
+	// develop inherits a.txt; "FIXME later" is tagged by the todo rule
+	if want := map[string]int{"aws-key": 2, "todo": 4}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("results per rule = %v, want %v", counts, want)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Slack's limits for a message: blocks per message, characters of a header
+// and of a section's text.
+const (
+	slackMaxBlocks      = 50
+	slackMaxHeader      = 150
+	slackMaxSectionText = 3000
+)
+
+// slackPayload is the Block Kit message of --output-format slack. Text is the
+// fallback shown in notifications.
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// renderSlack writes a Block Kit payload with the summary and, per branch
+// with matches, its matching lines in a code block. What does not fit Slack's
+// limits is left out and counted in a closing note.
+func renderSlack(w io.Writer, opts *Options, res *Result) error {
+	return json.NewEncoder(w).Encode(slackMessage(opts, res))
+}
+
+func slackMessage(opts *Options, res *Result) slackPayload {
+	s := res.Summary
+	summary := fmt.Sprintf("*%d* matches in *%d* of *%d* branches", s.TotalMatches, s.BranchesWithMatches, s.BranchesSearched)
+	if s.Repositories > 1 {
+		summary += fmt.Sprintf(" across *%d* repositories", s.Repositories)
+	}
+	if s.BranchesTimedOut > 0 {
+		summary += fmt.Sprintf("\n:alarm_clock: %d branches timed out", s.BranchesTimedOut)
+	}
+	if s.Stopped {
+		summary += "\n:octagonal_sign: The search was stopped early"
+	}
+	if len(res.Errors) > 0 {
+		summary += fmt.Sprintf("\n:warning: %d warnings, e.g. %s", len(res.Errors), slackEscape(res.Errors[0]))
+	}
+	msg := slackPayload{
+		Text: fmt.Sprintf("git-regex-search: %d matches in %d of %d branches", s.TotalMatches, s.BranchesWithMatches, s.BranchesSearched),
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: truncateRunes("git-regex-search: "+opts.patternLabel(), slackMaxHeader)}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncateRunes(summary, slackMaxSectionText)}},
+		},
+	}
+
+	byBranch := make(map[string][]Match)
+	for _, m := range res.Matches {
+		byBranch[m.label()] = append(byBranch[m.label()], m)
+	}
+	var hiddenBranches []string
+	for _, b := range res.Branches {
+		label := Match{Repo: b.Repo, Branch: b.Branch}.label()
+		matches := byBranch[label]
+		if len(matches) == 0 {
+			continue
+		}
+		// Keep room for the closing note
+		if len(msg.Blocks) >= slackMaxBlocks-2 {
+			hiddenBranches = append(hiddenBranches, label)
+			continue
+		}
+		msg.Blocks = append(msg.Blocks,
+			slackBlock{Type: "divider"},
+			slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: slackBranchText(label, matches)}})
+	}
+	if len(hiddenBranches) > 0 {
+		msg.Blocks = append(msg.Blocks, slackBlock{Type: "context", Elements: []slackText{{
+			Type: "mrkdwn",
+			Text: truncateRunes(fmt.Sprintf("%d more branches with matches are not shown: %s", len(hiddenBranches), slackEscape(strings.Join(hiddenBranches, ", "))), slackMaxSectionText),
+		}}})
+	}
+	return msg
+}
+
+// slackBranchText lists the matches of a branch in a code block, as many as
+// fit into a section.
+func slackBranchText(label string, matches []Match) string {
+	head := fmt.Sprintf("*%s* — %d matches\n```", slackEscape(label), len(matches))
+	const tail = "```"
+	var body strings.Builder
+	budget := slackMaxSectionText - utf8.RuneCountInString(head) - len(tail)
+	for i, m := range matches {
+		line := slackEscape(slackMatchLine(m)) + "\n"
+		more := fmt.Sprintf("… and %d more\n", len(matches)-i)
+		if utf8.RuneCountInString(line)+utf8.RuneCountInString(more) > budget {
+			body.WriteString(more)
+			break
+		}
+		body.WriteString(line)
+		budget -= utf8.RuneCountInString(line)
+	}
+	return head + body.String() + tail
+}
+
+// slackMatchLine formats a match as a line of the code block, shortened so
+// that one long line does not fill the whole section. Backtick fences in the
+// text would end the code block and are broken up.
+func slackMatchLine(m Match) string {
+	text := strings.ReplaceAll(m.Text, "```", "`\u200b``")
+	switch {
+	case m.Commit != "":
+		return truncateRunes(fmt.Sprintf("%s: %s", shortSHA(m.Commit), text), 300)
+	case m.Binary:
+		return fmt.Sprintf("%s: binary file matches", m.File)
+	}
+	return truncateRunes(fmt.Sprintf("%s:%d: %s", m.File, m.Line, strings.TrimSpace(text)), 300)
+}
+
+// slackEscape escapes the characters Slack's mrkdwn reserves for links and
+// mentions.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// postWebhook posts payload to a Slack incoming webhook (--webhook-url).
+func postWebhook(url string, payload []byte) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to post to --webhook-url: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("--webhook-url answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
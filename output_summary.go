@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// summaryDocument is the aggregate-only report of --output-format summary.
+// Its JSON form is described by summary.schema.json; keep both in sync.
+type summaryDocument struct {
+	Summary
+	Branches []BranchResult `json:"branches"`
+	Files    map[string]int `json:"files"`
+	// Severities counts the matches per --rule severity.
+	Severities map[string]int `json:"severities,omitempty"`
+	Errors     []string       `json:"errors"`
+}
+
+// renderSummaryJSON writes the aggregate counts without the individual matches.
+// With validate set, the document is decoded again before it is written and
+// must reproduce the original exactly.
+func renderSummaryJSON(w io.Writer, res *Result, validate bool) error {
+	doc := summaryDocument{
+		Summary:  res.Summary,
+		Branches: res.Branches,
+		Files:    map[string]int{},
+		Errors:   res.Errors,
+	}
+	if counts := res.severityCounts(); len(counts) > 0 {
+		doc.Severities = counts
+	}
+	if doc.Branches == nil {
+		doc.Branches = []BranchResult{}
+	}
+	if doc.Errors == nil {
+		doc.Errors = []string{}
+	}
+	for _, m := range res.Matches {
+		if m.File == "" {
+			continue
+		}
+		file := m.File
+		if m.Repo != "" {
+			file = m.Repo + ":" + file
+		}
+		doc.Files[file]++
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if validate {
+		if err := validateJSON(buf.Bytes(), doc); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// validateJSON decodes data into a fresh value of want's type, rejecting
+// unknown fields, and checks that it round-trips to want.
+func validateJSON(data []byte, want interface{}) error {
+	got := reflect.New(reflect.TypeOf(want))
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(got.Interface()); err != nil {
+		return fmt.Errorf("output validation failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Elem().Interface(), want) {
+		return fmt.Errorf("output validation failed: decoded %T differs from the emitted one", want)
+	}
+	return nil
+}
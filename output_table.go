@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+var headerColor = color.New(color.Bold).SprintFunc()
+
+// defaultTableWidth is used when the terminal width cannot be detected.
+const defaultTableWidth = 120
+
+// tableWidth returns the width the table output should be fitted to.
+func tableWidth() int {
+	if w := terminalWidth(); w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return defaultTableWidth
+}
+
+// renderTable writes the matches as aligned Branch/File/Line/Match columns,
+// truncating the match text so that rows fit the terminal width. A Rule column
+// is added when --rule tagged any match.
+func renderTable(w io.Writer, res *Result) error {
+	const padding = 2
+	branchWidth, fileWidth, lineWidth, ruleWidth := len("Branch"), len("File"), len("Line"), 0
+	for _, m := range res.Matches {
+		branchWidth = max(branchWidth, utf8.RuneCountInString(m.label()))
+		fileWidth = max(fileWidth, utf8.RuneCountInString(m.File))
+		lineWidth = max(lineWidth, len(strconv.Itoa(m.Line)))
+		if m.Rule != "" {
+			ruleWidth = max(ruleWidth, len("Rule"), utf8.RuneCountInString(ruleLabel(m)))
+		}
+	}
+	textWidth := tableWidth() - branchWidth - fileWidth - lineWidth - 3*padding
+	if ruleWidth > 0 {
+		textWidth -= ruleWidth + padding
+	}
+	if textWidth < 10 {
+		textWidth = 10
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t", headerColor("Branch"), headerColor("File"), headerColor("Line"))
+	if ruleWidth > 0 {
+		fmt.Fprintf(tw, "%s\t", headerColor("Rule"))
+	}
+	fmt.Fprintf(tw, "%s\n", headerColor("Match"))
+	for _, m := range res.Matches {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t",
+			branchColor(m.label()),
+			m.File,
+			lineNumColor(strconv.Itoa(m.Line)),
+		)
+		if ruleWidth > 0 {
+			fmt.Fprintf(tw, "%s\t", severityColor(m.Severity)(ruleLabel(m)))
+		}
+		fmt.Fprintf(tw, "%s\n", truncateRunes(m.Text, textWidth))
+	}
+	return tw.Flush()
+}
+
+// ruleLabel returns the severity:rule tag of a match, or "" without a rule.
+func ruleLabel(m Match) string {
+	if m.Rule == "" {
+		return ""
+	}
+	return m.Severity + ":" + m.Rule
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with an ellipsis.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// renderCountTable writes a branch × pattern matrix of match counts with row
+// and column totals. A line matching several patterns counts for each of them.
+func renderCountTable(w io.Writer, opts *Options, res *Result) error {
+	counts := make(map[string][]int)
+	for _, m := range res.Matches {
+		row := counts[m.label()]
+		if row == nil {
+			row = make([]int, len(opts.patternREs))
+			counts[m.label()] = row
+		}
+		for i, re := range opts.patternREs {
+			if opts.CountOccurrences {
+				row[i] += len(re.FindAllStringIndex(m.Text, -1))
+			} else if re.MatchString(m.Text) {
+				row[i]++
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, headerColor("Branch"), "\t")
+	headers := append([]string(nil), opts.Patterns...)
+	for _, r := range opts.Rules {
+		headers[r.index] = r.Name
+	}
+	for _, h := range headers {
+		fmt.Fprint(tw, headerColor(h), "\t")
+	}
+	fmt.Fprintln(tw, headerColor("Total"), "\t")
+
+	colTotals := make([]int, len(opts.Patterns))
+	grandTotal := 0
+	for _, b := range res.Branches {
+		label := Match{Repo: b.Repo, Branch: b.Branch}.label()
+		row := counts[label]
+		fmt.Fprint(tw, branchColor(label), "\t")
+		rowTotal := 0
+		for i := range opts.Patterns {
+			n := 0
+			if row != nil {
+				n = row[i]
+			}
+			rowTotal += n
+			colTotals[i] += n
+			fmt.Fprint(tw, n, "\t")
+		}
+		grandTotal += rowTotal
+		fmt.Fprintln(tw, rowTotal, "\t")
+	}
+
+	fmt.Fprint(tw, headerColor("Total"), "\t")
+	for _, n := range colTotals {
+		fmt.Fprint(tw, n, "\t")
+	}
+	fmt.Fprintln(tw, grandTotal, "\t")
+	return tw.Flush()
+}
+
+// renderBranchCounts writes the --count overview: the number of matches on
+// every branch, most first (ties in search order), followed by the total.
+// Branches without matches are left out unless --count-all is set.
+func renderBranchCounts(w io.Writer, opts *Options, res *Result) error {
+	branches := append([]BranchResult(nil), res.Branches...)
+	sort.SliceStable(branches, func(i, j int) bool {
+		return branches[i].Matches > branches[j].Matches
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%s\t%s\t\n", headerColor("Branch"), headerColor("Matches"))
+	for _, b := range branches {
+		if b.Matches == 0 && !opts.CountAll {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t\n", branchColor(Match{Repo: b.Repo, Branch: b.Branch}.label()), b.Matches)
+	}
+	fmt.Fprintf(tw, "%s\t%d\t\n", headerColor("Total"), res.Summary.TotalMatches)
+	return tw.Flush()
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+// sampleResult returns a Result exercising most of the fields the machine
+// formats carry.
+func sampleResult() *Result {
+	return &Result{
+		Matches: []Match{
+			{Branch: "main", File: "a.txt", Line: 1, Column: 7, Text: "hello TODO world"},
+			{Repo: "api", Branch: "develop", File: "src/b.go", Line: 12, Text: "// TODO fix", Pattern: "TODO"},
+			{Branch: "main", File: "logo.png", Text: binaryMatchText, Binary: true},
+			{Branch: "main", Commit: "0123abcd", Text: "Add TODO list"},
+		},
+		Branches: []BranchResult{
+			{Branch: "main", Matches: 3},
+			{Repo: "api", Branch: "develop", Matches: 1},
+		},
+		Summary: Summary{TotalMatches: 4, BranchesSearched: 2, BranchesWithMatches: 2, Repositories: 2},
+		Errors:  []string{"repository broken skipped: not a git repository"},
+	}
+}
+
+func TestRenderSummaryJSONValidates(t *testing.T) {
+	tests := []struct {
+		name      string
+		res       *Result
+		wantFiles map[string]int
+	}{
+		{name: "matches", res: sampleResult(), wantFiles: map[string]int{"a.txt": 1, "api:src/b.go": 1, "logo.png": 1}},
+		{name: "empty", res: &Result{}, wantFiles: map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := renderResults(&buf, &Options{OutputFormat: "summary", ValidateOutput: true}, tt.res); err != nil {
+				t.Fatalf("--validate-output rejected the summary: %v", err)
+			}
+			var got summaryDocument
+			dec := json.NewDecoder(&buf)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&got); err != nil {
+				t.Fatalf("output does not decode: %v", err)
+			}
+			if got.Summary != tt.res.Summary {
+				t.Errorf("summary = %+v, want %+v", got.Summary, tt.res.Summary)
+			}
+			wantBranches := tt.res.Branches
+			if wantBranches == nil {
+				wantBranches = []BranchResult{}
+			}
+			if !reflect.DeepEqual(got.Branches, wantBranches) {
+				t.Errorf("branches = %+v, want %+v", got.Branches, wantBranches)
+			}
+			if !reflect.DeepEqual(got.Files, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", got.Files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	want := summaryDocument{Summary: Summary{TotalMatches: 1}, Branches: []BranchResult{}, Files: map[string]int{"a.txt": 1}, Errors: []string{}}
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "same document", data: `{"total_matches":1,"branches_searched":0,"branches_with_matches":0,"repositories":0,"branches":[],"files":{"a.txt":1},"errors":[]}`},
+		{name: "different count", data: `{"total_matches":2,"branches_searched":0,"branches_with_matches":0,"repositories":0,"branches":[],"files":{"a.txt":1},"errors":[]}`, wantErr: true},
+		{name: "unknown field", data: `{"total_matches":1,"branches":[],"files":{"a.txt":1},"errors":[],"extra":true}`, wantErr: true},
+		{name: "malformed", data: `{"total_matches":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJSON([]byte(tt.data), want)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout, which is a pipe meanwhile,
+// as when output is redirected.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stdout, f)
+}
+
+// captureFile returns what f writes to *file, such as os.Stderr, which is a
+// pipe meanwhile.
+func captureFile(t *testing.T, file **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	defer func() { *file = saved }()
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+	f()
+	w.Close()
+	out := <-done
+	r.Close()
+	return string(out)
+}
+
+func TestTextOutputColors(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	t.Setenv("NO_COLOR", "")
+	os.Unsetenv("NO_COLOR")
+	t.Setenv("TERM", "xterm")
+
+	tests := []struct {
+		mode        string
+		wantEscapes bool
+	}{
+		{mode: "never"},
+		// stdout is a pipe while the mode is set, as when output is captured
+		{mode: "auto"},
+		{mode: "always", wantEscapes: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			out := captureStdout(t, func() {
+				setColorMode(tt.mode)
+				matches := append(sampleResult().Matches, Match{Branch: "main", File: "c.txt", Line: 2, Text: "TODO again", New: true})
+				printTextMatches(os.Stdout, regexp.MustCompile("TODO"), matches)
+			})
+			if got := strings.Contains(out, "\x1b["); got != tt.wantEscapes {
+				t.Errorf("--color %s: output contains ANSI escapes = %v, want %v:\n%q", tt.mode, got, tt.wantEscapes, out)
+			}
+		})
+	}
+}
+
+func TestParallelOutputInBranchOrder(t *testing.T) {
+	// Earlier branches have more files to search, so that later ones tend to
+	// finish first, the more so when --concurrency-order by-size starts them
+	// first
+	branches := []gitfixture.Branch{{Name: "main", Files: map[string]string{"README": "nothing here\n"}}}
+	var names []string
+	for i := 1; i <= 8; i++ {
+		name := fmt.Sprintf("b%d", i)
+		files := map[string]string{}
+		for j := 0; j < 4*(9-i); j++ {
+			files[fmt.Sprintf("%s/f%d.txt", name, j)] = "TODO on " + name + "\n"
+		}
+		branches = append(branches, gitfixture.Branch{Name: name, Files: files})
+		names = append(names, name)
+	}
+	repo := gitfixture.New(t, branches...)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "sequential", args: []string{"--checkout-strategy", "none"}},
+		{name: "git grep", args: []string{"--checkout-strategy", "none", "--max-branches-parallel", "4"}},
+		{name: "worktrees", args: []string{"--checkout-strategy", "worktree", "--max-branches-parallel", "3"}},
+		{name: "git grep by size", args: []string{"--checkout-strategy", "none", "--max-branches-parallel", "4", "--concurrency-order", "by-size"}},
+		{name: "worktrees by size", args: []string{"--checkout-strategy", "worktree", "--max-branches-parallel", "3", "--concurrency-order", "by-size"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for run := 0; run < 3; run++ {
+				args := append([]string{"--repo", repo, "--regex", "TODO", "--output-format", "ndjson-with-summary"}, tt.args...)
+				out, err := runApp(t, args...)
+				if err != nil {
+					t.Fatalf("run failed: %v", err)
+				}
+				var order []string
+				scanner := bufio.NewScanner(strings.NewReader(out))
+				for scanner.Scan() {
+					var rec struct {
+						Type   string `json:"type"`
+						Branch string `json:"branch"`
+					}
+					if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+						t.Fatalf("%v: %q", err, scanner.Text())
+					}
+					if rec.Type == "match" && (len(order) == 0 || order[len(order)-1] != rec.Branch) {
+						order = append(order, rec.Branch)
+					}
+				}
+				if !reflect.DeepEqual(order, names) {
+					t.Fatalf("branches printed in order %v, want %v", order, names)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *Result
+	}{
+		{name: "matches", res: sampleResult()},
+		{name: "empty", res: &Result{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := renderResults(&buf, &Options{OutputFormat: "json"}, tt.res); err != nil {
+				t.Fatal(err)
+			}
+			var got jsonDocument
+			dec := json.NewDecoder(&buf)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&got); err != nil {
+				t.Fatalf("output does not decode: %v", err)
+			}
+			want := jsonDocument{Matches: tt.res.Matches, Summary: tt.res.Summary, Branches: tt.res.Branches, Errors: tt.res.Errors}
+			if want.Matches == nil {
+				want.Matches = []Match{}
+			}
+			if want.Branches == nil {
+				want.Branches = []BranchResult{}
+			}
+			if want.Errors == nil {
+				want.Errors = []string{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatJSONPrintsOneDocument(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "x\nanother TODO\n"}},
+	)
+	out, err := runApp(t, "--repo", repo, "--regex", "TODO", "--format", "json", "--checkout-strategy", "none")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	var got struct {
+		Matches []struct {
+			Branch string `json:"branch"`
+			File   string `json:"file"`
+			Line   int    `json:"line"`
+			Text   string `json:"text"`
+		} `json:"matches"`
+		Summary Summary `json:"summary"`
+	}
+	dec := json.NewDecoder(strings.NewReader(out))
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("stdout is not a JSON document: %v\n%s", err, out)
+	}
+	if dec.More() {
+		t.Errorf("stdout holds more than one document:\n%s", out)
+	}
+	if got.Summary.TotalMatches != 3 || got.Summary.BranchesSearched != 2 || len(got.Matches) != 3 {
+		t.Errorf("got %d matches, summary %+v, want 3 matches on 2 branches", len(got.Matches), got.Summary)
+	}
+	for _, m := range got.Matches {
+		if m.Branch == "develop" && m.File == "b.txt" && (m.Line != 2 || m.Text != "another TODO") {
+			t.Errorf("match %+v, want line 2 of b.txt", m)
+		}
+	}
+}
+
+func TestStatusLinesOnStderr(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+	)
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus bool
+	}{
+		{name: "default", wantStatus: true},
+		{name: "quiet", args: []string{"--quiet"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out string
+			var err error
+			stderr := captureFile(t, &os.Stderr, func() {
+				out, err = runApp(t, append([]string{"--repo", repo, "--regex", "TODO", "--checkout-strategy", "none", "--color", "never"}, tt.args...)...)
+			})
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if !strings.Contains(out, "hello TODO") || strings.Contains(out, "Search completed") {
+				t.Errorf("stdout should hold the matches only:\n%s", out)
+			}
+			if got := strings.Contains(stderr, "Search completed"); got != tt.wantStatus {
+				t.Errorf("status lines on stderr = %v, want %v:\n%s", got, tt.wantStatus, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// yamlNode is a value of the JSON document rendered as YAML. Objects keep
+// their keys in the order the JSON encoder wrote them.
+type yamlNode struct {
+	// scalar holds the YAML text of strings, numbers, booleans and null.
+	scalar string
+	keys   []string
+	values []*yamlNode
+	isMap  bool
+	isList bool
+}
+
+// renderYAML writes the result as YAML: the same matches, branches, summary
+// and errors, under the same field names, as the JSON formats.
+func renderYAML(w io.Writer, res *Result) error {
+	doc := struct {
+		Matches  []Match        `json:"matches"`
+		Branches []BranchResult `json:"branches"`
+		Summary  Summary        `json:"summary"`
+		Errors   []string       `json:"errors"`
+	}{res.Matches, res.Branches, res.Summary, res.Errors}
+	if doc.Matches == nil {
+		doc.Matches = []Match{}
+	}
+	if doc.Branches == nil {
+		doc.Branches = []BranchResult{}
+	}
+	if doc.Errors == nil {
+		doc.Errors = []string{}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := decodeYAMLNode(dec)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	writeYAMLMap(bw, root, 0, false)
+	return bw.Flush()
+}
+
+// decodeYAMLNode reads the next JSON value from dec.
+func decodeYAMLNode(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yamlNode{isMap: t == '{', isList: t == '['}
+		for dec.More() {
+			if n.isMap {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			v, err := decodeYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+		}
+		// The closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &yamlNode{scalar: yamlString(t)}, nil
+	case json.Number:
+		return &yamlNode{scalar: t.String()}, nil
+	case bool:
+		return &yamlNode{scalar: fmt.Sprint(t)}, nil
+	}
+	return &yamlNode{scalar: "null"}, nil
+}
+
+// inline returns the YAML of n when it fits after a key or dash on the same
+// line: scalars and empty collections.
+func (n *yamlNode) inline() (string, bool) {
+	switch {
+	case n.isMap && len(n.values) == 0:
+		return "{}", true
+	case n.isList && len(n.values) == 0:
+		return "[]", true
+	case n.isMap || n.isList:
+		return "", false
+	}
+	return n.scalar, true
+}
+
+// writeYAMLMap writes the keys of n at indent. In a list item the first key
+// follows the dash already written, so it is not indented again.
+func writeYAMLMap(w *bufio.Writer, n *yamlNode, indent int, inItem bool) {
+	pad := strings.Repeat(" ", indent)
+	for i, key := range n.keys {
+		if i > 0 || !inItem {
+			w.WriteString(pad)
+		}
+		v := n.values[i]
+		if s, ok := v.inline(); ok {
+			fmt.Fprintf(w, "%s: %s\n", yamlString(key), s)
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", yamlString(key))
+		writeYAMLValue(w, v, indent+2)
+	}
+}
+
+func writeYAMLList(w *bufio.Writer, n *yamlNode, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, v := range n.values {
+		if s, ok := v.inline(); ok {
+			fmt.Fprintf(w, "%s- %s\n", pad, s)
+			continue
+		}
+		if v.isList {
+			fmt.Fprintf(w, "%s-\n", pad)
+			writeYAMLList(w, v, indent+2)
+			continue
+		}
+		fmt.Fprintf(w, "%s- ", pad)
+		writeYAMLMap(w, v, indent+2, true)
+	}
+}
+
+// writeYAMLValue writes a non-empty object or list on the lines below its key.
+func writeYAMLValue(w *bufio.Writer, n *yamlNode, indent int) {
+	if n.isList {
+		writeYAMLList(w, n, indent)
+	} else {
+		writeYAMLMap(w, n, indent, false)
+	}
+}
+
+// yamlSpecial matches plain scalars YAML may read as booleans, null, numbers
+// (including the hex and base 60 forms of YAML 1.1) or merge keys.
+var yamlSpecial = regexp.MustCompile(`^(?i:true|false|yes|no|on|off|y|n|null|~|=|[-+]?\.(inf|nan))$|^[-+.]?[0-9]|^<<`)
+
+// yamlString returns s as a YAML scalar: plain when it reads back as the same
+// string, double-quoted with JSON escapes, which YAML reads the same way,
+// otherwise. Matched text often holds quotes, colons or tabs, so most of it
+// ends up quoted.
+func yamlString(s string) string {
+	plain := s != "" &&
+		!strings.ContainsRune("-?:,[]{}#&*!|>'\"%@` ", rune(s[0])) &&
+		!strings.HasSuffix(s, " ") && !strings.HasSuffix(s, ":") &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") &&
+		strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) || r == utf8.RuneError }) < 0 &&
+		!yamlSpecial.MatchString(s)
+	if plain {
+		return s
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// outputBudget is the writer matches are printed through. With
+// --max-output-bytes it passes on at most limit bytes and drops the rest,
+// so a runaway pattern cannot flood the terminal or a log. It writes to the
+// os.Stdout of the moment, which the pager may have replaced.
+type outputBudget struct {
+	mu       sync.Mutex
+	limit    int64
+	written  int64
+	exceeded bool
+}
+
+// matchOutput is where matches and structured results are written. runSearch
+// resets it with the limit of the run.
+var matchOutput = &outputBudget{}
+
+// reset starts a new run with a budget of limit bytes, or none if limit is 0.
+func (b *outputBudget) reset(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit, b.written, b.exceeded = limit, 0, false
+}
+
+func (b *outputBudget) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exceeded {
+		return len(p), nil
+	}
+	if b.limit > 0 && b.written+int64(len(p)) > b.limit {
+		// Cut at the last full line that fits, so a truncated line is never
+		// mistaken for a match
+		keep := p[:b.limit-b.written]
+		for len(keep) > 0 && keep[len(keep)-1] != '\n' {
+			keep = keep[:len(keep)-1]
+		}
+		b.exceeded = true
+		n, err := os.Stdout.Write(keep)
+		b.written += int64(n)
+		if err != nil {
+			return n, err
+		}
+		return len(p), nil
+	}
+	n, err := os.Stdout.Write(p)
+	b.written += int64(n)
+	return n, err
+}
+
+// overLimit reports whether output was dropped for --max-output-bytes.
+func (b *outputBudget) overLimit() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+// truncationNotice describes the output --max-output-bytes dropped, and
+// whether the search itself was cut short by it.
+func (b *outputBudget) truncationNotice(stopped bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg := fmt.Sprintf("✂️  Output truncated after %d bytes (--max-output-bytes %d)", b.written, b.limit)
+	if stopped {
+		msg += "; the search stopped early and the counts above are partial"
+	}
+	return msg
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// pagerCommand returns the pager to pipe text output through: $PAGER, then
+// less or more. An empty $PAGER or "cat" disables paging, as in git.
+func pagerCommand() string {
+	if pager, ok := os.LookupEnv("PAGER"); ok {
+		if pager == "cat" {
+			return ""
+		}
+		return pager
+	}
+	for _, pager := range []string{"less", "more"} {
+		if commandExists(pager) {
+			return pager
+		}
+	}
+	return ""
+}
+
+// mayPrompt reports whether the run may ask a question on the terminal while
+// it searches: after every branch with --interactive-confirm-per-branch, or
+// before stashing the uncommitted changes of a default branch
+// (confirmCheckout). A pager owns the terminal, so it would hide the question
+// and swallow the answer.
+func (o *Options) mayPrompt() bool {
+	if o.InteractiveReview {
+		return true
+	}
+	if o.CheckoutStrategy != "checkout" || o.Yes || !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return false
+	}
+	for _, repo := range o.Repos {
+		// Clones of --repo URLs start out clean
+		if isRepoURL(repo) || confirmedRepos[repo] {
+			continue
+		}
+		if head, err := runGitCmd(repo, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && uncommittedOnDefault(repo, head) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// startPager redirects stdout to a pager when text is printed to a terminal
+// and --no-pager is not set. With the default LESS=FRX, less exits right away
+// when the output fits on one screen and keeps the colors. The returned
+// function closes the pager and waits for the user to quit it.
+func startPager(opts *Options) func() {
+	if opts.NoPager || !opts.streamsText() || opts.Watch || opts.mayPrompt() || !isatty.IsTerminal(os.Stdout.Fd()) {
+		return func() {}
+	}
+	pager := pagerCommand()
+	if pager == "" {
+		return func() {}
+	}
+
+	// Color is decided against the terminal, not the pipe to the pager
+	if opts.Color == "auto" {
+		setColorMode("auto")
+		opts.Color = "always"
+		if color.NoColor {
+			opts.Color = "never"
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return func() {}
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return func() {}
+	}
+	r.Close()
+
+	// The status lines are paged along with the matches rather than drawn
+	// over the pager's screen
+	stdout, status := os.Stdout, statusWriter
+	os.Stdout = w
+	if status != io.Discard {
+		statusWriter = w
+	}
+	return func() {
+		os.Stdout = stdout
+		statusWriter = status
+		w.Close()
+		_ = cmd.Wait()
+	}
+}
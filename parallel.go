@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rawBranch is the outcome of the raw search of a branch, before the filters
+// and annotations applied in branch order.
+type rawBranch struct {
+	matches []Match
+	// tip is the commit the results are cached under with --cache-dir.
+	tip    string
+	cached bool
+	err    error
+}
+
+// fetchRawBranch returns the raw matches of branch from the cache, or searches
+// it in a workspace of pool and caches the result. A cached branch takes no
+// workspace.
+func fetchRawBranch(opts *Options, pool *workspacePool, cache *resultCache, branch string) rawBranch {
+	var raw rawBranch
+	if cache != nil {
+		raw.tip = tipCommit(pool.base.repoPath, branch)
+	}
+	if raw.matches, raw.cached = cache.load(raw.tip); raw.cached {
+		return raw
+	}
+	ws, err := pool.get()
+	if err != nil {
+		return rawBranch{tip: raw.tip, err: err}
+	}
+	defer pool.put(ws)
+	if opts.BranchTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.BranchTimeout)
+		defer cancel()
+		raw.matches, raw.err = searchBranchContents(opts.withContext(ctx), ws, branch)
+		// A killed engine looks like one that found nothing, so check the
+		// deadline rather than the error
+		if ctx.Err() == context.DeadlineExceeded {
+			return rawBranch{tip: raw.tip, err: &branchTimeoutError{branch: branch, timeout: opts.BranchTimeout}}
+		}
+	} else {
+		raw.matches, raw.err = searchBranchContents(opts, ws, branch)
+	}
+	if raw.err == nil {
+		cache.store(raw.tip, raw.matches)
+	}
+	return raw
+}
+
+// branchTimeoutError reports a branch whose search exceeded --branch-timeout.
+type branchTimeoutError struct {
+	branch  string
+	timeout time.Duration
+}
+
+func (e *branchTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s (--branch-timeout)", e.branch, e.timeout)
+}
+
+// workspacePool hands out the workspaces branches are searched in. With the
+// worktree strategy and --max-branches-parallel, the temporary worktrees
+// beyond the first are only created when every existing one is busy, up to
+// limit (--max-worktrees), so at most limit exist at once.
+type workspacePool struct {
+	base  *workspace
+	limit int
+	free  chan *workspace
+
+	mu       sync.Mutex
+	created  int
+	cleanups []func()
+}
+
+// newWorkspacePool returns a pool of up to limit workspaces like base, which
+// is the first of them.
+func newWorkspacePool(base *workspace, limit int) *workspacePool {
+	p := &workspacePool{base: base, limit: max(limit, 1), free: make(chan *workspace, max(limit, 1)), created: 1}
+	p.free <- base
+	return p
+}
+
+// get returns a free workspace, creating a worktree if none is free and the
+// limit allows it, or waiting for one to be put back. Without a working tree
+// of their own all searches share the base workspace. Worktrees are created
+// one at a time, with p.mu held: concurrent git worktree add commands race on
+// the administrative files in .git/worktrees.
+func (p *workspacePool) get() (*workspace, error) {
+	if p.base.strategy != "worktree" {
+		return p.base, nil
+	}
+	select {
+	case ws := <-p.free:
+		return ws, nil
+	default:
+	}
+	p.mu.Lock()
+	if p.created < p.limit {
+		defer p.mu.Unlock()
+		dir, cleanup, err := addTempWorktree(p.base.repoPath)
+		if err != nil {
+			return nil, err
+		}
+		p.created++
+		p.cleanups = append(p.cleanups, cleanup)
+		return &workspace{repoPath: p.base.repoPath, dir: dir, strategy: p.base.strategy}, nil
+	}
+	p.mu.Unlock()
+	return <-p.free, nil
+}
+
+// put returns ws to the pool.
+func (p *workspacePool) put(ws *workspace) {
+	if p.base.strategy == "worktree" {
+		p.free <- ws
+	}
+}
+
+// close removes the worktrees the pool created, once no search uses them.
+func (p *workspacePool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, cleanup := range p.cleanups {
+		cleanup()
+	}
+	p.cleanups = nil
+}
+
+// peak returns the number of workspaces in use at most at once.
+func (p *workspacePool) peak() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.created
+}
+
+// concurrencyOrders are the accepted --concurrency-order values.
+var concurrencyOrders = []string{"fifo", "by-size"}
+
+// dispatchOrder returns the indexes of the branches prefetchBranches starts,
+// in the order it starts them: branch order with fifo, and the branches with
+// the fewest files first with by-size, so small branches are not stuck
+// behind large ones. Branches in skip are left out.
+func dispatchOrder(opts *Options, repoPath string, branches []string, skip map[string]bool) []int {
+	var order []int
+	for i, branch := range branches {
+		if !skip[branch] {
+			order = append(order, i)
+		}
+	}
+	if opts.ConcurrencyOrder != "by-size" {
+		return order
+	}
+	sizes := make(map[int]int, len(order))
+	for _, i := range order {
+		sizes[i] = treeSize(repoPath, branches[i])
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+	return order
+}
+
+// treeSize estimates the cost of searching branch by the number of files in
+// its tree. A branch that cannot be listed counts as empty and is started
+// first, which makes its error show up early.
+func treeSize(repoPath, branch string) int {
+	out, err := runGitCmd(repoPath, "ls-tree", "-r", "--name-only", branch)
+	if err != nil || out == "" {
+		return 0
+	}
+	return strings.Count(out, "\n") + 1
+}
+
+// prefetchBranches searches branches ahead of the branch loop with
+// --max-branches-parallel branches at a time, taking their workspaces from
+// pool, in the order of --concurrency-order. Every branch gets its own
+// buffered channel, so the loop can consume the results strictly in branch
+// order however the searches finish; branches in skip are not searched and
+// get no result. The returned function stops dispatching and
+// waits for the searches in flight, and must be called before the workspaces
+// are removed.
+func prefetchBranches(opts *Options, pool *workspacePool, cache *resultCache, branches []string, skip map[string]bool) ([]chan rawBranch, func()) {
+	results := make([]chan rawBranch, len(branches))
+	for i := range results {
+		results[i] = make(chan rawBranch, 1)
+	}
+	slots := make(chan struct{}, opts.MaxBranchesParallel)
+
+	order := dispatchOrder(opts, pool.base.repoPath, branches, skip)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, i := range order {
+			branch := branches[i]
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			wg.Add(1)
+			go func(i int, branch string) {
+				defer wg.Done()
+				results[i] <- fetchRawBranch(opts, pool, cache, branch)
+				<-slots
+			}(i, branch)
+		}
+	}()
+
+	var once sync.Once
+	return results, func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// patchHunkHeader matches a unified diff hunk header and captures the old
+// length and the new start and length.
+var patchHunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// addedLines returns the lines a unified diff adds, as matches carrying the
+// target file and their line number in the new file. Deleted files and removed
+// lines are ignored.
+func addedLines(diff string) []Match {
+	var lines []Match
+	var file string
+	var newLine, oldLeft, newLeft int
+	for _, line := range strings.Split(diff, "\n") {
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				if file != "" {
+					lines = append(lines, Match{File: file, Line: newLine, Text: trimLineEnding(line[1:])})
+				}
+				newLine++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				newLine++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		if sub := patchHunkHeader.FindStringSubmatch(line); sub != nil {
+			oldLeft, newLeft = 1, 1
+			if sub[1] != "" {
+				oldLeft, _ = strconv.Atoi(sub[1])
+			}
+			newLine, _ = strconv.Atoi(sub[2])
+			if sub[3] != "" {
+				newLeft, _ = strconv.Atoi(sub[3])
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "+++ "); ok {
+			// Strip a trailing timestamp as written by diff -u
+			name, _, _ = strings.Cut(name, "\t")
+			if name == "/dev/null" {
+				file = ""
+			} else {
+				file = strings.TrimPrefix(name, "b/")
+			}
+		}
+	}
+	return lines
+}
+
+// runPatch searches the lines added by the unified diff in --patch ("-" reads
+// stdin) instead of a repository. Matches are reported under the patch file's
+// name in place of a branch.
+func runPatch(opts *Options) error {
+	if err := compilePatterns(opts); err != nil {
+		return err
+	}
+	setColorMode(opts.Color)
+	crlfLineEndings = opts.NewlineHandling == "crlf"
+
+	var content []byte
+	var err error
+	if opts.Patch == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(opts.Patch)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read patch: %v", err)
+	}
+
+	label := opts.Patch
+	if label == "-" {
+		label = "stdin"
+	}
+	statusf("🔍 Search pattern: %s\n", opts.patternLabel())
+	statusf("🩹 Searching lines added by %s\n", label)
+	res := &Result{invalidUTF8: opts.InvalidUTF8, occurrenceRE: opts.occurrenceRE()}
+	searchAddedLines(opts, res, "", label, string(content))
+	return finishRun(opts, res)
+}
+
+// searchAddedLines searches the lines added by diff, records the matches
+// under label as if it were a branch and prints them.
+func searchAddedLines(opts *Options, res *Result, repoName, label, diff string) {
+	var matches []Match
+	for _, m := range addedLines(diff) {
+		if !opts.re.MatchString(m.Text) {
+			continue
+		}
+		m.Repo = repoName
+		m.Branch = label
+		if len(opts.Patterns) > 1 {
+			if p := opts.patternFor(m.Text); p >= 0 {
+				m.Pattern = opts.Patterns[p]
+			}
+		}
+		if loc := opts.re.FindStringIndex(m.Text); loc != nil && !opts.onlyMatching() {
+			m.Column = loc[0] + 1
+		}
+		matches = append(matches, m)
+	}
+
+	matches = filterNotMatching(opts, matches)
+	matches = filterLineRange(opts, matches)
+	matches = filterLineLength(opts, matches)
+	tagRules(opts, matches)
+	matches = extractValues(opts, res, matches)
+	if opts.FirstMatch && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	matches = res.limitTotal(opts.MatchLimitTotal, matches)
+	res.addBranch(repoName, label, matches)
+	emitMatches(opts, res, matches)
+}
+
+// runWorkingDiff searches only the lines the uncommitted changes of each
+// repository add, as a pre-commit guard: the staged changes (git diff
+// --cached) and the unstaged ones (git diff), reported under those labels
+// with their line numbers in the index and the working tree. Nothing is
+// stashed, checked out or fetched.
+func runWorkingDiff(opts *Options) error {
+	if err := compilePatterns(opts); err != nil {
+		return err
+	}
+	setColorMode(opts.Color)
+	crlfLineEndings = opts.NewlineHandling == "crlf"
+
+	statusf("🔍 Search pattern: %s\n", opts.patternLabel())
+	res := &Result{invalidUTF8: opts.InvalidUTF8, occurrenceRE: opts.occurrenceRE(), repoPaths: map[string]string{}}
+	for _, repoPath := range opts.Repos {
+		if _, err := runGitCmd(repoPath, "rev-parse", "--git-dir"); err != nil {
+			return fmt.Errorf("not a git repository: %s", repoPath)
+		}
+		var repoName string
+		if len(opts.Repos) > 1 {
+			repoName = filepath.Base(repoPath)
+		}
+		res.repoPaths[repoName] = repoPath
+		statusf("🩹 Searching the uncommitted changes of %s\n", repoPath)
+		for _, d := range []struct{ label, flag string }{{"staged", "--cached"}, {"unstaged", ""}} {
+			args := []string{"-c", "core.quotePath=false", "diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "-U0"}
+			if d.flag != "" {
+				args = append(args, d.flag)
+			}
+			diff, err := runGitCmd(repoPath, args...)
+			if err != nil {
+				return fmt.Errorf("git diff %s failed: %v", d.flag, err)
+			}
+			searchAddedLines(opts, res, repoName, d.label, diff)
+		}
+		res.Summary.Repositories++
+	}
+	return finishRun(opts, res)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// runPostCommand runs --post-command through sh once the search is over and
+// every repository is restored, with the summary counts in GRS_* variables.
+// It runs in the searched repository, or in the current directory when
+// several repositories were searched. Its output goes with the status lines.
+func runPostCommand(opts *Options, res *Result) error {
+	cmd := exec.Command("sh", "-c", opts.PostCommand)
+	if len(opts.Repos) == 1 && !isRepoURL(opts.Repos[0]) {
+		cmd.Dir = opts.Repos[0]
+	}
+	cmd.Env = append(os.Environ(),
+		"GRS_TOTAL_MATCHES="+strconv.Itoa(res.Summary.TotalMatches),
+		"GRS_BRANCHES_WITH_MATCHES="+strconv.Itoa(res.Summary.BranchesWithMatches),
+		"GRS_BRANCHES_SEARCHED="+strconv.Itoa(res.Summary.BranchesSearched),
+		"GRS_REPOSITORIES="+strconv.Itoa(res.Summary.Repositories),
+		"GRS_ERRORS="+strconv.Itoa(len(res.Errors)),
+		"GRS_STOPPED="+strconv.FormatBool(res.Summary.Stopped),
+	)
+	cmd.Stdout = statusWriter
+	cmd.Stderr = os.Stderr
+
+	statusln("⚙️  Running post-command...")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("post-command failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// preCommandError reports a failed --pre-command. Unlike other search errors it
+// only aborts the branch it ran on.
+type preCommandError struct {
+	err    error
+	output string
+}
+
+func (e *preCommandError) Error() string {
+	if e.output != "" {
+		return fmt.Sprintf("pre-command failed: %v: %s", e.err, e.output)
+	}
+	return fmt.Sprintf("pre-command failed: %v", e.err)
+}
+
+// runPreCommand runs --pre-command through sh in dir, the checked-out tree of
+// the branch about to be searched. Its output is only shown with --verbose.
+func runPreCommand(opts *Options, dir string) error {
+	cmd := exec.CommandContext(opts.context(), "sh", "-c", opts.PreCommand)
+	cmd.Dir = dir
+	// Do not wait for children still holding the output after sh was killed
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if verboseGit && output != "" {
+		fmt.Fprintf(os.Stderr, "pre-command: %s\n", output)
+	}
+	if err != nil && !opts.IgnorePreErrors {
+		return &preCommandError{err: err, output: output}
+	}
+	return nil
+}
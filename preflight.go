@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reportDestructiveEffects inspects each repository and writes the changes a
+// real run would make to it (--dry-run-destructive-check): what is stashed,
+// which branches are checked out, created or moved, what goes over the
+// network. Unlike --explain it looks at the repositories, but it changes
+// nothing and does not fetch, so branches that only a fetch would bring in
+// are not counted.
+func reportDestructiveEffects(w io.Writer, opts *Options) error {
+	for i, repo := range opts.Repos {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "📁 %s\n", repo)
+		item := func(format string, args ...interface{}) {
+			fmt.Fprintf(w, "  • "+format+"\n", args...)
+		}
+		if isRepoURL(repo) {
+			item("clone into a temporary directory (network) and remove it afterwards; nothing of yours is modified")
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+			return fmt.Errorf("not a git repository: %s", repo)
+		}
+		if err := destructiveEffects(item, opts, repo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func destructiveEffects(item func(string, ...interface{}), opts *Options, repoPath string) error {
+	if opts.ReadOnly {
+		item("nothing: no fetch, and every git command that could modify the repository is refused (--read-only)")
+		return nil
+	}
+	if !opts.SearchWorktrees {
+		item("⚠️  fetch from every remote (network), updating the remote-tracking branches")
+	}
+	if opts.ResetLastRun {
+		item("delete the --since-last-run time from the git directory")
+	}
+	if opts.SinceLastRun {
+		item("record the time of this run in the git directory (--since-last-run)")
+	}
+	if opts.SearchWorktrees || opts.MatchBranchNames || opts.CheckoutStrategy == "none" {
+		item("nothing in your working tree: nothing is stashed or checked out")
+		return nil
+	}
+
+	branches, err := listBranches(opts, repoPath)
+	if err != nil {
+		return err
+	}
+	if opts.CheckoutStrategy == "worktree" {
+		n := 1
+		if opts.MaxBranchesParallel > 1 {
+			n = min(opts.MaxBranchesParallel, len(branches))
+			if opts.MaxWorktrees > 0 {
+				n = min(n, opts.MaxWorktrees)
+			}
+		}
+		item("check out %d branches in up to %d temporary worktrees, removed afterwards; your working tree is untouched", len(branches), n)
+		return nil
+	}
+
+	status, err := runGitCmd(repoPath, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("git status failed: %v", err)
+	}
+	modified, untracked := 0, 0
+	for _, line := range strings.Split(status, "\n") {
+		switch {
+		case strings.HasPrefix(line, "??"):
+			untracked++
+		case line != "":
+			modified++
+		}
+	}
+	if modified+untracked > 0 {
+		item("⚠️  stash %d modified and %d untracked files (git stash push -u) and pop them again at the end", modified, untracked)
+	} else {
+		item("stash nothing: the working tree is clean")
+	}
+	switch opts.RestoreStrategy {
+	case "none":
+		item("⚠️  leave the repository on the last searched branch, with your changes still stashed")
+	case "branch-only":
+		item("⚠️  switch back to your branch but leave your changes stashed")
+	}
+
+	var created, fastForward, diverged []string
+	for _, b := range branches {
+		if _, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+b); err != nil {
+			created = append(created, b)
+			continue
+		}
+		out, err := runGitCmd(repoPath, "rev-list", "--left-right", "--count", "refs/heads/"+b+"...refs/remotes/"+remoteName+"/"+b)
+		if err != nil {
+			continue
+		}
+		var ahead, behind int
+		if _, err := fmt.Sscanf(out, "%d %d", &ahead, &behind); err != nil || behind == 0 {
+			continue
+		}
+		if ahead == 0 {
+			fastForward = append(fastForward, b)
+		} else {
+			diverged = append(diverged, b)
+		}
+	}
+	// Filters such as --since-tag are applied after the fetch, so these are
+	// the most branches a run would check out
+	item("⚠️  check out up to %d branches in your working tree", len(branches))
+	if len(created) > 0 {
+		item("create %d local branches that only exist on the remote: %s", len(created), strings.Join(created, ", "))
+	}
+	if opts.PullStrategy != "none" {
+		if len(fastForward) > 0 {
+			item("fast-forward %d local branches to %s: %s", len(fastForward), remoteName, strings.Join(fastForward, ", "))
+		}
+		if len(diverged) > 0 && opts.PullStrategy == "reset" {
+			item("🧨 reset %d diverged local branches to %s, dropping their local commits: %s", len(diverged), remoteName, strings.Join(diverged, ", "))
+		}
+	}
+	if opts.ForceCheckout {
+		item("🧨 discard local modifications with git reset --hard whenever a checkout fails (--force-checkout)")
+	}
+	if len(opts.SparsePaths) > 0 {
+		item("switch the checkout to sparse-checkout of %s and restore the previous setup afterwards", strings.Join(opts.SparsePaths, ", "))
+	}
+	if opts.PreCommand != "" {
+		item("⚠️  run %q on every branch, which may change files in your working tree", opts.PreCommand)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prescanCount returns a rough number of matching lines on ref, counted with
+// git grep -c. It is much cheaper than a full search and only used for ordering.
+func prescanCount(opts *Options, repoPath, ref string) int {
+	args := []string{"grep", "-c", "-I", opts.matcherFlag()}
+	if opts.ignoreCase() {
+		args = append(args, "-i")
+	}
+	args = append(args, opts.engineArgs()...)
+	args = append(args, ref)
+	if pathspecs := globPathspecs(opts.IncludeGlobs, opts.ExcludeGlobs, opts.GlobCaseInsensitive); len(pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, pathspecs...)
+	}
+	out, err := runGitCmd(repoPath, args...)
+	if err != nil {
+		return 0
+	}
+	total := 0
+	for _, line := range strings.Split(out, "\n") {
+		// "<ref>:<file>:<count>"
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(line[i+1:]); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// prioritizeBranches orders branches by their pre-scan match count, highest
+// first, so that branches with matches are searched and reported early.
+// Branches with equal counts keep their original order.
+func prioritizeBranches(opts *Options, repoPath string, branches []string) []string {
+	counts := make(map[string]int, len(branches))
+	for _, b := range branches {
+		counts[b] = prescanCount(opts, repoPath, branchRef(repoPath, b))
+	}
+	sorted := append([]string(nil), branches...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return counts[sorted[i]] > counts[sorted[j]]
+	})
+	return sorted
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressFormats lists the accepted values of --progress-format.
+var progressFormats = []string{"text", "json"}
+
+// progressEvents receives the progress events of --progress-format json; it
+// is nil with the default text progress.
+var progressEvents *progressLog
+
+// progressEvent is one line of --progress-format json.
+type progressEvent struct {
+	Time  string `json:"time"`
+	Event string `json:"event"`
+	Repo  string `json:"repo,omitempty"`
+	// Branch is the label of the branch, as in the results.
+	Branch string `json:"branch,omitempty"`
+	// BranchIndex counts the branches of the repository from 1.
+	BranchIndex   int `json:"branch_index,omitempty"`
+	BranchesTotal int `json:"branches_total,omitempty"`
+	// Matches is the match count of the branch, TotalMatches that of the run so far.
+	Matches      *int   `json:"matches,omitempty"`
+	TotalMatches *int   `json:"total_matches,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// progressLog writes progressEvents as JSON lines.
+type progressLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// startProgress switches the progress output to JSON events on stderr for
+// --progress-format json. The human-readable status lines are dropped then,
+// so that stderr only carries events; warnings become events of their own.
+func startProgress(opts *Options) {
+	progressEvents = nil
+	if opts.ProgressFormat != "json" {
+		return
+	}
+	progressEvents = &progressLog{enc: json.NewEncoder(os.Stderr)}
+	statusWriter = io.Discard
+}
+
+// emit writes ev, stamped with the current time.
+func (p *progressLog) emit(ev progressEvent) {
+	if p == nil {
+		return
+	}
+	ev.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.enc.Encode(ev)
+}
+
+// branchDone reports a branch finished with matches found on it and total
+// found in the run so far.
+func (p *progressLog) branchDone(event, repo, branch string, matches, total int) {
+	p.emit(progressEvent{Event: event, Repo: repo, Branch: branch, Matches: &matches, TotalMatches: &total})
+}
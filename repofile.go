@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readListFile returns the entries of a --repo-file, --regex-file or
+// --branches-file: one per line, without surrounding whitespace. Blank lines
+// and lines starting with # are skipped.
+func readListFile(path, flag string) ([]string, error) {
+	entries, _, err := readListFileLines(path, flag)
+	return entries, err
+}
+
+// readListFileLines is readListFile that also returns the line number of
+// every entry.
+func readListFileLines(path, flag string) ([]string, []int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read --%s: %v", flag, err)
+	}
+	var entries []string
+	var numbers []int
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+		numbers = append(numbers, i+1)
+	}
+	return entries, numbers, nil
+}
+
+// readRepoFile returns the repositories listed in path, one path or URL per
+// line, expanding a leading ~/.
+func readRepoFile(path string) ([]string, error) {
+	lines, err := readListFile(path, "repo-file")
+	if err != nil {
+		return nil, err
+	}
+	var repos []string
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				line = filepath.Join(home, rest)
+			}
+		}
+		repos = append(repos, line)
+	}
+	return repos, nil
+}
+
+// isRepoURL reports whether repo is a remote URL rather than a local path.
+func isRepoURL(repo string) bool {
+	return strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@")
+}
+
+// prepareRepo returns the local path to search for repo, cloning URLs into a
+// temporary directory named after the repository. The returned function
+// removes the clone again.
+func prepareRepo(repo string) (string, func(), error) {
+	if !isRepoURL(repo) {
+		return repo, func() {}, nil
+	}
+	tmp, err := os.MkdirTemp("", "git-regex-search-clone-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create clone directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	name := strings.TrimSuffix(filepath.Base(strings.TrimRight(repo, "/")), ".git")
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		// git@host:repo
+		name = name[i+1:]
+	}
+	if name == "" || name == "." {
+		name = "repo"
+	}
+	dir := filepath.Join(tmp, name)
+	statusf("📥 Cloning %s...\n", repo)
+	if _, err := runGitCmd(tmp, "clone", "--quiet", repo, dir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("clone failed: %v", err)
+	}
+	return dir, cleanup, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Summary holds the aggregate counts of a search run.
+type Summary struct {
+	TotalMatches        int `json:"total_matches"`
+	BranchesSearched    int `json:"branches_searched"`
+	BranchesWithMatches int `json:"branches_with_matches"`
+	Repositories        int `json:"repositories"`
+	// BranchesTimedOut counts the branches abandoned after --branch-timeout.
+	BranchesTimedOut int `json:"branches_timed_out,omitempty"`
+	// Stopped is set when --first-match, --match-limit-total or --max-runtime ended the search early.
+	Stopped bool `json:"stopped,omitempty"`
+	// TotalOccurrences counts every match within the matching lines (--count-occurrences).
+	TotalOccurrences int `json:"total_occurrences,omitempty"`
+	// UniqueFiles counts the distinct files with matches on any branch (--count-unique-files).
+	UniqueFiles int `json:"unique_files,omitempty"`
+}
+
+// BranchResult holds the match count of a single searched branch.
+type BranchResult struct {
+	Repo    string `json:"repo,omitempty"`
+	Branch  string `json:"branch"`
+	Matches int    `json:"matches"`
+	// Occurrences counts every match within the matching lines (--count-occurrences).
+	Occurrences int `json:"occurrences,omitempty"`
+	// TimedOut is set when --branch-timeout abandoned the branch.
+	TimedOut bool `json:"timed_out,omitempty"`
+}
+
+// Result is the aggregate outcome of a search run across all repositories.
+// Its recording methods (addBranch, addTimedOut, addError, stop and
+// limitTotal) are safe to call from several goroutines, such as the searches
+// of --max-branches-parallel; the exported fields are read once they are done.
+type Result struct {
+	Matches  []Match        `json:"matches"`
+	Branches []BranchResult `json:"branches"`
+	Summary  Summary        `json:"summary"`
+	// Errors collects non-fatal problems encountered during the run.
+	Errors []string `json:"errors,omitempty"`
+
+	// seenValues tracks the values already reported with --unique.
+	seenValues map[string]bool
+	// emittedGroups counts the branches whose matches were streamed so far.
+	emittedGroups int
+	// outputFiles holds the file names already written to --output-dir.
+	outputFiles map[string]bool
+	// invalidUTF8 is the --invalid-utf8 mode applied to recorded matches.
+	invalidUTF8 string
+	// occurrenceRE counts the occurrences in recorded matches with
+	// --count-occurrences; nil without it.
+	occurrenceRE *regexp.Regexp
+	// stopReason describes why the search was stopped early.
+	stopReason string
+	// outOfTime is set when --max-runtime stopped the search.
+	outOfTime bool
+	// repoPaths maps the repository label of matches to its path, for
+	// --path-style absolute.
+	repoPaths map[string]string
+	// worktreePaths maps the labels of --search-worktrees to the worktree
+	// their files are in.
+	worktreePaths map[string]string
+	// checkpoint is set when --checkpoint is used.
+	checkpoint *checkpoint
+
+	// mu guards the fields updated by the recording methods.
+	mu sync.Mutex
+}
+
+// addError records a non-fatal problem and reports it as a warning.
+func (r *Result) addError(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	r.mu.Lock()
+	r.Errors = append(r.Errors, msg)
+	r.mu.Unlock()
+	statusf("⚠️  Warning: %s\n", msg)
+	progressEvents.emit(progressEvent{Event: "warning", Message: msg})
+}
+
+// addBranch records the matches found on a single branch.
+func (r *Result) addBranch(repo, branch string, matches []Match) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	occurrences := countOccurrences(r.occurrenceRE, matches)
+	r.Branches = append(r.Branches, BranchResult{Repo: repo, Branch: branch, Matches: len(matches), Occurrences: occurrences})
+	r.Summary.BranchesSearched++
+	r.Summary.TotalOccurrences += occurrences
+	if len(matches) > 0 {
+		r.Summary.BranchesWithMatches++
+		r.Summary.TotalMatches += len(matches)
+		start := len(r.Matches)
+		r.Matches = append(r.Matches, matches...)
+		// Streamed text keeps the raw bytes; only the recorded copies are fixed
+		if n := fixInvalidUTF8(r.invalidUTF8, r.Matches[start:]); n > 0 {
+			statusf("⚠️  Warning: %d matched lines in %s contain invalid UTF-8\n", n, branchColor(branch))
+		}
+	}
+}
+
+// uniqueFiles returns the number of distinct files with matches, whatever
+// branch they were found on. Files of different repositories are different
+// files even when their paths are the same.
+func (r *Result) uniqueFiles() int {
+	seen := make(map[string]bool)
+	for _, m := range r.Matches {
+		if m.File == "" {
+			continue
+		}
+		seen[m.Repo+"\x00"+m.File] = true
+	}
+	return len(seen)
+}
+
+// addTimedOut records a branch abandoned after --branch-timeout. It is listed
+// with the branches but not counted as searched.
+func (r *Result) addTimedOut(repo, branch string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Branches = append(r.Branches, BranchResult{Repo: repo, Branch: branch, TimedOut: true})
+	r.Summary.BranchesTimedOut++
+}
+
+// stop ends the search early; reason completes "Stopped at ...".
+func (r *Result) stop(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopLocked(reason)
+}
+
+func (r *Result) stopLocked(reason string) {
+	r.Summary.Stopped = true
+	r.stopReason = reason
+}
+
+// checkRuntime stops the search once the --max-runtime deadline of ctx has
+// passed, and reports whether it did.
+func (r *Result) checkRuntime(ctx context.Context, budget time.Duration) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outOfTime = true
+	r.stopLocked(fmt.Sprintf("the time budget of %s (--max-runtime)", budget))
+	return true
+}
+
+// limitTotal truncates matches so that at most limit matches are collected over
+// the whole run, and stops the search once the limit is reached. A limit of 0
+// means no limit.
+func (r *Result) limitTotal(limit int, matches []Match) []Match {
+	if limit <= 0 {
+		return matches
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := max(limit-r.Summary.TotalMatches, 0)
+	if len(matches) >= remaining {
+		matches = matches[:remaining]
+		r.stopLocked(fmt.Sprintf("the limit of %d matches (--match-limit-total)", limit))
+	}
+	return matches
+}
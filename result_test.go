@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Run with -race: the recording methods of Result are called from several
+// goroutines by --max-branches-parallel.
+func TestResultConcurrentAdds(t *testing.T) {
+	defer func(w io.Writer) { statusWriter = w }(statusWriter)
+	statusWriter = io.Discard
+
+	tests := []struct {
+		name       string
+		workers    int
+		branches   int
+		perBranch  int
+		timedOutAt int
+	}{
+		{name: "single worker", workers: 1, branches: 20, perBranch: 3, timedOutAt: 7},
+		{name: "many workers", workers: 16, branches: 50, perBranch: 2, timedOutAt: 5},
+		{name: "branches without matches", workers: 8, branches: 40, perBranch: 0, timedOutAt: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &Result{}
+			var wg sync.WaitGroup
+			for w := 0; w < tt.workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for b := 0; b < tt.branches; b++ {
+						branch := fmt.Sprintf("w%d-b%d", w, b)
+						if b%tt.timedOutAt == tt.timedOutAt-1 {
+							res.addTimedOut("", branch)
+							res.addError("branch %s timed out", branch)
+							continue
+						}
+						var matches []Match
+						for i := 0; i < tt.perBranch; i++ {
+							matches = append(matches, Match{Branch: branch, File: "a.txt", Line: i + 1, Text: "TODO"})
+						}
+						// A limit no branch reaches, so that it is checked but never cuts
+						res.addBranch("", branch, res.limitTotal(1<<20, matches))
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			timedOut := tt.workers * (tt.branches / tt.timedOutAt)
+			searched := tt.workers*tt.branches - timedOut
+			want := Summary{
+				TotalMatches:     searched * tt.perBranch,
+				BranchesSearched: searched,
+				BranchesTimedOut: timedOut,
+			}
+			if tt.perBranch > 0 {
+				want.BranchesWithMatches = searched
+			}
+			if res.Summary != want {
+				t.Errorf("summary = %+v, want %+v", res.Summary, want)
+			}
+			if len(res.Matches) != want.TotalMatches {
+				t.Errorf("%d matches recorded, want %d", len(res.Matches), want.TotalMatches)
+			}
+			if len(res.Branches) != tt.workers*tt.branches {
+				t.Errorf("%d branches recorded, want %d", len(res.Branches), tt.workers*tt.branches)
+			}
+			if len(res.Errors) != timedOut {
+				t.Errorf("%d errors recorded, want %d", len(res.Errors), timedOut)
+			}
+			// Every branch is recorded once, whatever the interleaving
+			names := make([]string, 0, len(res.Branches))
+			for _, b := range res.Branches {
+				names = append(names, b.Branch)
+			}
+			sort.Strings(names)
+			for i := 1; i < len(names); i++ {
+				if names[i] == names[i-1] {
+					t.Fatalf("branch %s recorded twice", names[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// errReviewInterrupted is returned when Ctrl-C ends an
+// --interactive-confirm-per-branch review. Like any other error it restores
+// the repository on the way out.
+var errReviewInterrupted = errors.New("interrupted during --interactive-confirm-per-branch review")
+
+// branchReview is the prompt of --interactive-confirm-per-branch, shown after
+// the results of every branch. Ctrl-C is caught while it is active, so that
+// the repository is restored instead of left on the searched branch; an
+// interrupt during a search takes effect at the next prompt.
+type branchReview struct {
+	in        *bufio.Reader
+	interrupt chan os.Signal
+}
+
+// reviewAction is what the user chose at the prompt.
+type reviewAction int
+
+const (
+	reviewContinue reviewAction = iota
+	reviewStop
+	reviewRerun
+)
+
+// newBranchReview returns the review of a repository, or nil without
+// --interactive-confirm-per-branch or when stdin is not a terminal to ask on.
+func newBranchReview(opts *Options) *branchReview {
+	if !opts.InteractiveReview {
+		return nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		statusln("⚠️  Warning: stdin is not a terminal, searching without --interactive-confirm-per-branch prompts")
+		return nil
+	}
+	r := &branchReview{in: bufio.NewReader(os.Stdin), interrupt: make(chan os.Signal, 1)}
+	signal.Notify(r.interrupt, os.Interrupt)
+	return r
+}
+
+// close stops catching Ctrl-C.
+func (r *branchReview) close() {
+	if r != nil {
+		signal.Stop(r.interrupt)
+	}
+}
+
+// readLine prints prompt to stderr and returns the answer, or
+// errReviewInterrupted if Ctrl-C was pressed before or while waiting for it.
+func (r *branchReview) readLine(prompt string) (string, error) {
+	select {
+	case <-r.interrupt:
+		return "", errReviewInterrupted
+	default:
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := r.in.ReadString('\n')
+		answer <- strings.TrimSpace(line)
+	}()
+	select {
+	case line := <-answer:
+		return line, nil
+	case <-r.interrupt:
+		fmt.Fprintln(os.Stderr)
+		return "", errReviewInterrupted
+	}
+}
+
+// ask asks what to do after the results of branch.
+func (r *branchReview) ask(branch string) (reviewAction, error) {
+	for {
+		answer, err := r.readLine(fmt.Sprintf("⏯️  %s done: [c]ontinue, [s]top and skip the remaining branches, [r]e-run it with other options? [C/s/r] ", branch))
+		if err != nil {
+			return reviewContinue, err
+		}
+		switch strings.ToLower(answer) {
+		case "", "c", "continue":
+			return reviewContinue, nil
+		case "s", "stop", "skip":
+			return reviewStop, nil
+		case "r", "rerun", "re-run":
+			return reviewRerun, nil
+		}
+		fmt.Fprintf(os.Stderr, "   Unknown answer %q\n", answer)
+	}
+}
+
+// rerunOptions asks for the pattern and include glob of a re-run and returns
+// the options to search with.
+func (r *branchReview) rerunOptions(opts *Options) (*Options, error) {
+	c := *opts
+	pattern, err := r.readLine(fmt.Sprintf("   Regex for the re-run [%s]: ", opts.patternLabel()))
+	if err != nil {
+		return nil, err
+	}
+	if pattern != "" {
+		c.Patterns = []string{pattern}
+		c.Rules = nil
+	}
+	glob, err := r.readLine("   Include glob for the re-run (empty for all files): ")
+	if err != nil {
+		return nil, err
+	}
+	if glob != "" {
+		c.IncludeGlobs = []string{glob}
+	}
+	if err := compilePatterns(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// rerunBranch searches branch again with the options the user enters and
+// prints what it finds. The re-run is only for looking: its matches are not
+// added to the results of the run.
+func (r *branchReview) rerunBranch(opts *Options, pool *workspacePool, repoName, label, branch string) error {
+	c, err := r.rerunOptions(opts)
+	if err != nil {
+		if errors.Is(err, errReviewInterrupted) {
+			return err
+		}
+		statusf("⚠️  Warning: %v\n", err)
+		return nil
+	}
+	statusf("🔁 Re-running %s with %s...\n", branchColor(branch), c.patternLabel())
+	raw := fetchRawBranch(c, pool, nil, branch)
+	if raw.err != nil {
+		statusf("⚠️  Warning: re-run failed: %v\n", raw.err)
+		return nil
+	}
+	matches := filterNotMatching(c, raw.matches)
+	annotateMatches(c, repoName, label, matches)
+	printTextMatches(matchOutput, c.re, matches)
+	statusf("🔁 The re-run found %d matches in %s (not added to the results)\n", len(matches), branchColor(branch))
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// rgData is a piece of arbitrary data in rg --json output: UTF-8 text, or the
+// base64 of bytes that are not valid UTF-8.
+type rgData struct {
+	Text  *string `json:"text"`
+	Bytes string  `json:"bytes"`
+}
+
+func (d rgData) String() string {
+	if d.Text != nil {
+		return *d.Text
+	}
+	b, err := base64.StdEncoding.DecodeString(d.Bytes)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// rgEvent is a message of rg --json: begin, match, context, end or summary.
+type rgEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Path       rgData `json:"path"`
+		Lines      rgData `json:"lines"`
+		LineNumber int    `json:"line_number"`
+		Submatches []struct {
+			Match rgData `json:"match"`
+			Start int    `json:"start"`
+			End   int    `json:"end"`
+		} `json:"submatches"`
+		BinaryOffset *int64 `json:"binary_offset"`
+	} `json:"data"`
+}
+
+// rgJSONParser turns the output of rg --json into matches one file at a time,
+// so paths with colons, context lines and multiline matches need no guessing.
+type rgJSONParser struct {
+	before       int
+	after        int
+	onlyMatching bool
+
+	// The lines and matches of the file being read
+	entries []contextEntry
+	matches []Match
+}
+
+func newRgJSONParser(opts *Options) *rgJSONParser {
+	return &rgJSONParser{before: opts.BeforeLines, after: opts.AfterLines, onlyMatching: opts.onlyMatching()}
+}
+
+// parseRgJSON returns the matches in the rg --json output lines.
+func parseRgJSON(lines []string, opts *Options) []Match {
+	p := newRgJSONParser(opts)
+	var matches []Match
+	for _, line := range lines {
+		matches = append(matches, p.feed(line)...)
+	}
+	// Output cut short by a killed rg has no end message for the last file
+	return append(matches, p.finish(false)...)
+}
+
+// feed parses a line of rg --json output and returns the matches of the file
+// it ends, if any. Lines that are not JSON, like the errors rg writes to
+// stderr, are ignored as in text mode.
+func (p *rgJSONParser) feed(line string) []Match {
+	var ev rgEvent
+	if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &ev) != nil {
+		return nil
+	}
+	switch ev.Type {
+	case "begin":
+		p.entries, p.matches = nil, nil
+	case "match", "context":
+		p.addLines(&ev)
+	case "end":
+		return p.finish(ev.Data.BinaryOffset != nil)
+	}
+	return nil
+}
+
+// finish returns the matches of the current file with their context. Like rg
+// in text mode, a binary file is reported with a single notice instead of its
+// lines.
+func (p *rgJSONParser) finish(binary bool) []Match {
+	matches := p.matches
+	if binary && len(matches) > 0 {
+		matches = []Match{{File: matches[0].File, Text: binaryMatchText, Binary: true}}
+	} else {
+		attachContext(p.entries, matches, p.before, p.after)
+	}
+	p.entries, p.matches = nil, nil
+	return matches
+}
+
+// addLines records the lines of a match or context message. A multiline
+// match spans several lines, each recorded as a match of its own like in text
+// output, with the column of the first submatch that starts on it; with
+// --only-matching every submatch is a match instead.
+func (p *rgJSONParser) addLines(ev *rgEvent) {
+	file := normalizePath(ev.Data.Path.String())
+	text := ev.Data.Lines.String()
+	isMatch := ev.Type == "match"
+
+	if isMatch && p.onlyMatching {
+		for _, sm := range ev.Data.Submatches {
+			before := text[:min(sm.Start, len(text))]
+			line := ev.Data.LineNumber + strings.Count(before, "\n")
+			column := len(before) - (strings.LastIndexByte(before, '\n') + 1) + 1
+			p.entries = append(p.entries, contextEntry{file: file, line: line, text: sm.Match.String(), match: len(p.matches)})
+			p.matches = append(p.matches, Match{File: file, Line: line, Text: sm.Match.String(), Column: column})
+		}
+		return
+	}
+
+	start := 0
+	for i, piece := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		line := ev.Data.LineNumber + i
+		end := start + len(piece)
+		if !isMatch {
+			p.entries = append(p.entries, contextEntry{file: file, line: line, text: trimLineEnding(piece), match: -1})
+			start = end + 1
+			continue
+		}
+		m := Match{File: file, Line: line, Text: trimLineEnding(piece)}
+		for _, sm := range ev.Data.Submatches {
+			if sm.Start >= start && sm.Start <= end {
+				m.Column = sm.Start - start + 1
+				break
+			}
+		}
+		p.entries = append(p.entries, contextEntry{file: file, line: line, text: m.Text, match: len(p.matches)})
+		p.matches = append(p.matches, m)
+		start = end + 1
+	}
+}
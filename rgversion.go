@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// rgFeature is a ripgrep flag git-regex-search may pass, with the first
+// ripgrep release that accepts it.
+type rgFeature struct {
+	flag    string
+	since   string
+	enabled func(opts *Options) bool
+}
+
+var rgFeatures = []rgFeature{
+	{flag: "--pcre2", since: "0.10.0", enabled: func(opts *Options) bool { return !opts.FixedStrings }},
+	{flag: "--glob-case-insensitive", since: "12.0.0", enabled: func(opts *Options) bool { return opts.GlobCaseInsensitive }},
+}
+
+// parseVersion parses a "major.minor.patch" version; missing parts are 0.
+func parseVersion(s string) ([3]int, bool) {
+	var v [3]int
+	parts := strings.SplitN(s, ".", 3)
+	for i, p := range parts {
+		// "13.0.0-dev" or similar suffixes
+		if j := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' }); j >= 0 {
+			p = p[:j]
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func versionLess(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// rgVersion returns the version of the installed ripgrep, parsed from the
+// "ripgrep 13.0.0 (rev ...)" line of rg --version.
+func rgVersion() (string, error) {
+	out, err := exec.Command("rg", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("rg --version failed: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 || fields[0] != "ripgrep" {
+		return "", fmt.Errorf("unrecognized rg --version output %q", strings.SplitN(string(out), "\n", 2)[0])
+	}
+	return fields[1], nil
+}
+
+// checkRgVersion fails with an actionable message when the installed ripgrep
+// is older than --engine-version-guard or than a flag this run needs, instead
+// of letting rg reject the flag on the first branch.
+func checkRgVersion(opts *Options) error {
+	if !commandExists("rg") {
+		if opts.EngineVersionGuard != "" {
+			return fmt.Errorf("--engine-version-guard %s: rg is not installed (install ripgrep %s or newer)", opts.EngineVersionGuard, opts.EngineVersionGuard)
+		}
+		return nil
+	}
+	version, err := rgVersion()
+	if err != nil {
+		return err
+	}
+	if opts.Verbose {
+		statusf("🔧 ripgrep %s\n", version)
+	}
+	installed, ok := parseVersion(version)
+	if !ok {
+		return fmt.Errorf("cannot parse ripgrep version %q", version)
+	}
+
+	if opts.EngineVersionGuard != "" {
+		required, _ := parseVersion(opts.EngineVersionGuard)
+		if versionLess(installed, required) {
+			return fmt.Errorf("ripgrep %s is installed but --engine-version-guard requires %s or newer; upgrade ripgrep", version, opts.EngineVersionGuard)
+		}
+	}
+	for _, f := range rgFeatures {
+		if !f.enabled(opts) {
+			continue
+		}
+		since, _ := parseVersion(f.since)
+		if versionLess(installed, since) {
+			return fmt.Errorf("ripgrep %s does not support %s (needs %s or newer); upgrade ripgrep or remove it from PATH to use grep", version, f.flag, f.since)
+		}
+	}
+	if exec.Command("rg", "--pcre2-version").Run() != nil {
+		return fmt.Errorf("ripgrep %s was built without PCRE2, which is required; install a build with PCRE2 or remove rg from PATH to use grep", version)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// severities lists the accepted rule severities, from lowest to highest.
+var severities = []string{"info", "low", "medium", "high", "critical"}
+
+// severityRank returns the position of severity in severities, or -1.
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// rule is a named pattern given with --rule name:severity:regex.
+type rule struct {
+	Name     string
+	Severity string
+	Pattern  string
+	// index is the position of Pattern in Options.Patterns.
+	index int
+}
+
+// parseRule parses a --rule name:severity:regex value. The regex is last so
+// that it may contain colons.
+func parseRule(spec string) (rule, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) < 3 || parts[0] == "" || parts[2] == "" {
+		return rule{}, fmt.Errorf("invalid --rule %q (expected name:severity:regex)", spec)
+	}
+	if severityRank(parts[1]) < 0 {
+		return rule{}, fmt.Errorf("invalid severity %q in --rule %q (expected one of: %s)", parts[1], spec, strings.Join(severities, ", "))
+	}
+	return rule{Name: parts[0], Severity: parts[1], Pattern: parts[2]}, nil
+}
+
+// tagRules sets the rule and severity of every match to those of the most
+// severe --rule whose pattern matches its text; ties go to the first rule.
+func tagRules(opts *Options, matches []Match) {
+	if len(opts.Rules) == 0 {
+		return
+	}
+	for i := range matches {
+		if matches[i].Binary {
+			continue
+		}
+		for _, r := range opts.Rules {
+			if severityRank(r.Severity) > severityRank(matches[i].Severity) && opts.patternREs[r.index].MatchString(matches[i].Text) {
+				matches[i].Rule = r.Name
+				matches[i].Severity = r.Severity
+			}
+		}
+	}
+}
+
+// maxSeverity returns the highest severity among the recorded matches, or ""
+// if no match was tagged by a rule.
+func (r *Result) maxSeverity() string {
+	highest := -1
+	for _, m := range r.Matches {
+		highest = max(highest, severityRank(m.Severity))
+	}
+	if highest < 0 {
+		return ""
+	}
+	return severities[highest]
+}
+
+// severityCounts returns the number of recorded matches per severity.
+func (r *Result) severityCounts() map[string]int {
+	counts := map[string]int{}
+	for _, m := range r.Matches {
+		if m.Severity != "" {
+			counts[m.Severity]++
+		}
+	}
+	return counts
+}
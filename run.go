@@ -0,0 +1,922 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func runSearch(opts *Options) error {
+	if err := compilePatterns(opts); err != nil {
+		return err
+	}
+
+	startProgress(opts)
+	warnERE(opts)
+	// git grep searches instead of the engine when nothing is checked out
+	if opts.CheckoutStrategy != "none" && !opts.TrackedOnly && containsString(opts.searchEngines(), "rg") {
+		if err := checkRgVersion(opts); err != nil {
+			return err
+		}
+	}
+	if opts.StrictRegex {
+		if err := checkEnginePatterns(opts); err != nil {
+			return err
+		}
+	}
+	verboseGit = opts.Verbose
+	readOnlyGit = opts.ReadOnly
+	normalizePaths = opts.NormalizePaths
+	crlfLineEndings = opts.NewlineHandling == "crlf"
+	engineMismatches.Store(0)
+	matchOutput.reset(opts.MaxOutputBytes)
+	setColorMode(opts.Color)
+
+	// The time budget is only checked between branches, so a branch that is
+	// being searched when it runs out is finished and the repository restored.
+	ctx := context.Background()
+	if opts.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxRuntime)
+		defer cancel()
+	}
+
+	res := &Result{invalidUTF8: opts.InvalidUTF8, occurrenceRE: opts.occurrenceRE()}
+	if opts.Checkpoint != "" {
+		cp, err := loadCheckpoint(opts.Checkpoint, opts.patternLabel())
+		if err != nil {
+			return err
+		}
+		res.checkpoint = cp
+	}
+	for i, repo := range opts.Repos {
+		if i > 0 {
+			statusln()
+		}
+		if res.checkRuntime(ctx, opts.MaxRuntime) {
+			break
+		}
+		repoPath, cleanup, err := prepareRepo(repo)
+		if err == nil {
+			err = searchRepo(ctx, opts, repoPath, res)
+			cleanup()
+		}
+		if errors.Is(err, errInterrupted) {
+			return cli.Exit("🛑 Interrupted: the repository was restored, results are incomplete", 130)
+		}
+		if err != nil {
+			// Fleet scans from --repo-file keep going past a broken repository
+			if opts.RepoFile == "" {
+				return err
+			}
+			res.addError("repository %s skipped: %v", repo, err)
+			continue
+		}
+		res.Summary.Repositories++
+		if res.Summary.Stopped {
+			break
+		}
+	}
+
+	return finishRun(opts, res)
+}
+
+// compilePatterns validates the patterns and compiles them for the Go-side
+// filters, applying --smart-case and --regex-flags. With --fixed-strings the
+// patterns are quoted instead, as they are not regexes to validate.
+func compilePatterns(opts *Options) error {
+	var alternatives []string
+	opts.patternREs = nil
+	// A pattern read from --regex-file is reported with its line
+	withOrigin := func(i int, err error) error {
+		if i < len(opts.patternOrigins) && opts.patternOrigins[i] != "" {
+			return fmt.Errorf("%s: %v", opts.patternOrigins[i], err)
+		}
+		return err
+	}
+	for i, p := range opts.Patterns {
+		if opts.FixedStrings {
+			p = regexp.QuoteMeta(p)
+		} else if opts.NewlineHandling != "multiline" {
+			if err := checkLineByLine(p); err != nil {
+				return withOrigin(i, err)
+			}
+		}
+		if opts.ignoreCase() {
+			p = "(?i)" + p
+		}
+		if opts.RegexFlags != "" {
+			p = "(?" + opts.RegexFlags + ")" + p
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return withOrigin(i, fmt.Errorf("invalid regex %q: %v", p, err))
+		}
+		if opts.CaptureGroup > re.NumSubexp() {
+			return withOrigin(i, fmt.Errorf("--capture-group %d exceeds the %d group(s) in regex %q", opts.CaptureGroup, re.NumSubexp(), p))
+		}
+		opts.patternREs = append(opts.patternREs, re)
+		alternatives = append(alternatives, "(?:"+p+")")
+	}
+	opts.re = regexp.MustCompile(strings.Join(alternatives, "|"))
+
+	return nil
+}
+
+// finishRun runs the match hooks, renders the results, prints the summary and
+// runs --post-command. The returned error carries the exit status of a failed
+// post-command, --compare-engines-on-mismatch, --max-runtime and
+// --fail-on-severity.
+func finishRun(opts *Options, res *Result) error {
+	if opts.OnMatchExec != "" {
+		runMatchHooks(opts, res)
+	}
+
+	if opts.CountUniqueFiles {
+		res.Summary.UniqueFiles = res.uniqueFiles()
+	}
+	if opts.Sample > 0 {
+		// Only what is printed is sampled; the counts stay those of the run
+		res.Matches = sampleMatches(opts, res.Matches)
+		all := *opts
+		all.Sample = 0
+		emitMatches(&all, res, res.Matches)
+	}
+	if opts.Aggregate {
+		printAggregatedMatches(matchOutput, opts.re, displayMatches(opts, res, res.Matches))
+	}
+	if !opts.streamsText() {
+		recorded := res.Matches
+		res.Matches = displayMatches(opts, res, recorded)
+		var err error
+		if opts.WebhookURL != "" {
+			var payload bytes.Buffer
+			if err = renderResults(&payload, opts, res); err == nil {
+				err = postWebhook(opts.WebhookURL, payload.Bytes())
+			}
+			if err == nil {
+				statusln("💬 Posted the results to --webhook-url")
+			}
+		} else {
+			err = renderResults(matchOutput, opts, res)
+		}
+		res.Matches = recorded
+		if err != nil {
+			return err
+		}
+	}
+	// Recorded after rendering so that diffstat compares with the run before
+	if opts.CacheDir != "" && opts.Patch == "" {
+		if err := saveLastRun(opts, res); err != nil {
+			res.addError("%v", err)
+		}
+	}
+
+	statusln()
+	switch {
+	case opts.Patch != "":
+		statusf("📊 Found %d matches in the added lines\n", res.Summary.TotalMatches)
+	case opts.WorkingDiff:
+		statusf("📊 Found %d matches in the uncommitted changes\n", res.Summary.TotalMatches)
+	case len(opts.Repos) > 1:
+		statusf("📊 Found %d matches in %d of %d branches across %d repositories\n",
+			res.Summary.TotalMatches, res.Summary.BranchesWithMatches, res.Summary.BranchesSearched, res.Summary.Repositories)
+	default:
+		statusf("📊 Found %d matches in %d of %d branches\n",
+			res.Summary.TotalMatches, res.Summary.BranchesWithMatches, res.Summary.BranchesSearched)
+	}
+	if opts.CountOccurrences {
+		statusf("🔢 %d occurrences in the matching lines (--count-occurrences)\n", res.Summary.TotalOccurrences)
+	}
+	if opts.CountUniqueFiles {
+		statusf("🗂️  %d distinct files matched across all branches (--count-unique-files)\n", res.Summary.UniqueFiles)
+	}
+	if n := res.Summary.BranchesTimedOut; n > 0 {
+		statusf("⏰ %d branches timed out (--branch-timeout %s)\n", n, opts.BranchTimeout)
+	}
+	if opts.QuietNoMatch && opts.Patch == "" {
+		statusf("🧹 %d branches had no matches\n", res.Summary.BranchesSearched-res.Summary.BranchesWithMatches)
+	}
+	if res.Summary.Stopped {
+		statusf("🛑 Stopped at %s\n", res.stopReason)
+	}
+	statusln("✨ Search completed!")
+	total := res.Summary.TotalMatches
+	progressEvents.emit(progressEvent{Event: "done", TotalMatches: &total})
+	if opts.PostCommand != "" {
+		if err := runPostCommand(opts, res); err != nil {
+			return err
+		}
+	}
+	if n := engineMismatches.Load(); opts.CompareEngines && n > 0 {
+		return fmt.Errorf("rg and grep disagreed on %d matched lines (--compare-engines-on-mismatch); the pattern is probably not portable between their regex dialects", n)
+	}
+	if matchOutput.overLimit() {
+		return cli.Exit(matchOutput.truncationNotice(res.Summary.Stopped), 4)
+	}
+	if res.outOfTime {
+		return cli.Exit(fmt.Sprintf("⏱️  Stopped due to time budget: results are partial (--max-runtime %s)", opts.MaxRuntime), 3)
+	}
+	if res.Summary.TotalMatches == 0 {
+		// Like grep, for pipelines and CI jobs that test for a match
+		return cli.Exit("", 1)
+	}
+	if opts.FailOnSeverity != "" {
+		if highest := res.maxSeverity(); highest != "" && severityRank(highest) >= severityRank(opts.FailOnSeverity) {
+			return cli.Exit(fmt.Sprintf("🚨 Found %s severity matches (--fail-on-severity %s)", highest, opts.FailOnSeverity), 5)
+		}
+	}
+	return nil
+}
+
+// searchBranchContents returns the raw matches of branch: its files, the
+// pinned commits of its submodules and its commit messages, as requested.
+func searchBranchContents(opts *Options, ws *workspace, branch string) ([]Match, error) {
+	repoPath := ws.repoPath
+	if opts.ChangedSince != "" {
+		files, err := changedFiles(repoPath, opts.ChangedSince, branchRef(repoPath, branch))
+		if err != nil {
+			return nil, fmt.Errorf("--changed-since failed on branch %s: %v", branch, err)
+		}
+		c := *opts
+		c.changedFiles = files
+		opts = &c
+	}
+	matches, err := searchBranch(opts, ws, branch)
+	if skipsBranch(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search failed on branch %s: %v", branch, err)
+	}
+	if opts.SearchSubmodules {
+		if ws.strategy == "checkout" {
+			matches = dropSubmoduleMatches(repoPath, matches)
+		}
+		sub, err := searchSubmodules(opts, repoPath, branchRef(repoPath, branch), "")
+		if err != nil {
+			return nil, fmt.Errorf("submodule search failed on branch %s: %v", branch, err)
+		}
+		matches = append(matches, sub...)
+	}
+	if opts.RespectExportIgnore {
+		matches = filterExportIgnored(ws, branch, matches)
+	}
+	if opts.changedFiles != nil {
+		matches = keepChangedFiles(opts.changedFiles, matches)
+	}
+	if opts.SearchCommits {
+		commits, err := searchCommitMessages(repoPath, opts, branchRef(repoPath, branch))
+		if err != nil {
+			return nil, fmt.Errorf("commit message search failed on branch %s: %v", branch, err)
+		}
+		matches = append(matches, commits...)
+	}
+	return matches, nil
+}
+
+func searchRepo(ctx context.Context, opts *Options, repoPath string, res *Result) (err error) {
+	// Recorded by --since-last-run; commits made during the search are
+	// searched again next time rather than missed
+	started := time.Now()
+
+	// Ensure repo exists
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); os.IsNotExist(err) {
+		return fmt.Errorf("not a git repository: %s", repoPath)
+	}
+
+	// Get current branch
+	currentBranch, err := runGitCmd(repoPath, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %v", err)
+	}
+
+	// When several repositories are searched, label each match with the repo name
+	var repoName string
+	if len(opts.Repos) > 1 {
+		repoName = filepath.Base(repoPath)
+	}
+	if res.repoPaths == nil {
+		res.repoPaths = make(map[string]string)
+	}
+	res.repoPaths[repoName] = repoPath
+
+	statusf("📁 Repository: %s\n", repoPath)
+	statusf("🔍 Search pattern: %s\n", opts.patternLabel())
+	statusf("🌿 Current branch: %s\n", currentBranch)
+	statusln()
+
+	if opts.StrictBranches && len(opts.Branches) > 0 {
+		if err := checkBranchesExist(opts, repoPath); err != nil {
+			return err
+		}
+	}
+
+	if opts.ResetLastRun {
+		if err := resetRunStamp(repoPath); err != nil {
+			return err
+		}
+		statusln("🕰️  Forgot the last run (--reset-last-run)")
+	}
+
+	if opts.MatchBranchNames {
+		return searchBranchNames(opts, repoPath, repoName, res)
+	}
+	if opts.searchesHistory() {
+		return searchHistory(opts, repoPath, repoName, res)
+	}
+	if opts.SearchWorktrees {
+		return searchWorktrees(opts, repoPath, repoName, res)
+	}
+
+	ws := &workspace{repoPath: repoPath, dir: repoPath, strategy: opts.CheckoutStrategy}
+
+	var before repoSnapshot
+	if opts.HealthCheck {
+		if before, err = takeSnapshot(repoPath); err != nil {
+			return err
+		}
+	}
+
+	// grep only approximates ripgrep's globs
+	if (len(opts.IncludeGlobs) > 0 || len(opts.ExcludeGlobs) > 0) && !containsString(opts.searchEngines(), "rg") && ws.strategy != "none" && !opts.TrackedOnly {
+		if opts.GlobCaseInsensitive {
+			statusln("⚠️  Warning: grep matches --include-glob/--exclude-glob case-sensitively; --glob-case-insensitive needs 'rg' (ripgrep).")
+		}
+		if opts.IncludeIgnored {
+			statusln("⚠️  Warning: without 'rg' (ripgrep), grep matches --include-glob/--exclude-glob against file names only, so globs with a '/' may not match.")
+		}
+	}
+
+	// Once the changes are stashed, an error, a panic or an interrupt anywhere
+	// below still has to put the repository back unless --no-restore-on-error
+	// asks to keep it as is
+	restoreSparse := func() {}
+	restored := false
+	stashed := false
+	if ws.strategy == "checkout" {
+		if err := confirmCheckout(opts, repoPath, currentBranch); err != nil {
+			return err
+		}
+		unlock, lockErr := acquireRepoLock(repoPath, opts.WaitForLock)
+		if lockErr != nil {
+			return lockErr
+		}
+		defer unlock()
+
+		// SIGINT and SIGTERM no longer kill the process; they stop the search
+		// at the next branch and the cleanup below runs as for any error
+		var stopSignals context.CancelFunc
+		ctx, stopSignals = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stopSignals()
+
+		// Stash changes
+		statusln("💾 Stashing uncommitted changes...")
+		stashed = pushTempStash(repoPath)
+		defer func() {
+			p := recover()
+			if err != nil && interrupted(ctx) {
+				// Ctrl-C also reaches the engine, which fails first
+				err = errInterrupted
+			}
+			cause := err
+			if p != nil {
+				cause = fmt.Errorf("panic: %v", p)
+			}
+			if cause != nil && !restored {
+				restored = true
+				switch {
+				case opts.NoRestoreOnError:
+					reportUnrestored(opts, repoPath, currentBranch, cause)
+				case errors.Is(cause, errInterrupted):
+					statusln()
+					statusln("🛑 Interrupted, restoring the repository...")
+					restoreSparse()
+					restoreRepo(opts, repoPath, currentBranch, stashed)
+				default:
+					statusln()
+					statusf("⚠️  Search failed, restoring the repository: %v\n", cause)
+					restoreSparse()
+					restoreRepo(opts, repoPath, currentBranch, stashed)
+				}
+			}
+			if p != nil {
+				panic(p)
+			}
+		}()
+	}
+
+	shallow := isShallowRepo(repoPath)
+	if shallow && opts.Unshallow {
+		statusln("📚 Fetching full history (--unshallow)...")
+		if _, err := runGitCmd(repoPath, "fetch", "--unshallow", "--quiet"); err != nil {
+			return fmt.Errorf("failed to unshallow repository: %v", err)
+		}
+		shallow = false
+	} else if shallow {
+		statusln("⚠️  Warning: this is a shallow clone. History is truncated, so --newer-than, --search-commits,")
+		statusln("   --author and --committer may miss results; pass --unshallow to fetch the full history first.")
+	}
+
+	// Pull remote branches list
+	fetchRemotes(opts, repoPath)
+
+	// Read before --sparse sets skip-worktree bits of its own
+	var localOnly map[string]bool
+	if opts.SkipAssumeUnchanged {
+		localOnly, err = localOnlyFiles(repoPath)
+		if err != nil {
+			return err
+		}
+		if len(localOnly) > 0 {
+			statusf("🙈 Leaving out %d assume-unchanged/skip-worktree files\n", len(localOnly))
+		}
+	}
+
+	if len(opts.SparsePaths) > 0 {
+		statusf("🪶 Limiting the checkout to %s (sparse-checkout)...\n", strings.Join(opts.SparsePaths, ", "))
+		restore, sparseErr := enableSparseCheckout(repoPath, opts.SparsePaths)
+		if sparseErr != nil {
+			return sparseErr
+		}
+		restoreSparse = restore
+		defer func() {
+			if err == nil || !opts.NoRestoreOnError {
+				restoreSparse()
+			}
+		}()
+	}
+
+	if ws.strategy == "worktree" {
+		// As with checkout, a signal stops the search at the next branch so
+		// that the temporary worktree is still removed
+		var stopSignals context.CancelFunc
+		ctx, stopSignals = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stopSignals()
+		defer func() {
+			if err != nil && interrupted(ctx) {
+				// Ctrl-C also reaches the engine, which fails first
+				err = errInterrupted
+			}
+		}()
+
+		statusln("🌳 Creating temporary worktree...")
+		dir, cleanup, err := addTempWorktree(repoPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			statusln("🧹 Removing temporary worktree...")
+			cleanup()
+		}()
+		ws.dir = dir
+	}
+
+	branches, err := listBranches(opts, repoPath)
+	if err != nil {
+		return err
+	}
+	if shallow && opts.Deepen > 0 {
+		deepenBranches(repoPath, branches, opts.Deepen)
+	}
+	if shallow || len(opts.Branches) > 0 {
+		var missing []string
+		branches, missing = availableBranches(repoPath, branches)
+		reason := "no such branch"
+		if shallow {
+			reason = "not available in this shallow clone"
+		}
+		for _, b := range missing {
+			statusf("⚠️  Skipping branch %s: %s\n", branchColor(b), reason)
+		}
+	}
+	if len(branches) < opts.MinBranches {
+		statusln()
+		statusf("⚠️  WARNING: only %d branch(es) resolved in %s (expected at least %d).\n", len(branches), repoPath, opts.MinBranches)
+		statusln("   No matches would NOT mean the repository is clean. Check --branches / --ref-glob for typos.")
+		if !opts.AllowEmptyBranches {
+			if ws.strategy == "checkout" {
+				restoreSparse()
+				restoreRepo(opts, repoPath, currentBranch, stashed)
+				restored = true
+			}
+			return fmt.Errorf("too few branches to search (pass --allow-empty-branches to search anyway)")
+		}
+	}
+	if opts.Prioritize {
+		statusln("📈 Pre-scanning branches to search the most promising ones first...")
+		branches = prioritizeBranches(opts, repoPath, branches)
+	}
+	if opts.NewerThan != "" {
+		branches = filterNewerThan(repoPath, opts.NewerThan, branches)
+		statusf("🕒 %d branches contain %s\n", len(branches), opts.NewerThan)
+	}
+	if opts.SinceTag != "" {
+		since, err := commitTime(repoPath, "refs/tags/"+opts.SinceTag)
+		if err != nil {
+			return fmt.Errorf("--since-tag %s: no such tag in %s", opts.SinceTag, repoPath)
+		}
+		opts.sinceTime = since
+		branches = filterUpdatedSince(repoPath, since, branches)
+		statusf("🏷️  %d branches were updated after %s (%s)\n", len(branches), opts.SinceTag, time.Unix(since, 0).Format("2006-01-02 15:04:05 -0700"))
+	}
+	if opts.SinceLastRun {
+		opts.sinceTime = 0
+		if since, ok := readRunStamp(repoPath); ok && !opts.ResetLastRun {
+			opts.sinceTime = since
+			branches = filterUpdatedSince(repoPath, since, branches)
+			statusf("🕰️  %d branches were updated since the last run (%s)\n", len(branches), time.Unix(since, 0).Format("2006-01-02 15:04:05 -0700"))
+		} else {
+			statusln("🕰️  No previous run recorded, searching every branch (--since-last-run)")
+		}
+	}
+
+	cache, err := newResultCache(opts)
+	if err != nil {
+		return err
+	}
+
+	// With --max-branches-parallel the raw searches run ahead in their own
+	// worktrees; everything else below still happens in branch order
+	pool := newWorkspacePool(ws, 1)
+	var prefetched []chan rawBranch
+	if opts.MaxBranchesParallel > 1 {
+		limit := opts.MaxBranchesParallel
+		if opts.MaxWorktrees > 0 {
+			limit = min(limit, opts.MaxWorktrees)
+		}
+		pool = newWorkspacePool(ws, limit)
+		defer func() {
+			if ws.strategy == "worktree" {
+				statusf("🌳 Used %d of at most %d worktrees at once\n", pool.peak(), limit)
+			}
+			pool.close()
+		}()
+		skip := make(map[string]bool)
+		for _, b := range branches {
+			if _, ok := res.checkpoint.done(repoPath, b); ok {
+				skip[b] = true
+			}
+		}
+		var stop func()
+		prefetched, stop = prefetchBranches(opts, pool, cache, branches, skip)
+		defer stop()
+	}
+
+	// Matches of the previously searched branch, used by --annotate-new
+	var previous map[string]bool
+
+	var originalHead string
+	if opts.BatchSize > 0 {
+		originalHead, _ = runGitCmd(repoPath, "rev-parse", "HEAD")
+	}
+
+	review := newBranchReview(opts)
+	defer review.close()
+
+	statusf("Searching across %d branches...\n\n", len(branches))
+	progressEvents.emit(progressEvent{Event: "repo_started", Repo: repoPath, BranchesTotal: len(branches)})
+
+	for i, branch := range branches {
+		if interrupted(ctx) {
+			return errInterrupted
+		}
+		if res.checkRuntime(ctx, opts.MaxRuntime) {
+			break
+		}
+		if opts.Nice && i > 0 {
+			time.Sleep(opts.NiceDelay)
+		}
+		if opts.BatchSize > 0 && i > 0 && i%opts.BatchSize == 0 {
+			if err := checkRepoHealth(opts, repoPath, currentBranch, originalHead, i); err != nil {
+				return err
+			}
+		}
+
+		label := branchLabel(opts, repoPath, branch)
+		progressEvents.emit(progressEvent{Event: "branch_started", Repo: repoPath, Branch: label, BranchIndex: i + 1, BranchesTotal: len(branches)})
+		if done, ok := res.checkpoint.done(repoPath, branch); ok {
+			statusf("\n⏭️  Skipping branch %s (completed in checkpoint, %d matches)\n", branchColor(branch), len(done))
+			done = res.limitTotal(opts.MatchLimitTotal, done)
+			res.addBranch(repoName, label, done)
+			progressEvents.branchDone("branch_completed", repoPath, label, len(done), res.Summary.TotalMatches)
+			emitMatches(opts, res, done)
+			if res.Summary.Stopped {
+				break
+			}
+			continue
+		}
+
+		// With --quiet-no-match the banner waits until the branch turns out to match
+		banner := fmt.Sprintf("\n🔍 Searching branch: %s\n", branchColor(branch))
+		if !opts.QuietNoMatch {
+			statusf("%s", banner)
+		}
+		var raw rawBranch
+		streamed := false
+		if prefetched != nil {
+			raw = <-prefetched[i]
+		} else {
+			if opts.MatchAsYouGo {
+				opts.onEngineMatch = streamMatches(opts, res, localOnly, repoName, label, &streamed)
+			}
+			raw = fetchRawBranch(opts, pool, cache, branch)
+			opts.onEngineMatch = nil
+		}
+		blameRev := ws.blameRev(branch)
+		if raw.cached || prefetched != nil {
+			// The tree was not checked out for this branch, or has moved on
+			// to another one; blame the commit instead
+			blameRev = branchRef(repoPath, branch)
+		}
+		if raw.cached {
+			statusf("♻️  Reusing cached results for %s at %s\n", branchColor(branch), shortSHA(raw.tip))
+		}
+		var timeoutErr *branchTimeoutError
+		if errors.As(raw.err, &timeoutErr) {
+			if opts.QuietNoMatch {
+				statusf("%s", banner)
+			}
+			statusf("⏰ Branch %s timed out after %s (--branch-timeout), moving on\n", branchColor(branch), opts.BranchTimeout)
+			res.addTimedOut(repoName, label)
+			progressEvents.branchDone("branch_timed_out", repoPath, label, 0, res.Summary.TotalMatches)
+			continue
+		}
+		if skipsBranch(raw.err) {
+			res.addError("skipping branch %s: %v", branch, raw.err)
+			progressEvents.branchDone("branch_skipped", repoPath, label, 0, res.Summary.TotalMatches)
+			continue
+		}
+		if raw.err != nil {
+			return raw.err
+		}
+		matches := dropLocalOnly(localOnly, raw.matches)
+		matches = filterNotMatching(opts, matches)
+		matches = filterLineRange(opts, matches)
+		matches = filterLineLength(opts, matches)
+		annotateMatches(opts, repoName, label, matches)
+		tagRules(opts, matches)
+		matches = extractValues(opts, res, matches)
+		matches = filterByBlame(opts, ws.dir, blameRev, matches)
+		matches = dedupeText(opts, matches)
+		matches = limitPerFile(opts, matches)
+		if opts.FirstMatch && len(matches) > 1 {
+			matches = matches[:1]
+		}
+		if opts.AnnotateNew {
+			current := make(map[string]bool, len(matches))
+			for i := range matches {
+				k := matches[i].key()
+				matches[i].New = !previous[k]
+				current[k] = true
+			}
+			previous = current
+		}
+		if len(matches) > 0 && len(matches) < opts.MinMatches {
+			statusf("🔇 Ignoring %d matches in %s (below --min-matches %d)\n", len(matches), branchColor(branch), opts.MinMatches)
+			matches = nil
+		}
+		matches = res.limitTotal(opts.MatchLimitTotal, matches)
+
+		res.addBranch(repoName, label, matches)
+		progressEvents.branchDone("branch_completed", repoPath, label, len(matches), res.Summary.TotalMatches)
+		if err := res.checkpoint.record(repoPath, branch, matches); err != nil {
+			return err
+		}
+		if opts.OutputDir != "" {
+			if err := writeBranchFile(opts, res, repoName, label, matches); err != nil {
+				return err
+			}
+		}
+		switch {
+		case len(matches) > 0:
+			if opts.QuietNoMatch {
+				statusf("%s", banner)
+			}
+			statusf("✅ Found %d matches in %s\n", len(matches), branchColor(branch))
+		case !opts.QuietNoMatch:
+			statusf("❌ No matches found in %s\n", branchColor(branch))
+		}
+
+		if !streamed {
+			emitMatches(opts, res, matches)
+		}
+		if opts.ShowDiff != "" && opts.streamsText() && !opts.filesOnly() {
+			printMatchDiffs(matchOutput, repoPath, opts.ShowDiff, branchRef(repoPath, branch), matches)
+		}
+
+		if review != nil {
+			action, err := review.ask(branch)
+			for err == nil && action == reviewRerun {
+				if err = review.rerunBranch(opts, pool, repoName, label, branch); err == nil {
+					action, err = review.ask(branch)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if action == reviewStop {
+				res.stop("your request (--interactive-confirm-per-branch)")
+			}
+		}
+		if opts.FirstMatch && len(matches) > 0 {
+			res.stop("the first match (--first-match)")
+		}
+		if matchOutput.overLimit() {
+			res.stop(fmt.Sprintf("the output limit of %d bytes (--max-output-bytes)", opts.MaxOutputBytes))
+		}
+		if res.Summary.Stopped {
+			break
+		}
+	}
+
+	if opts.SearchNotes && !res.Summary.Stopped {
+		notes, err := searchNotes(repoPath, opts)
+		if err != nil {
+			return err
+		}
+		for i := range notes {
+			notes[i].Repo = repoName
+			notes[i].Branch = "notes"
+		}
+		notes = filterNotMatching(opts, notes)
+		tagRules(opts, notes)
+		notes = res.limitTotal(opts.MatchLimitTotal, notes)
+		res.addBranch(repoName, "notes", notes)
+		if len(notes) > 0 {
+			statusf("✅ Found %d matches in %s\n", len(notes), branchColor("notes"))
+			emitMatches(opts, res, notes)
+		}
+	}
+
+	if opts.SearchStash && !res.Summary.Stopped {
+		stashes, err := listStashes(repoPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range stashes {
+			if interrupted(ctx) {
+				return errInterrupted
+			}
+			if res.checkRuntime(ctx, opts.MaxRuntime) {
+				break
+			}
+			matches, err := searchStash(opts, repoPath, entry)
+			if err != nil {
+				return fmt.Errorf("search failed on %s: %v", entry.label, err)
+			}
+			for i := range matches {
+				matches[i].Repo = repoName
+				matches[i].Branch = entry.label
+			}
+			matches = dropLocalOnly(localOnly, matches)
+			matches = filterNotMatching(opts, matches)
+			matches = filterLineRange(opts, matches)
+			matches = filterLineLength(opts, matches)
+			matches = limitPerFile(opts, matches)
+			tagRules(opts, matches)
+			matches = res.limitTotal(opts.MatchLimitTotal, matches)
+			res.addBranch(repoName, entry.label, matches)
+			if len(matches) > 0 {
+				statusf("✅ Found %d matches in %s\n", len(matches), branchColor(entry.label))
+				emitMatches(opts, res, matches)
+			}
+			if res.Summary.Stopped {
+				break
+			}
+		}
+	}
+
+	if opts.IncludeDangling && !res.Summary.Stopped {
+		if err := searchDangling(opts, repoPath, repoName, res); err != nil {
+			res.addError("dangling object search failed: %v", err)
+		}
+	}
+
+	if opts.SinceLastRun && !res.Summary.Stopped {
+		if err := writeRunStamp(repoPath, started.Unix()); err != nil {
+			res.addError("%v", err)
+		}
+	}
+
+	statusln()
+	if ws.strategy == "checkout" {
+		// The sparse-checkout config has to be back before the stash is popped
+		restoreSparse()
+		restored = true
+		if err := restoreRepo(opts, repoPath, currentBranch, stashed); err != nil {
+			return err
+		}
+	}
+	if opts.HealthCheck {
+		return verifyRestored(repoPath, before)
+	}
+
+	return nil
+}
+
+// annotateMatches labels the matches of a branch with the repository, branch,
+// pattern and column they were found at.
+func annotateMatches(opts *Options, repoName, label string, matches []Match) {
+	for i := range matches {
+		matches[i].Repo = repoName
+		matches[i].Branch = label
+		if len(opts.Patterns) > 1 && !matches[i].Binary {
+			if p := opts.patternFor(matches[i].Text); p >= 0 {
+				matches[i].Pattern = opts.Patterns[p]
+			}
+		}
+		// rg reports the column it matched at itself
+		if opts.onlyMatching() || matches[i].Binary || matches[i].Column > 0 {
+			continue
+		}
+		if loc := opts.re.FindStringIndex(matches[i].Text); loc != nil {
+			matches[i].Column = loc[0] + 1
+		}
+	}
+}
+
+// restoreStrategies lists the accepted values of --restore-strategy.
+var restoreStrategies = []string{"full", "branch-only", "none"}
+
+// restoreRepo puts the repository back into its original state after a
+// checkout-based search, as far as --restore-strategy asks for. When the
+// original branch or the stash cannot be restored, it says how to recover
+// by hand and returns an error, so that the run fails.
+func restoreRepo(opts *Options, repoPath, currentBranch string, stashed bool) error {
+	switch opts.RestoreStrategy {
+	case "none":
+		statusln("⏸️  Leaving the repository on the last searched branch (--restore-strategy none)")
+		if stashed {
+			statusf("   Restore manually with: git checkout %s && git stash pop\n", currentBranch)
+		} else {
+			statusf("   Restore manually with: git checkout %s\n", currentBranch)
+		}
+		return nil
+	case "branch-only":
+		statusf("🔄 Restoring original branch: %s\n", currentBranch)
+		if err := checkoutBranch(opts, repoPath, currentBranch); err != nil {
+			statusf("⚠️  Warning: %v\n", err)
+			statusf("   Restore manually with: git checkout %s\n", currentBranch)
+			return fmt.Errorf("failed to restore the original branch %s: %v", currentBranch, err)
+		}
+		if stashed {
+			statusln("⏸️  Leaving stashed changes in the stash (--restore-strategy branch-only); restore with: git stash pop")
+		}
+		return nil
+	}
+
+	// Restore original branch and stash
+	statusf("🔄 Restoring original branch: %s\n", currentBranch)
+	if err := checkoutBranch(opts, repoPath, currentBranch); err != nil {
+		// Popping the stash onto another branch would mix up the user's changes
+		statusf("⚠️  Warning: %v\n", err)
+		statusf("   Your changes are still stashed; restore manually with: git checkout %s && git stash pop\n", currentBranch)
+		return fmt.Errorf("failed to restore the original branch %s: %v", currentBranch, err)
+	}
+	if !stashed {
+		// A clean tree stashes nothing, and popping anyway would apply
+		// whatever stash entry the user had on top
+		return nil
+	}
+	statusln("📤 Restoring stashed changes...")
+	if _, err := runGitCmd(repoPath, "stash", "pop", "--quiet"); err != nil {
+		// Files created since the stash, e.g. by --pre-command, are in the way
+		statusf("⚠️  Warning: restoring the stashed changes failed: %v\n", err)
+		statusln("   Your changes are still in stash@{0}; move the conflicting files aside, then restore them with: git stash pop")
+		return fmt.Errorf("failed to restore the stashed changes (they are still in stash@{0}): %v", err)
+	}
+	return nil
+}
+
+// pushTempStash stashes the uncommitted and untracked changes of repoPath and
+// reports whether that created a stash entry. git stash push succeeds without
+// one on a clean tree, so refs/stash is compared before and after.
+func pushTempStash(repoPath string) bool {
+	before, _ := runGitCmd(repoPath, "rev-parse", "-q", "--verify", "refs/stash")
+	if _, err := runGitCmd(repoPath, "stash", "push", "--quiet", "-u", "-m", tempStashMessage); err != nil {
+		return false
+	}
+	after, _ := runGitCmd(repoPath, "rev-parse", "-q", "--verify", "refs/stash")
+	return after != "" && after != before
+}
+
+// errInterrupted is returned by a checkout-based search that SIGINT or
+// SIGTERM stopped; by then the repository has been restored.
+var errInterrupted = errors.New("interrupted")
+
+// interrupted reports whether ctx was canceled by a signal rather than by
+// running out of --max-runtime.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
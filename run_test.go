@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+func TestExitStatus(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\npassword=hunter2\n"}},
+	)
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "match", args: []string{"--regex", "TODO"}},
+		{name: "no match", args: []string{"--regex", "FIXME"}, want: 1},
+		{name: "error", args: []string{"--regex", "TODO", "--checkout-strategy", "bogus"}, want: 2},
+		{name: "severity below the threshold", args: []string{"--rule", "todo:low:TODO", "--fail-on-severity", "high"}},
+		{name: "severity at the threshold", args: []string{"--rule", "todo:low:TODO", "--rule", "password:high:password=", "--fail-on-severity", "high"}, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--repo", repo, "--checkout-strategy", "none", "--output-format", "summary"}, tt.args...)
+			_, err := runApp(t, args...)
+			got := 0
+			if err != nil {
+				got = 2
+				var exitErr cli.ExitCoder
+				if errors.As(err, &exitErr) {
+					got = exitErr.ExitCode()
+				}
+			}
+			if got != tt.want {
+				t.Errorf("exit status %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterruptRemovesTemporaryWorktree(t *testing.T) {
+	repo := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	// The pre-command sends Ctrl-C to the test binary, which runs the search,
+	// and gives it time to arrive before the next branch
+	_, err := runApp(t, "--repo", repo, "--regex", "TODO", "--worktree", "--pre-command", "kill -INT $PPID; sleep 0.2", "--output-format", "summary")
+	var exitErr cli.ExitCoder
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+		t.Fatalf("err = %v, want exit status 130", err)
+	}
+	if got := gitfixture.Git(t, repo, "worktree", "list", "--porcelain"); strings.Count(got, "worktree ") != 1 {
+		t.Errorf("temporary worktree left behind:\n%s", got)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runStampFileName is the file in the git directory of a repository where
+// --since-last-run records when the repository was last searched.
+const runStampFileName = "git-regex-search-last-run"
+
+// runStampPath returns the path of the --since-last-run state file of repoPath.
+func runStampPath(repoPath string) (string, error) {
+	gitDir, err := runGitCmd(repoPath, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory: %v", err)
+	}
+	return filepath.Join(gitDir, runStampFileName), nil
+}
+
+// readRunStamp returns the Unix time recorded by the last --since-last-run
+// search of repoPath, and false if there is none.
+func readRunStamp(repoPath string) (int64, bool) {
+	path, err := runStampPath(repoPath)
+	if err != nil {
+		return 0, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	stamp, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	return stamp, err == nil
+}
+
+// writeRunStamp records stamp as the time of the last search of repoPath.
+func writeRunStamp(repoPath string, stamp int64) error {
+	path, err := runStampPath(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(strconv.FormatInt(stamp, 10)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to record the run in %s: %v", path, err)
+	}
+	return nil
+}
+
+// resetRunStamp forgets the last --since-last-run search of repoPath.
+func resetRunStamp(repoPath string) error {
+	path, err := runStampPath(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+// sampleMatches returns a random sample of opts.Sample matches for --sample,
+// in their original order. The seed is printed so that a sample can be drawn
+// again with --seed.
+func sampleMatches(opts *Options, matches []Match) []Match {
+	if len(matches) <= opts.Sample {
+		return matches
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	r := rand.New(rand.NewPCG(seed, 0))
+	picked := r.Perm(len(matches))[:opts.Sample]
+	sort.Ints(picked)
+	sample := make([]Match, len(picked))
+	for i, idx := range picked {
+		sample[i] = matches[idx]
+	}
+	statusf("🎲 Showing a random sample of %d of %d matches (--seed %d)\n", len(sample), len(matches), seed)
+	return sample
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+func commandExists(cmd string) bool {
+	_, err := exec.LookPath(cmd)
+	return err == nil
+}
+
+// selectedEngine returns the name of the search engine grepRepo will use.
+func selectedEngine() string {
+	if commandExists("rg") {
+		return "rg"
+	}
+	return "grep"
+}
+
+// engineCommand builds the engine invocation, lowering its CPU priority with
+// nice(1) when --nice is set and nice is available. It is killed when the
+// --branch-timeout of the branch being searched runs out.
+func engineCommand(opts *Options, name string, args ...string) *exec.Cmd {
+	if opts.Nice && commandExists("nice") {
+		return exec.CommandContext(opts.context(), "nice", append([]string{"-n", "19", name}, args...)...)
+	}
+	return exec.CommandContext(opts.context(), name, args...)
+}
+
+// engineChoices lists the accepted values of --engine.
+var engineChoices = []string{"auto", "rg", "grep", "all"}
+
+// searchEngines returns the engines grepRepo runs for --engine: auto picks
+// rg if installed, all runs every installed engine.
+func (o *Options) searchEngines() []string {
+	switch o.Engine {
+	case "rg", "grep":
+		return []string{o.Engine}
+	case "all":
+		var engines []string
+		for _, e := range []string{"rg", "grep"} {
+			if commandExists(e) {
+				engines = append(engines, e)
+			}
+		}
+		return engines
+	}
+	return []string{selectedEngine()}
+}
+
+// engineMismatches counts the lines that not every engine matched with
+// --compare-engines-on-mismatch. runSearch resets it; it is shared by the
+// branches searched in parallel.
+var engineMismatches atomic.Int64
+
+// grepRepo searches the files in repoPath with the --engine engines. With
+// several engines the matches are merged by file and line, keeping the first
+// engine's copy; --verbose and --compare-engines-on-mismatch report the
+// matches only some engines found.
+func grepRepo(repoPath string, opts *Options) ([]Match, error) {
+	engines := opts.searchEngines()
+	var matches []Match
+	foundBy := make(map[string][]string)
+	var order []string
+	for _, engine := range engines {
+		bounded, cancel := opts.withPatternTimeout()
+		lines, err := runEngine(engine, repoPath, bounded)
+		timedOut := bounded.patternTimedOut()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if timedOut {
+			return nil, &patternTimeoutError{engine: engine, timeout: opts.PatternTimeout}
+		}
+		reportEngineLimits(engine, lines)
+		for _, m := range parseEngineOutput(engine, lines, opts) {
+			// Compare paths the same way whatever --normalize-paths says
+			k := fmt.Sprintf("%s:%d", strings.TrimPrefix(path.Clean(m.File), "./"), m.Line)
+			if opts.onlyMatching() {
+				k += ":" + m.Text
+			}
+			if by, seen := foundBy[k]; seen {
+				if by[len(by)-1] != engine {
+					foundBy[k] = append(by, engine)
+				}
+				continue
+			}
+			foundBy[k] = []string{engine}
+			order = append(order, k)
+			matches = append(matches, m)
+		}
+	}
+	if (opts.Verbose || opts.CompareEngines) && len(engines) > 1 {
+		for _, k := range order {
+			if by := foundBy[k]; len(by) < len(engines) {
+				statusf("🔬 Only %s matched %s\n", strings.Join(by, ", "), k)
+				engineMismatches.Add(1)
+			}
+		}
+	}
+	return matches, nil
+}
+
+// parseEngineOutput returns the matches in the output lines of engine: rg's
+// JSON messages, or grep's text lines.
+func parseEngineOutput(engine string, lines []string, opts *Options) []Match {
+	if engine == "rg" {
+		return parseRgJSON(lines, opts)
+	}
+	return parseWithContext(lines, opts.BeforeLines, opts.AfterLines, "", opts.re, parseEngineLine)
+}
+
+// engineStream returns the handler engineOutput feeds the output lines of
+// engine to with --match-as-you-go, which passes every match on to
+// opts.onEngineMatch as soon as it is complete, or nil without it.
+func engineStream(engine string, opts *Options) func(string) {
+	if opts.onEngineMatch == nil {
+		return nil
+	}
+	if engine == "rg" {
+		p := newRgJSONParser(opts)
+		return func(line string) {
+			for _, m := range p.feed(line) {
+				opts.onEngineMatch(m)
+			}
+		}
+	}
+	return func(line string) {
+		if m, ok := parseEngineLine(line); ok {
+			opts.onEngineMatch(m)
+		}
+	}
+}
+
+// runEngine searches the files in repoPath with engine ("rg" or "grep") and
+// returns its raw output lines: JSON messages for rg (--json), which parse
+// without ambiguity, and file:line:text lines for grep.
+func runEngine(engine, repoPath string, opts *Options) ([]string, error) {
+	var cmd *exec.Cmd
+	if engine == "rg" {
+		args := []string{"--json"}
+		if !opts.FixedStrings {
+			args = append(args, "--pcre2")
+		}
+		if opts.IncludeIgnored {
+			args = append(args, "-uu")
+		} else {
+			// Honor .gitignore but still search tracked dotfiles
+			args = append(args, "--hidden", "--glob", "!.git")
+		}
+		if opts.FollowSymlinks {
+			// rg detects symlink loops and reports them instead of recursing
+			args = append(args, "-L")
+		}
+		if opts.FirstMatch {
+			args = append(args, "-m1")
+		}
+		// The submatches of the JSON messages stand in for -o, and groups of
+		// context lines need no separator
+		if opts.IgnoreCase {
+			args = append(args, "-i")
+		} else if opts.SmartCase {
+			args = append(args, "--smart-case")
+		}
+		args = append(args, opts.contextArgs()...)
+		if threads := opts.engineThreads(); threads > 0 {
+			args = append(args, "--threads", strconv.Itoa(threads))
+		}
+		if opts.GlobCaseInsensitive {
+			args = append(args, "--glob-case-insensitive")
+		}
+		for _, g := range opts.IncludeGlobs {
+			if strings.TrimSpace(g) == "" {
+				continue
+			}
+			args = append(args, "--glob", g)
+		}
+		for _, g := range opts.ExcludeGlobs {
+			if strings.TrimSpace(g) == "" {
+				continue
+			}
+			args = append(args, "--glob", "!"+g)
+		}
+		switch opts.NewlineHandling {
+		case "crlf":
+			args = append(args, "--crlf")
+		case "multiline":
+			args = append(args, "--multiline")
+		}
+		args = append(args, opts.RgArgs...)
+		args = append(args, opts.rgPatternArgs()...)
+		args = append(args, opts.SparsePaths...)
+		if files := opts.enginePaths(); len(files) > 0 {
+			args = append(args, "--")
+			args = append(args, files...)
+		}
+		cmd = engineCommand(opts, "rg", args...)
+	} else {
+		// grep -r follows only the symlinks named on its command line, which
+		// are all of them with the file list of grepWorkingSet but none below
+		// "." with --include-ignored; -R follows every symlink it meets, and
+		// has no protection against links that point back up the tree.
+		// -Z ends file names with a NUL, so that no name can pass for a
+		// line number
+		args := []string{"-rn", "-Z", opts.matcherFlag()}
+		if opts.FollowSymlinks {
+			args[0] = "-Rn"
+		}
+		if opts.FirstMatch {
+			args = append(args, "-m1")
+		}
+		args = append(args, opts.contextArgs()...)
+		if opts.ContextSeparator != "" {
+			args = append(args, "--group-separator="+opts.ContextSeparator)
+		}
+		if opts.ignoreCase() {
+			args = append(args, "-i")
+		}
+		if opts.onlyMatching() {
+			args = append(args, "-o")
+		}
+		args = append(args, opts.grepGlobArgs()...)
+		args = append(args, opts.GrepArgs...)
+		args = append(args, opts.engineArgs()...)
+		if !opts.IncludeIgnored {
+			return grepWorkingSet(opts, repoPath, args)
+		}
+		if files := opts.enginePaths(); len(files) > 0 {
+			args = append(args, "--")
+			args = append(args, files...)
+		} else if len(opts.SparsePaths) > 0 {
+			args = append(args, opts.SparsePaths...)
+		} else {
+			args = append(args, ".")
+		}
+		cmd = engineCommand(opts, "grep", args...)
+	}
+
+	cmd.Dir = repoPath
+	return engineOutput(cmd, engineStream(engine, opts)), nil
+}
+
+// grepGlobArgs translates --include-glob and --exclude-glob into grep's
+// --include, --exclude and --exclude-dir. grep matches them against the base
+// name of the files it finds while recursing (--include-ignored), and against
+// a trailing part of the path of the working set files it is handed, so globs
+// with a slash in the middle narrow the working set only; a leading / or **/
+// is dropped. Exclude globs ending in / or /** name directories, and {a,b}
+// alternatives become one option each.
+func (o *Options) grepGlobArgs() []string {
+	clean := func(g string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(g), "/"), "**/")
+	}
+	var args []string
+	for _, g := range expandGlobs(o.IncludeGlobs) {
+		if g = clean(g); g != "" {
+			args = append(args, "--include="+g)
+		}
+	}
+	for _, g := range expandGlobs(o.ExcludeGlobs) {
+		g = clean(g)
+		if dir, ok := strings.CutSuffix(strings.TrimSuffix(g, "**"), "/"); ok && dir != "" {
+			args = append(args, "--exclude-dir="+dir, "--exclude="+dir+"/*")
+		} else if g != "" {
+			args = append(args, "--exclude="+g)
+		}
+	}
+	return args
+}
+
+// engineOutput runs an engine command and returns its output lines. With a
+// stream handler every line is also handed to it as soon as the engine writes
+// it.
+func engineOutput(cmd *exec.Cmd, stream func(string)) []string {
+	var out bytes.Buffer
+	var w io.Writer = &out
+	var lw *lineWriter
+	if stream != nil {
+		lw = &lineWriter{emit: stream}
+		w = io.MultiWriter(&out, lw)
+	}
+	// The same writer for both, so exec copies them in a single goroutine
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	if lw != nil {
+		lw.flush()
+	}
+
+	if err != nil && out.Len() == 0 {
+		// Both rg and grep return non-zero if no matches are found
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+// grepFilesPerRun bounds the file arguments of one grep invocation.
+const grepFilesPerRun = 500
+
+// grepWorkingSet runs grep with args over the working set of repoPath: the
+// tracked and untracked files that .gitignore does not exclude, as listed by
+// git. grep has no notion of .gitignore, so this is how it sees the same
+// files as rg without -uu.
+func grepWorkingSet(opts *Options, repoPath string, args []string) ([]string, error) {
+	pathspecs := opts.SparsePaths
+	if files := opts.enginePaths(); len(files) > 0 {
+		pathspecs = literalPathspecs(files)
+	}
+	files, err := workingSetFiles(repoPath, pathspecs)
+	if err != nil {
+		return nil, err
+	}
+	// Always print file names, and stay quiet about tracked files that were
+	// deleted from the working tree
+	args = append([]string{"-H", "-s"}, args...)
+	var lines []string
+	for len(files) > 0 {
+		n := min(len(files), grepFilesPerRun)
+		cmd := engineCommand(opts, "grep", append(append(args, "--"), files[:n]...)...)
+		cmd.Dir = repoPath
+		lines = append(lines, engineOutput(cmd, engineStream("grep", opts))...)
+		files = files[n:]
+	}
+	return lines, nil
+}
+
+// workingSetFiles lists the tracked and untracked, not ignored files of the
+// working tree of repoPath, limited to pathspecs if any.
+func workingSetFiles(repoPath string, pathspecs []string) ([]string, error) {
+	args := append([]string{"ls-files", "-z", "--cached", "--others", "--exclude-standard", "--"}, pathspecs...)
+	out, err := runGitCmd(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %v", err)
+	}
+	var files []string
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(out, "\x00") {
+		// Unmerged files are listed once per stage
+		if f != "" && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
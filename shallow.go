@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isShallowRepo reports whether repoPath is a shallow clone, in which history
+// and often all but the cloned branch are missing.
+func isShallowRepo(repoPath string) bool {
+	out, err := runGitCmd(repoPath, "rev-parse", "--is-shallow-repository")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// availableBranches drops the branches that cannot be resolved locally, as
+// happens in shallow single-branch clones or with a typo in --branches, and
+// returns them as missing.
+func availableBranches(repoPath string, branches []string) (kept, missing []string) {
+	for _, b := range branches {
+		if _, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", branchRef(repoPath, b)+"^{commit}"); err != nil {
+			missing = append(missing, b)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	return kept, missing
+}
+
+// checkBranchesExist fails when branches given with --branches or
+// --branches-file do not exist (--strict-branches), listing all of them. It
+// runs before anything in repoPath is locked, stashed or checked out, so a
+// typo leaves the repository alone; branches the remote gained since the
+// last fetch are fetched first.
+func checkBranchesExist(opts *Options, repoPath string) error {
+	branches, err := resolveBranches(opts, repoPath)
+	if err != nil {
+		return err
+	}
+	if _, missing := availableBranches(repoPath, branches); len(missing) > 0 {
+		fetchRemotes(opts, repoPath)
+		if _, missing = availableBranches(repoPath, branches); len(missing) > 0 {
+			return fmt.Errorf("unknown branches in %s: %s (--strict-branches)", repoPath, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// deepenBranches fetches depth more commits of the history of each of
+// branches from --remote-name with git fetch --deepen (--deepen), so that they can be
+// searched without unshallowing the whole repository. Branches that cannot be
+// deepened are searched as they are.
+func deepenBranches(repoPath string, branches []string, depth int) {
+	statusf("📚 Deepening %d branches by %d commits (--deepen)...\n", len(branches), depth)
+	for _, b := range branches {
+		remote := strings.TrimPrefix(b, remoteName+"/")
+		if _, err := runGitCmd(repoPath, "fetch", "--quiet", "--deepen="+strconv.Itoa(depth), remoteName, remote); err != nil {
+			statusf("⚠️  Could not deepen branch %s: %v\n", branchColor(b), err)
+		}
+	}
+}
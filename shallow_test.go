@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git-regex-search/internal/gitfixture"
+)
+
+func TestShallowClone(t *testing.T) {
+	full := gitfixture.New(t,
+		gitfixture.Branch{Name: "main", Files: map[string]string{"a.txt": "hello TODO\n"}},
+		gitfixture.Branch{Name: "develop", Files: map[string]string{"b.txt": "another TODO\n"}},
+	)
+	// A --depth clone fetches only the default branch, as CI checkouts do
+	root := filepath.Dir(full)
+	gitfixture.Git(t, root, "clone", "--quiet", "--depth", "1", "file://"+filepath.Join(root, "origin"), "shallow")
+	shallow := filepath.Join(root, "shallow")
+
+	tests := []struct {
+		name        string
+		repo        string
+		wantShallow bool
+		wantKept    []string
+		wantMissing []string
+	}{
+		{name: "full clone", repo: full, wantKept: []string{"main", "develop"}},
+		{name: "shallow clone", repo: shallow, wantShallow: true, wantKept: []string{"main"}, wantMissing: []string{"develop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isShallowRepo(tt.repo); got != tt.wantShallow {
+				t.Errorf("isShallowRepo() = %v, want %v", got, tt.wantShallow)
+			}
+			kept, missing := availableBranches(tt.repo, []string{"main", "develop"})
+			if !reflect.DeepEqual(kept, tt.wantKept) || !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("availableBranches() = %v, %v, want %v, %v", kept, missing, tt.wantKept, tt.wantMissing)
+			}
+		})
+	}
+}
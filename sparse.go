@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// cleanSparsePaths normalizes the --sparse directories, which must stay
+// inside the repository.
+func cleanSparsePaths(paths []string) ([]string, error) {
+	var cleaned []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		p = path.Clean(strings.TrimPrefix(p, "/"))
+		if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("invalid --sparse path %q: must be a directory inside the repository", p)
+		}
+		cleaned = append(cleaned, p)
+	}
+	return cleaned, nil
+}
+
+// enableSparseCheckout limits the working tree of repoPath to paths and
+// returns a function putting the previous sparse-checkout configuration back.
+// The returned function may be called more than once.
+func enableSparseCheckout(repoPath string, paths []string) (func(), error) {
+	wasSparse, _ := runGitCmd(repoPath, "config", "--bool", "core.sparseCheckout")
+	wasCone, _ := runGitCmd(repoPath, "config", "--bool", "core.sparseCheckoutCone")
+	var previous []string
+	if wasSparse == "true" {
+		list, err := runGitCmd(repoPath, "sparse-checkout", "list")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the current sparse-checkout patterns: %v", err)
+		}
+		previous = strings.Split(list, "\n")
+	}
+
+	args := append([]string{"sparse-checkout", "set", "--cone"}, paths...)
+	if _, err := runGitCmd(repoPath, args...); err != nil {
+		return nil, fmt.Errorf("failed to configure sparse-checkout: %v", err)
+	}
+
+	restored := false
+	restore := func() {
+		if restored {
+			return
+		}
+		restored = true
+		if wasSparse != "true" {
+			_, _ = runGitCmd(repoPath, "sparse-checkout", "disable")
+			return
+		}
+		mode := "--no-cone"
+		if wasCone == "true" {
+			mode = "--cone"
+		}
+		_, _ = runGitCmd(repoPath, append([]string{"sparse-checkout", "set", mode}, previous...)...)
+	}
+	return restore, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tempStashMessage is the message of the stash the checkout strategy creates
+// for the user's uncommitted changes.
+const tempStashMessage = "git-regex-search-temp-stash"
+
+// stashEntry is a single entry of git stash list.
+type stashEntry struct {
+	label  string
+	commit string
+}
+
+// listStashes returns the user's stash entries labeled stash@{N} as they were
+// numbered before this run, leaving out the tool's own temporary stash.
+func listStashes(repoPath string) ([]stashEntry, error) {
+	out, err := runGitCmd(repoPath, "stash", "list", "--format=%H%x00%gs")
+	if err != nil {
+		return nil, fmt.Errorf("git stash list failed: %v", err)
+	}
+	var entries []stashEntry
+	for _, line := range strings.Split(out, "\n") {
+		sha, subject, ok := strings.Cut(line, "\x00")
+		if !ok || sha == "" {
+			continue
+		}
+		if strings.HasSuffix(subject, ": "+tempStashMessage) {
+			continue
+		}
+		entries = append(entries, stashEntry{label: fmt.Sprintf("stash@{%d}", len(entries)), commit: sha})
+	}
+	return entries, nil
+}
+
+// searchStash greps a stash entry with git grep: the stashed working tree and,
+// when the stash was made with -u, its untracked files.
+func searchStash(opts *Options, repoPath string, entry stashEntry) ([]Match, error) {
+	matches, err := gitGrepRef(repoPath, opts, entry.commit)
+	if err != nil {
+		return nil, err
+	}
+	untracked := entry.commit + "^3"
+	if _, err := runGitCmd(repoPath, "rev-parse", "--verify", "--quiet", untracked); err == nil {
+		more, err := gitGrepRef(repoPath, opts, untracked)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, more...)
+	}
+	return matches, nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checkoutStrategies lists the accepted values of --checkout-strategy.
+//
+//   - checkout: check out and pull every branch in the repository itself (stashes
+//     local changes first). Searches exactly what a developer would see, but
+//     mutates the working tree.
+//   - worktree: check out every branch in a temporary detached worktree. The main
+//     checkout is never touched, at the cost of writing a full tree to disk.
+//   - none: search each branch ref directly with git grep. Nothing is checked
+//     out, which makes it the fastest and safest option, but only committed
+//     content is searched and the rg/grep engine is not used.
+var checkoutStrategies = []string{"checkout", "worktree", "none"}
+
+// workspace describes where a branch is materialized for searching.
+type workspace struct {
+	// repoPath is the repository being searched.
+	repoPath string
+	// dir is where the engine runs; it differs from repoPath in worktree mode.
+	dir string
+	// strategy is one of checkoutStrategies.
+	strategy string
+}
+
+// addTempWorktree creates a detached worktree in a temporary directory and
+// returns its path together with a function removing it again.
+func addTempWorktree(repoPath string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "git-regex-search-worktree-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create worktree directory: %v", err)
+	}
+	if _, err := runGitCmd(repoPath, "worktree", "add", "--quiet", "--detach", dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("failed to create worktree: %v", err)
+	}
+	cleanup := func() {
+		_, _ = runGitCmd(repoPath, "worktree", "remove", "--force", dir)
+		_ = os.RemoveAll(dir)
+	}
+	return dir, cleanup, nil
+}
+
+// searchBranch materializes branch according to the workspace strategy and
+// returns the raw matches found on it.
+func searchBranch(opts *Options, ws *workspace, branch string) ([]Match, error) {
+	opts = opts.forBranch(branch)
+	if opts.changedFiles != nil && len(opts.changedFiles) == 0 {
+		// Nothing changed since --changed-since, so there is nothing to check out
+		return nil, nil
+	}
+	switch ws.strategy {
+	case "none":
+		return gitGrepRef(ws.repoPath, opts, branchRef(ws.repoPath, branch))
+	case "worktree":
+		ref := branchRef(ws.repoPath, branch)
+		if _, err := opts.runGit(ws.dir, "checkout", "--quiet", "--detach", ref); err != nil {
+			return nil, fmt.Errorf("failed to check out %s in worktree: %v", ref, err)
+		}
+	default:
+		if err := checkoutBranch(opts, ws.repoPath, branch); err != nil {
+			return nil, err
+		}
+		if err := pullBranch(opts, ws.repoPath, branch); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.PreCommand != "" {
+		// In parallel mode this would print out of branch order
+		if !opts.QuietNoMatch && opts.MaxBranchesParallel <= 1 {
+			statusf("⚙️  Running pre-command on %s...\n", branchColor(branch))
+		}
+		if err := runPreCommand(opts, ws.dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.TrackedOnly {
+		return gitGrepRef(ws.dir, opts, "")
+	}
+
+	return grepRepo(ws.dir, opts)
+}
+
+// checkoutError reports that a branch could not be checked out. The branch is
+// skipped rather than searched in whatever state the working tree was left.
+type checkoutError struct {
+	branch string
+	err    error
+}
+
+func (e *checkoutError) Error() string {
+	return fmt.Sprintf("checkout of %s failed: %v", e.branch, e.err)
+}
+
+// checkoutBranch switches the working tree of repoPath to branch. With
+// --force-checkout, local modifications left behind by earlier branches (a
+// failed pull, files written by --pre-command) are discarded with
+// git reset --hard first. The user's own changes are safe in the stash by then.
+func checkoutBranch(opts *Options, repoPath, branch string) error {
+	_, err := opts.runGit(repoPath, "checkout", "--quiet", branch)
+	if err == nil || !opts.ForceCheckout {
+		if err != nil {
+			return &checkoutError{branch: branch, err: err}
+		}
+		return nil
+	}
+	statusf("🧨 Checkout of %s failed, discarding local modifications (--force-checkout)...\n", branchColor(branch))
+	_, _ = opts.runGit(repoPath, "reset", "--hard", "--quiet")
+	if _, err := opts.runGit(repoPath, "checkout", "--quiet", "--force", branch); err != nil {
+		return &checkoutError{branch: branch, err: err}
+	}
+	return nil
+}
+
+// pullStrategies lists the accepted --pull-strategy values.
+var pullStrategies = []string{"ff-only", "reset", "skip", "none"}
+
+// divergedError reports a branch skipped by --pull-strategy skip because it
+// has commits that origin does not have and vice versa.
+type divergedError struct {
+	branch        string
+	ahead, behind int
+}
+
+func (e *divergedError) Error() string {
+	return fmt.Sprintf("%s has diverged from %s (%d ahead, %d behind; --pull-strategy skip)", e.branch, remoteName, e.ahead, e.behind)
+}
+
+// skipsBranch reports whether err only rules out the branch being searched,
+// rather than the whole run.
+func skipsBranch(err error) bool {
+	var preErr *preCommandError
+	var checkoutErr *checkoutError
+	var divergedErr *divergedError
+	var patternErr *patternTimeoutError
+	return errors.As(err, &preErr) || errors.As(err, &checkoutErr) || errors.As(err, &divergedErr) || errors.As(err, &patternErr)
+}
+
+// aheadBehind counts the commits of the checked out branch that
+// origin/<branch> lacks and the other way round. ok is false when the branch
+// has no remote-tracking counterpart.
+func aheadBehind(repoPath, branch string) (ahead, behind int, ok bool) {
+	out, err := runGitCmd(repoPath, "rev-list", "--left-right", "--count", "HEAD...refs/remotes/"+remoteName+"/"+branch)
+	if err != nil {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(out, "%d %d", &ahead, &behind); err != nil {
+		return 0, 0, false
+	}
+	return ahead, behind, true
+}
+
+// pullBranch brings the checked out branch up to date with origin, which
+// git fetch --all has just refreshed. Instead of git pull, which creates a
+// merge commit when the branches have diverged, a branch that is only behind
+// is fast-forwarded and a diverged one is handled per --pull-strategy: left
+// as it is (ff-only), reset to origin (reset) or not searched at all (skip).
+func pullBranch(opts *Options, repoPath, branch string) error {
+	if opts.PullStrategy == "none" {
+		return nil
+	}
+	ahead, behind, ok := aheadBehind(repoPath, branch)
+	if !ok || behind == 0 {
+		return nil
+	}
+	quiet := opts.QuietNoMatch
+	remote := "refs/remotes/" + remoteName + "/" + branch
+	switch {
+	case ahead == 0:
+		if !quiet {
+			statusf("📥 Fast-forwarding %s to %s (%d behind)...\n", branchColor(branch), remoteName, behind)
+		}
+		if _, err := opts.runGit(repoPath, "merge", "--quiet", "--ff-only", remote); err != nil {
+			return &checkoutError{branch: branch, err: fmt.Errorf("fast-forward to %s failed: %v", remoteName, err)}
+		}
+	case opts.PullStrategy == "reset":
+		statusf("🧨 %s has diverged from %s (%d ahead, %d behind), resetting it to %s (--pull-strategy reset)...\n", branchColor(branch), remoteName, ahead, behind, remoteName)
+		if _, err := opts.runGit(repoPath, "reset", "--hard", "--quiet", remote); err != nil {
+			return &checkoutError{branch: branch, err: err}
+		}
+	case opts.PullStrategy == "skip":
+		return &divergedError{branch: branch, ahead: ahead, behind: behind}
+	default:
+		statusf("⚠️  %s has diverged from %s (%d ahead, %d behind), searching the local branch without pulling\n", branchColor(branch), remoteName, ahead, behind)
+	}
+	return nil
+}
+
+// blameRev returns the revision git blame should use for matches on branch:
+// the working tree for checkout-based strategies, the branch ref otherwise.
+func (ws *workspace) blameRev(branch string) string {
+	if ws.strategy == "none" {
+		return branchRef(ws.repoPath, branch)
+	}
+	return ""
+}
+
+// gitGrepRef searches ref with git grep without checking it out. An empty ref
+// searches the files git tracks in the working tree of repoPath instead.
+func gitGrepRef(repoPath string, opts *Options, ref string) ([]Match, error) {
+	// -z ends file names with a NUL, so that no name can pass for a line number
+	args := []string{"grep", "-n", "-z", "-I", opts.matcherFlag()}
+	args = append(args, opts.contextArgs()...)
+	if opts.FirstMatch {
+		args = append(args, "-m1")
+	}
+	if opts.onlyMatching() {
+		args = append(args, "-o")
+	}
+	if opts.ignoreCase() {
+		args = append(args, "-i")
+	}
+	args = append(args, opts.engineArgs()...)
+	if ref != "" {
+		args = append(args, ref)
+	}
+	if pathspecs := globPathspecs(opts.IncludeGlobs, opts.ExcludeGlobs, opts.GlobCaseInsensitive); len(pathspecs) > 0 {
+		args = append(args, "--")
+		args = append(args, pathspecs...)
+	} else if files := opts.enginePaths(); len(files) > 0 {
+		args = append(args, "--")
+		args = append(args, literalPathspecs(files)...)
+	}
+
+	bounded, cancel := opts.withPatternTimeout()
+	defer cancel()
+	out, err := bounded.runGit(repoPath, args...)
+	if bounded.patternTimedOut() {
+		return nil, &patternTimeoutError{engine: "git grep", timeout: opts.PatternTimeout}
+	}
+	if err != nil {
+		// git grep exits 1 when nothing matched
+		if exitCode(err) == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git grep failed: %v", err)
+	}
+
+	parse := parseMatch
+	prefix := ""
+	if ref != "" {
+		parse = func(line string) (Match, bool) { return parseRefMatch(line, ref) }
+		prefix = ref + ":"
+	}
+	return parseWithContext(strings.Split(out, "\n"), opts.BeforeLines, opts.AfterLines, prefix, opts.re, parse), nil
+}
+
+// globPathspecs translates ripgrep-style include/exclude globs into git
+// pathspecs. Like ripgrep, globs without a slash match at any depth. With
+// icase the globs ignore case, like rg --glob-case-insensitive.
+func globPathspecs(includeGlobs, excludeGlobs []string, icase bool) []string {
+	includeGlobs, excludeGlobs = expandGlobs(includeGlobs), expandGlobs(excludeGlobs)
+	var specs []string
+	magic := "glob"
+	if icase {
+		magic = "glob,icase"
+	}
+	toGlob := func(g string) string {
+		if !strings.Contains(g, "/") {
+			return "**/" + g
+		}
+		return strings.TrimPrefix(g, "/")
+	}
+	for _, g := range includeGlobs {
+		if g = strings.TrimSpace(g); g != "" {
+			specs = append(specs, ":("+magic+")"+toGlob(g))
+		}
+	}
+	if len(specs) == 0 && len(excludeGlobs) > 0 {
+		// Exclude-only pathspecs need something to exclude from
+		specs = append(specs, ":/")
+	}
+	for _, g := range excludeGlobs {
+		if g = strings.TrimSpace(g); g != "" {
+			specs = append(specs, ":(exclude,"+magic+")"+toGlob(g))
+		}
+	}
+	return specs
+}
+
+// expandGlobs returns globs with their {a,b} alternatives expanded; see
+// expandBraces.
+func expandGlobs(globs []string) []string {
+	var expanded []string
+	for _, g := range globs {
+		expanded = append(expanded, expandBraces(g)...)
+	}
+	return expanded
+}
+
+// expandBraces expands the {a,b} alternatives of a ripgrep glob, which
+// neither grep --include nor git pathspecs support, into one glob per
+// alternative: *.{go,txt} becomes *.go and *.txt. Nested braces are expanded
+// too; braces without a comma or without a closing } are kept as they are.
+func expandBraces(g string) []string {
+	depth, open := 0, -1
+	var commas []int
+	for i := 0; i < len(g); i++ {
+		switch g[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open, commas = i, nil
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			if depth--; depth > 0 || len(commas) == 0 {
+				continue
+			}
+			var expanded []string
+			start := open + 1
+			for _, end := range append(commas, i) {
+				expanded = append(expanded, expandBraces(g[:open]+g[start:end]+g[i+1:])...)
+				start = end + 1
+			}
+			return expanded
+		}
+	}
+	return []string{g}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// lineWriter calls emit with every complete line written to it, so an engine's
+// output can be handled while the engine is still running.
+type lineWriter struct {
+	emit    func(string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush emits the last line if the output did not end with a newline.
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.emit(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// matchAsYouGoConflicts returns the flags set in opts that decide what to
+// print only once the whole branch was searched, which --match-as-you-go
+// cannot wait for.
+func matchAsYouGoConflicts(opts *Options) []string {
+	var conflicts []string
+	for _, c := range []struct {
+		set  bool
+		flag string
+	}{
+		{opts.ContextLines > 0, "context"},
+		{opts.FirstMatch, "first-match"},
+		{opts.MatchLimitTotal > 0, "match-limit-total"},
+		{opts.MinMatches > 0, "min-matches"},
+		{opts.MaxPerFile > 0, "max-per-file"},
+		{opts.MaxPerBranch > 0, "max-matches-per-branch"},
+		{opts.DedupeText, "dedupe-text"},
+		{opts.AnnotateNew, "annotate-new"},
+		{opts.Author != "", "author"},
+		{opts.Committer != "", "committer"},
+		{opts.Blame, "blame"},
+		{opts.CaptureGroup > 0, "capture-group"},
+		{opts.Sample > 0, "sample"},
+		{opts.Aggregate, "aggregate"},
+		{opts.QuietNoMatch, "quiet-no-match"},
+		{opts.filesOnly(), "files-with-matches"},
+	} {
+		if c.set {
+			conflicts = append(conflicts, "--"+c.flag)
+		}
+	}
+	return conflicts
+}
+
+// streamMatches returns the engine match handler of --match-as-you-go for a
+// branch: every match that passes the per-line filters is printed at once,
+// instead of with the rest of the branch once the engine is done. It sets
+// *streamed when it printed anything, so the branch loop does not print the
+// matches again.
+func streamMatches(opts *Options, res *Result, localOnly map[string]bool, repoName, label string, streamed *bool) func(Match) {
+	return func(m Match) {
+		matches := dropLocalOnly(localOnly, []Match{m})
+		matches = filterNotMatching(opts, matches)
+		matches = filterLineRange(opts, matches)
+		matches = filterLineLength(opts, matches)
+		if len(matches) == 0 {
+			return
+		}
+		annotateMatches(opts, repoName, label, matches)
+		tagRules(opts, matches)
+
+		if !*streamed {
+			if res.emittedGroups > 0 {
+				if sep, ok := opts.branchSeparator(); ok {
+					fmt.Fprintln(matchOutput, sep)
+				}
+			}
+			res.emittedGroups++
+			*streamed = true
+		}
+		printTextMatches(matchOutput, opts.re, displayMatches(opts, res, matches))
+	}
+}
+
+// streamableEngine reports whether --match-as-you-go can follow the engine
+// output of a search with opts: rg or grep alone, on a checked-out tree.
+func streamableEngine(opts *Options) error {
+	switch {
+	case opts.CheckoutStrategy == "none" || opts.TrackedOnly:
+		return fmt.Errorf("--match-as-you-go follows the output of rg or grep on a checked-out tree; git grep is used with --checkout-strategy none and --tracked-only")
+	case opts.Engine == "all":
+		return fmt.Errorf("--match-as-you-go cannot be combined with --engine all, which merges the output of several engines")
+	case opts.MaxBranchesParallel > 1:
+		return fmt.Errorf("--match-as-you-go cannot be combined with --max-branches-parallel; branches searched at once would print into each other")
+	case opts.OutputFormat != "text":
+		return fmt.Errorf("--match-as-you-go prints matches as text; --output-format %s is rendered at the end of the run", opts.OutputFormat)
+	}
+	if conflicts := matchAsYouGoConflicts(opts); len(conflicts) > 0 {
+		return fmt.Errorf("--match-as-you-go prints each line as soon as it is found, so it cannot be combined with %s (they need the whole branch first)", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// checkEnginePatterns runs every engine the search will use once on an empty
+// file (--strict-regex), so that a pattern only the engine rejects, e.g. a
+// PCRE2 or ERE syntax error the Go check lets through, fails the run before
+// anything is fetched or checked out rather than on the first branch.
+func checkEnginePatterns(opts *Options) error {
+	dir, err := os.MkdirTemp("", "git-regex-search-strict-")
+	if err != nil {
+		return fmt.Errorf("failed to create --strict-regex directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "empty"), nil, 0o644); err != nil {
+		return fmt.Errorf("failed to create --strict-regex file: %v", err)
+	}
+
+	for _, engine := range strictEngines(opts) {
+		var args []string
+		switch engine {
+		case "rg":
+			args = []string{"--no-config"}
+			if !opts.FixedStrings {
+				args = append(args, "--pcre2")
+			}
+			if opts.NewlineHandling == "multiline" {
+				args = append(args, "--multiline")
+			}
+			args = append(args, opts.RgArgs...)
+			args = append(args, opts.rgPatternArgs()...)
+		case "grep":
+			args = []string{opts.matcherFlag()}
+			args = append(args, opts.GrepArgs...)
+			args = append(args, opts.engineArgs()...)
+		case "git":
+			args = append([]string{"grep", "--no-index", opts.matcherFlag()}, opts.engineArgs()...)
+		}
+		args = append(args, "--", "empty")
+		cmd := exec.Command(engine, args...)
+		cmd.Dir = dir
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		// Every engine exits 1 when nothing matched, which is all an empty
+		// file can do
+		if err := cmd.Run(); err != nil && exitCode(err) != 1 {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			name := engine
+			if engine == "git" {
+				name = "git grep"
+			}
+			return fmt.Errorf("--strict-regex: %s rejects the pattern: %s", name, msg)
+		}
+	}
+	return nil
+}
+
+// strictEngines returns the engines the search runs the patterns through:
+// git grep when nothing is checked out or for submodules and unreachable
+// commits, rg and grep as selected by --engine otherwise.
+func strictEngines(opts *Options) []string {
+	var engines []string
+	if opts.Patch == "" && opts.CheckoutStrategy != "none" && !opts.TrackedOnly {
+		engines = opts.searchEngines()
+	}
+	if opts.Patch == "" && (opts.CheckoutStrategy == "none" || opts.TrackedOnly || opts.SearchSubmodules || opts.IncludeDangling) {
+		engines = append(engines, "git")
+	}
+	return engines
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// initializedSubmodules returns the paths of the submodules of repoPath that
+// are checked out, as reported by git submodule status. Submodules that were
+// never initialized have no objects to search and are left out.
+func initializedSubmodules(repoPath string) ([]string, error) {
+	out, err := runGitCmd(repoPath, "submodule", "status")
+	if err != nil {
+		return nil, fmt.Errorf("git submodule status failed: %v", err)
+	}
+	var paths []string
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" || line[0] == '-' {
+			continue
+		}
+		// "<state><sha> <path> (<describe>)"
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			continue
+		}
+		paths = append(paths, fields[1])
+	}
+	return paths, nil
+}
+
+// pinnedCommit returns the commit rev records for the submodule at path.
+func pinnedCommit(repoPath, rev, path string) (string, bool) {
+	out, err := runGitCmd(repoPath, "ls-tree", rev, "--", path)
+	if err != nil {
+		return "", false
+	}
+	// "160000 commit <sha>\t<path>"
+	fields := strings.Fields(out)
+	if len(fields) < 3 || fields[1] != "commit" {
+		return "", false
+	}
+	return fields[2], true
+}
+
+// searchSubmodules searches the submodules of repoPath with git grep at the
+// commits rev pins them to, recursing into nested submodules. File names are
+// prefixed with the submodule path so matches read like paths in the
+// superproject.
+func searchSubmodules(opts *Options, repoPath, rev, prefix string) ([]Match, error) {
+	paths, err := initializedSubmodules(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	for _, path := range paths {
+		commit, ok := pinnedCommit(repoPath, rev, path)
+		if !ok {
+			// Not part of rev, e.g. added on another branch
+			continue
+		}
+		dir := filepath.Join(repoPath, path)
+		if _, err := runGitCmd(dir, "cat-file", "-e", commit+"^{commit}"); err != nil {
+			statusf("⚠️  Skipping submodule %s%s: commit %s is not fetched\n", prefix, path, shortSHA(commit))
+			continue
+		}
+
+		found, err := gitGrepRef(dir, opts, commit)
+		if err != nil {
+			return nil, fmt.Errorf("submodule %s%s: %v", prefix, path, err)
+		}
+		nested, err := searchSubmodules(opts, dir, commit, prefix+path+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range found {
+			m.File = prefix + path + "/" + m.File
+			matches = append(matches, m)
+		}
+		matches = append(matches, nested...)
+	}
+	return matches, nil
+}
+
+// dropSubmoduleMatches removes engine matches inside submodule working trees,
+// which --search-submodules replaces with matches at the pinned commits.
+func dropSubmoduleMatches(repoPath string, matches []Match) []Match {
+	paths, err := initializedSubmodules(repoPath)
+	if err != nil || len(paths) == 0 {
+		return matches
+	}
+	var kept []Match
+	for _, m := range matches {
+		file := strings.TrimPrefix(m.File, "./")
+		inSubmodule := false
+		for _, p := range paths {
+			if strings.HasPrefix(file, p+"/") {
+				inSubmodule = true
+				break
+			}
+		}
+		if !inSubmodule {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
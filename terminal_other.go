@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// terminalWidth is not detected on this platform; callers fall back to $COLUMNS.
+func terminalWidth() int {
+	return 0
+}
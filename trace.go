@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// gitTrace receives a record of every git command run by runGitCmd when
+// --trace is set.
+var gitTrace *traceLog
+
+// traceRecord is one line of the --trace log.
+type traceRecord struct {
+	Time       string   `json:"time"`
+	Dir        string   `json:"dir"`
+	Args       []string `json:"args"`
+	ExitCode   int      `json:"exit_code"`
+	DurationMS float64  `json:"duration_ms"`
+	Stdout     int      `json:"stdout_bytes"`
+	Stderr     int      `json:"stderr_bytes"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// traceLog writes traceRecords as JSON lines. It is safe for concurrent use,
+// as branches may be searched in parallel.
+type traceLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// startTrace opens the --trace log, truncating an existing file. The returned
+// function closes it.
+func startTrace(opts *Options) (func(), error) {
+	if opts.Trace == "" {
+		return func() {}, nil
+	}
+	f, err := os.Create(opts.Trace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace log: %v", err)
+	}
+	gitTrace = &traceLog{f: f, enc: json.NewEncoder(f)}
+	return func() {
+		gitTrace = nil
+		f.Close()
+	}, nil
+}
+
+// record logs a git command that started at start. Write errors are ignored so
+// that tracing never changes the outcome of a run.
+func (t *traceLog) record(dir string, args []string, start time.Time, stdout, stderr int, err error) {
+	if t == nil {
+		return
+	}
+	rec := traceRecord{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		Dir:        dir,
+		Args:       args,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}
+	if err != nil {
+		rec.ExitCode = exitCode(err)
+		rec.Error = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.enc.Encode(rec)
+}
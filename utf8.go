@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+// invalidUTF8Modes lists the accepted values of --invalid-utf8.
+//
+//   - sanitize: replace invalid bytes with U+FFFD.
+//   - base64: also keep the original bytes, base64-encoded, in text_base64.
+var invalidUTF8Modes = []string{"sanitize", "base64"}
+
+// fixInvalidUTF8 makes the text of matches valid UTF-8 for the structured
+// output formats according to mode, and returns how many lines needed it.
+func fixInvalidUTF8(mode string, matches []Match) int {
+	n := 0
+	for i := range matches {
+		if utf8.ValidString(matches[i].Text) {
+			continue
+		}
+		n++
+		if mode == "base64" {
+			matches[i].TextBase64 = base64.StdEncoding.EncodeToString([]byte(matches[i].Text))
+		}
+		matches[i].Text = strings.ToValidUTF8(matches[i].Text, "�")
+	}
+	return n
+}
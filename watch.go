@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// refSnapshot returns the refs and HEAD of every searched repository, used to
+// notice commits, fetches and branch changes between runs.
+func refSnapshot(repos []string) string {
+	var b strings.Builder
+	for _, repoPath := range repos {
+		refs, _ := runGitCmd(repoPath, "for-each-ref", "--format=%(refname) %(objectname)")
+		head, _ := runGitCmd(repoPath, "rev-parse", "HEAD")
+		fmt.Fprintf(&b, "%s\n%s\n%s\n", repoPath, head, refs)
+	}
+	return b.String()
+}
+
+// runWatch runs the search, then polls the repositories' refs every
+// --watch-interval and runs it again whenever they changed. Remotes are fetched
+// every --watch-fetch-interval so that pushes by others are picked up too.
+// Ctrl-C ends the watch; a search in progress is finished first so that the
+// repository is always restored.
+func runWatch(opts *Options) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	clear := isatty.IsTerminal(os.Stdout.Fd())
+	lastFetch := time.Now()
+	for {
+		if clear {
+			fmt.Print("\033[H\033[2J")
+		}
+		if err := runSearch(opts); err != nil {
+			return err
+		}
+		statusf("👀 Watching for ref changes every %s (Ctrl-C to stop)...\n", opts.WatchInterval)
+
+		snapshot := refSnapshot(opts.Repos)
+		for changed := false; !changed; {
+			select {
+			case <-interrupt:
+				statusln("\n👋 Stopped watching")
+				return nil
+			case <-time.After(opts.WatchInterval):
+			}
+			if !opts.ReadOnly && !opts.Offline && opts.WatchFetchInterval > 0 && time.Since(lastFetch) >= opts.WatchFetchInterval {
+				for _, repoPath := range opts.Repos {
+					_, _ = runGitCmd(repoPath, "fetch", "--all", "--quiet")
+				}
+				lastFetch = time.Now()
+			}
+			changed = refSnapshot(opts.Repos) != snapshot
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// existingWorktree is an entry of git worktree list --porcelain.
+type existingWorktree struct {
+	path string
+	// branch is the short name of the checked out branch, or "" when detached.
+	branch string
+	head   string
+}
+
+// label names the matches of the worktree as <branch>@<path>.
+func (wt existingWorktree) label() string {
+	branch := wt.branch
+	if branch == "" {
+		branch = "detached-" + shortSHA(wt.head)
+	}
+	return branch + "@" + wt.path
+}
+
+// listWorktrees returns the worktrees of repoPath that have a working tree on
+// disk, the main one first.
+func listWorktrees(repoPath string) ([]existingWorktree, error) {
+	out, err := runGitCmd(repoPath, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("git worktree list failed: %v", err)
+	}
+	var worktrees []existingWorktree
+	// Records are separated by blank lines
+	for _, record := range strings.Split(out, "\n\n") {
+		var wt existingWorktree
+		bare := false
+		for _, line := range strings.Split(record, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				wt.path = value
+			case "HEAD":
+				wt.head = value
+			case "branch":
+				wt.branch = strings.TrimPrefix(value, "refs/heads/")
+			case "bare":
+				bare = true
+			}
+		}
+		if wt.path == "" || bare {
+			continue
+		}
+		if _, err := os.Stat(wt.path); err != nil {
+			// Prunable: the directory was deleted without git worktree remove
+			continue
+		}
+		worktrees = append(worktrees, wt)
+	}
+	return worktrees, nil
+}
+
+// searchWorktrees searches every existing worktree of repoPath as it is
+// checked out, uncommitted changes included (--search-worktrees). Nothing is
+// stashed, checked out, created or removed.
+func searchWorktrees(opts *Options, repoPath, repoName string, res *Result) error {
+	worktrees, err := listWorktrees(repoPath)
+	if err != nil {
+		return err
+	}
+	statusf("Searching across %d worktrees...\n", len(worktrees))
+
+	for _, wt := range worktrees {
+		label := wt.label()
+		if res.worktreePaths == nil {
+			res.worktreePaths = make(map[string]string)
+		}
+		res.worktreePaths[(Match{Repo: repoName, Branch: label}).label()] = wt.path
+		statusf("\n🌳 Searching worktree: %s\n", branchColor(label))
+		var matches []Match
+		if opts.TrackedOnly {
+			matches, err = gitGrepRef(wt.path, opts, "")
+		} else {
+			matches, err = grepRepo(wt.path, opts)
+		}
+		if err != nil {
+			res.addError("skipping worktree %s: %v", wt.path, err)
+			continue
+		}
+		if opts.SkipAssumeUnchanged {
+			// Every worktree has an index of its own
+			localOnly, err := localOnlyFiles(wt.path)
+			if err != nil {
+				res.addError("skipping worktree %s: %v", wt.path, err)
+				continue
+			}
+			matches = dropLocalOnly(localOnly, matches)
+		}
+		for i := range matches {
+			matches[i].Repo = repoName
+			matches[i].Branch = label
+		}
+		matches = filterNotMatching(opts, matches)
+		matches = filterLineRange(opts, matches)
+		matches = filterLineLength(opts, matches)
+		tagRules(opts, matches)
+		matches = filterByBlame(opts, wt.path, "", matches)
+		matches = dedupeText(opts, matches)
+		matches = limitPerFile(opts, matches)
+		matches = res.limitTotal(opts.MatchLimitTotal, matches)
+		res.addBranch(repoName, label, matches)
+		if len(matches) > 0 {
+			statusf("✅ Found %d matches in %s\n", len(matches), branchColor(label))
+			emitMatches(opts, res, matches)
+		} else {
+			statusf("❌ No matches found in %s\n", branchColor(label))
+		}
+		if res.Summary.Stopped {
+			break
+		}
+	}
+	return nil
+}